@@ -0,0 +1,232 @@
+package main
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	// Name of the status file in each artist's directory.
+	artistStatusFilename = "status.json"
+
+	// The heading FA puts on system message pages, in both templates.
+	systemMessageHeading = "System Message"
+)
+
+// AccountStatus is the state of an artist's account, as far as we can tell
+// from the pages FA gives us.
+type AccountStatus string
+
+const (
+	AccountActive          AccountStatus = "active"
+	AccountNotFound        AccountStatus = "not_found"        // No such user, or deleted
+	AccountDisabled        AccountStatus = "disabled"         // Disabled by its owner
+	AccountBanned          AccountStatus = "banned"           // Banned or suspended by FA
+	AccountPendingDeletion AccountStatus = "pending_deletion" // Deletion requested by its owner
+	AccountRegisteredOnly  AccountStatus = "registered_only"  // Only visible when logged in
+	AccountUnavailable     AccountStatus = "unavailable"      // A system message we don't recognize
+)
+
+var (
+	ErrAccountUnavailable = errors.New("artist account unavailable")
+
+	// Phrases in FA's system messages, in the order they're checked, and the
+	// status each one means.  The messages are matched in lowercase.
+	accountStatusPhrases = []struct {
+		phrase string
+		status AccountStatus
+	}{
+		{"pending deletion", AccountPendingDeletion},
+		{"registered users only", AccountRegisteredOnly},
+		{"banned", AccountBanned},
+		{"suspended", AccountBanned},
+		{"disabled", AccountDisabled},
+		{"cannot be found", AccountNotFound},
+		{"not found", AccountNotFound},
+	}
+)
+
+// AccountUnavailableError is returned when FA shows a system message instead
+// of an artist's page, e.g. because the account has been disabled.  This is
+// distinct from an artist who simply has nothing new.
+type AccountUnavailableError struct {
+	Username string        // The artist
+	Status   AccountStatus // What the message means
+	Message  string        // The message, as FA worded it
+	URL      string        // The page which showed the message
+}
+
+// Error implements the error interface.
+//
+// Returns:
+//   - string: The error message
+func (e *AccountUnavailableError) Error() string {
+	return fmt.Sprintf("%s: %s is %s at %s: %q", ErrAccountUnavailable, e.Username, e.Status, e.URL, e.Message)
+}
+
+// Unwrap returns ErrAccountUnavailable, so callers can use errors.Is.
+//
+// Returns:
+//   - error: ErrAccountUnavailable
+func (e *AccountUnavailableError) Unwrap() error {
+	return ErrAccountUnavailable
+}
+
+// ArtistStatus is the status file saved as status.json in each artist's
+// directory.  It's updated every time the artist is crawled.
+type ArtistStatus struct {
+	Status    AccountStatus `json:"status"`
+	Message   string        `json:"message,omitempty"` // FA's system message, if any
+	Since     time.Time     `json:"since"`             // When this status was first seen
+	CheckedAt time.Time     `json:"checked_at"`        // When it was last seen
+}
+
+// checkAccountStatus looks for a system message on a page fetched for an
+// artist.
+//
+// Parameters:
+//   - username: The artist
+//   - url: The URL of the page
+//   - body: The HTML content of the page
+//
+// Returns:
+//   - error: An *AccountUnavailableError if the page is a system message, nil
+//     otherwise
+func checkAccountStatus(username string, url string, body []byte) error {
+	message, ok := parseSystemMessage(body)
+	if !ok {
+		return nil
+	}
+	return &AccountUnavailableError{
+		Username: username,
+		Status:   classifySystemMessage(message),
+		Message:  message,
+		URL:      url,
+	}
+}
+
+// parseSystemMessage extracts the message from one of FA's system message
+// pages.  The modern template puts it in a notice section under a "System
+// Message" heading.  The classic template puts it in a table whose header cell
+// says "System Message".
+//
+// Parameters:
+//   - body: The HTML content of the page
+//
+// Returns:
+//   - string: The message, with the heading removed
+//   - bool: true if the page is a system message
+func parseSystemMessage(body []byte) (string, bool) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		// goquery only fails if reading fails, which can't happen with an
+		// in-memory byte slice.
+		fatalInvariant(err)
+	}
+
+	notice := doc.Find("section.notice-message").First()
+	if notice.Length() > 0 {
+		notice = notice.Clone()
+		notice.Find("h2").Remove()
+		return cleanText(notice.Text()), true
+	}
+
+	var message string
+	found := false
+	doc.Find("table.maintable td.cat").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		if cleanText(s.Text()) != systemMessageHeading {
+			return true
+		}
+		// The message is followed by a "Continue" link on a line of its own.
+		lines := strings.Split(multilineText(s.Closest("table").Find("td.alt1").First()), "\n")
+		message = lines[0]
+		found = true
+		return false
+	})
+	return message, found
+}
+
+// classifySystemMessage works out what a system message says about an
+// account.
+//
+// Parameters:
+//   - message: The message text
+//
+// Returns:
+//   - AccountStatus: The status, AccountUnavailable if it isn't recognized
+func classifySystemMessage(message string) AccountStatus {
+	message = strings.ToLower(message)
+	for _, phrase := range accountStatusPhrases {
+		if strings.Contains(message, phrase.phrase) {
+			return phrase.status
+		}
+	}
+	return AccountUnavailable
+}
+
+// StatusPath returns where the artist's account status is recorded.
+//
+// Returns:
+//   - string: The path of the status file
+func (a *Artist) StatusPath() string {
+	return filepath.Join(a.artistDir, artistStatusFilename)
+}
+
+// LoadStatus reads the artist's recorded account status.
+//
+// Returns:
+//   - *ArtistStatus: The recorded status, or nil if there isn't one yet
+//   - error: Any error reading or parsing the file
+func (a *Artist) LoadStatus() (*ArtistStatus, error) {
+	status := &ArtistStatus{}
+	found, err := readJSONFile(a.StatusPath(), status)
+	if err != nil || !found {
+		return nil, err
+	}
+	return status, nil
+}
+
+// RecordStatus records the artist's account status.  If it's the same as
+// last time, when it was first seen is kept.
+//
+// Parameters:
+//   - status: The status
+//   - message: FA's system message, if any
+//   - now: The current time
+//
+// Returns:
+//   - error: Any error reading or writing the status file
+func (a *Artist) RecordStatus(status AccountStatus, message string, now time.Time) error {
+	record := &ArtistStatus{
+		Status:    status,
+		Message:   message,
+		Since:     now.UTC(),
+		CheckedAt: now.UTC(),
+	}
+	previous, err := a.LoadStatus()
+	if err != nil {
+		return err
+	}
+	if previous != nil && previous.Status == status {
+		record.Since = previous.Since
+	}
+
+	err = os.MkdirAll(a.artistDir, submissionDirPermissions)
+	if err != nil {
+		return fmt.Errorf("failed to create artist directory: %w", err)
+	}
+	err = writeJSONFileAtomic(a.StatusPath(), record)
+	if err != nil {
+		return fmt.Errorf("failed to write artist status: %w", err)
+	}
+	return nil
+}
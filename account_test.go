@@ -0,0 +1,160 @@
+package main_test
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"errors"
+	main "furtrap"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+const accountArtist = "gone-artist"
+
+// modernSystemMessage builds a system message page in the modern template.
+func modernSystemMessage(message string) []byte {
+	return []byte(`<html><head><title>System Error</title></head><body><div id="site-content">
+		<section class="aligncenter notice-message"><div class="section-body alignleft">
+			<div class="redirect-message"><h2>System Message</h2>
+				<p class="link-override">` + message + `</p>
+			</div>
+		</div></section>
+	</div></body></html>`)
+}
+
+// classicSystemMessage builds a system message page in the classic template.
+func classicSystemMessage(message string) []byte {
+	return []byte(`<html><head><title>System Error</title></head><body>
+		<table class="maintable" width="50%"><tbody>
+			<tr><td class="cat"><b>System Message</b></td></tr>
+			<tr><td class="alt1">` + message + `<br/><br/><a href="/">Continue &raquo;</a></td></tr>
+		</tbody></table>
+	</body></html>`)
+}
+
+func TestArtist_AccountStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		page    []byte
+		message string
+		status  main.AccountStatus
+	}{
+		{
+			name:    "not found",
+			page:    modernSystemMessage("This user cannot be found."),
+			message: "This user cannot be found.",
+			status:  main.AccountNotFound,
+		},
+		{
+			name: "disabled",
+			page: modernSystemMessage(`User "gone-artist" has voluntarily disabled access to their account ` +
+				`and all of its contents.`),
+			status: main.AccountDisabled,
+		},
+		{
+			name: "pending deletion",
+			page: modernSystemMessage("The page you are trying to reach is currently pending deletion " +
+				"by a request from its owner."),
+			status: main.AccountPendingDeletion,
+		},
+		{
+			name: "registered users only",
+			page: modernSystemMessage("The owner of this page has elected to make it available " +
+				"to registered users only."),
+			status: main.AccountRegisteredOnly,
+		},
+		{
+			name:   "banned",
+			page:   modernSystemMessage("This user has been banned."),
+			status: main.AccountBanned,
+		},
+		{
+			name:    "classic template",
+			page:    classicSystemMessage("This user cannot be found."),
+			message: "This user cannot be found.",
+			status:  main.AccountNotFound,
+		},
+		{
+			name:   "unrecognized message",
+			page:   modernSystemMessage("Something else entirely."),
+			status: main.AccountUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewTestClient()
+			url := "https://www.furaffinity.net/gallery/" + accountArtist + "/1"
+			client.SetResponse(url, tt.page, nil)
+			artist := main.NewArtist(NewTestLogger(t), client, accountArtist, t.TempDir())
+
+			_, err := artist.Submissions(t.Context(), false, true)
+			assert.ErrorIs(t, err, main.ErrAccountUnavailable)
+			var accountErr *main.AccountUnavailableError
+			assert.Assert(t, errors.As(err, &accountErr))
+			assert.Equal(t, accountErr.Status, tt.status)
+			assert.Equal(t, accountErr.URL, url)
+			if tt.message != "" {
+				assert.Equal(t, accountErr.Message, tt.message)
+			}
+		})
+	}
+}
+
+func TestArtist_RecordStatus(t *testing.T) {
+	artist := main.NewArtist(NewTestLogger(t), NewTestClient(), accountArtist, filepath.Join(t.TempDir(), accountArtist))
+	status, err := artist.LoadStatus()
+	assert.NilError(t, err)
+	assert.Assert(t, status == nil)
+
+	first := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	second := first.Add(24 * time.Hour)
+	assert.NilError(t, artist.RecordStatus(main.AccountDisabled, "disabled", first))
+	assert.NilError(t, artist.RecordStatus(main.AccountDisabled, "disabled", second))
+	assert.DeepEqual(t, readJSON[main.ArtistStatus](t, artist.StatusPath()), main.ArtistStatus{
+		Status:    main.AccountDisabled,
+		Message:   "disabled",
+		Since:     first,
+		CheckedAt: second,
+	})
+
+	// A new status starts again
+	assert.NilError(t, artist.RecordStatus(main.AccountActive, "", second))
+	assert.DeepEqual(t, readJSON[main.ArtistStatus](t, artist.StatusPath()), main.ArtistStatus{
+		Status:    main.AccountActive,
+		Since:     second,
+		CheckedAt: second,
+	})
+}
+
+func TestScraper_UnavailableArtist(t *testing.T) {
+	tempdir := t.TempDir()
+	client := NewTestClient()
+	client.SetResponse("https://www.furaffinity.net/gallery/"+accountArtist+"/1",
+		modernSystemMessage("This user cannot be found."), nil)
+
+	scraper := main.NewScraper(NewTestLogger(t), client, "",
+		[]string{accountArtist, "artist-with-two-submissions"}, false, false, tempdir)
+	err := scraper.Run(t.Context())
+	assert.NilError(t, err)
+	assert.DeepEqual(t, scraper.Summary(), main.RunSummary{
+		ArtistsTotal:       2,
+		ArtistsCompleted:   1,
+		ArtistsUnavailable: 1,
+		Submissions:        4,
+	})
+
+	status := readJSON[main.ArtistStatus](t, filepath.Join(tempdir, accountArtist, "status.json"))
+	assert.Equal(t, status.Status, main.AccountNotFound)
+	assert.Equal(t, status.Message, "This user cannot be found.")
+	status = readJSON[main.ArtistStatus](t, filepath.Join(tempdir, "artist-with-two-submissions", "status.json"))
+	assert.Equal(t, status.Status, main.AccountActive)
+
+	// It isn't a failure
+	_, err = os.Stat(filepath.Join(tempdir, "failures.json"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,401 @@
+package main
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// Name of the artist alias map in the output directory.
+	aliasesFilename = "aliases.json"
+
+	// How many redirects to follow before giving up, as http.Client does by
+	// default.
+	maxRedirects = 10
+
+	// How many regex capture groups artistPathRegexp should have.
+	artistPathRegexpCaptures = 2
+)
+
+var (
+	ErrArtistRenamed    = errors.New("artist renamed")
+	ErrTooManyRedirects = errors.New("too many redirects")
+	ErrInvalidAlias     = errors.New("invalid artist alias")
+
+	// Files in an artist's directory which describe the artist rather than
+	// hold anything downloaded.  When merging, the new directory's copy wins.
+	artistStateFilenames = []string{artistStatusFilename, unwatchedMarkerFilename, foldersFilename}
+
+	// Regex matching the pages which belong to an artist, capturing their
+	// username.
+	artistPathRegexp = regexp.MustCompile(`^/(?:gallery|scraps|journals|user|favorites)/([^/]+)`)
+)
+
+// ArtistRenamedError is returned when FA redirects one of an artist's pages
+// to another artist's.  That's what happens when an artist changes their
+// username.
+type ArtistRenamedError struct {
+	OldName string // The username we asked for
+	NewName string // The username FA redirected to
+	URL     string // Where FA redirected to
+}
+
+// Error implements the error interface.
+//
+// Returns:
+//   - string: The error message
+func (e *ArtistRenamedError) Error() string {
+	return fmt.Sprintf("%s: %s is now %s at %s", ErrArtistRenamed, e.OldName, e.NewName, e.URL)
+}
+
+// Unwrap returns ErrArtistRenamed, so callers can use errors.Is.
+//
+// Returns:
+//   - error: ErrArtistRenamed
+func (e *ArtistRenamedError) Unwrap() error {
+	return ErrArtistRenamed
+}
+
+// checkArtistRedirect is the http.Client CheckRedirect policy.  Redirects are
+// followed as usual, except from one artist's page to a different artist's.
+// Following those silently would save a renamed artist's submissions under
+// their old name, so they're stopped and reported as an ArtistRenamedError.
+//
+// Parameters:
+//   - req: The request about to be made
+//   - via: The requests made so far, oldest first
+//
+// Returns:
+//   - error: An *ArtistRenamedError, ErrTooManyRedirects, or nil to follow the
+//     redirect
+func checkArtistRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("%w: stopped after %d", ErrTooManyRedirects, maxRedirects)
+	}
+
+	oldName := artistFromPath(via[0].URL.Path)
+	newName := artistFromPath(req.URL.Path)
+	if oldName != "" && newName != "" && !strings.EqualFold(oldName, newName) {
+		return &ArtistRenamedError{
+			OldName: oldName,
+			NewName: newName,
+			URL:     req.URL.String(),
+		}
+	}
+	return nil
+}
+
+// artistFromPath extracts the username from the path of an artist's page.
+//
+// Parameters:
+//   - path: The URL path, e.g. /gallery/someone/2
+//
+// Returns:
+//   - string: The lowercased username, or empty if the page isn't an artist's
+func artistFromPath(path string) string {
+	matches := artistPathRegexp.FindStringSubmatch(path)
+	if len(matches) != artistPathRegexpCaptures {
+		return ""
+	}
+	return strings.ToLower(matches[1])
+}
+
+// ArtistAlias records that an artist's old username now belongs to a new one.
+type ArtistAlias struct {
+	NewName    string    `json:"new_name"`
+	DetectedAt time.Time `json:"detected_at"`
+	URL        string    `json:"url,omitempty"` // The redirect which revealed it, unset if added by hand
+}
+
+// ArtistAliases is the alias map saved as aliases.json in the output
+// directory, keyed by old username.  furtrap records an alias whenever FA
+// redirects a renamed artist, and crawls the new name from then on.
+type ArtistAliases struct {
+	outputDir string
+	aliases   map[string]ArtistAlias
+}
+
+// OpenArtistAliases loads the alias map from the output directory.  A missing
+// map is treated as empty.
+//
+// Parameters:
+//   - outputDir: The root of the output tree
+//
+// Returns:
+//   - *ArtistAliases: The loaded aliases
+//   - error: Any error reading or parsing the map
+func OpenArtistAliases(outputDir string) (*ArtistAliases, error) {
+	aliases := &ArtistAliases{
+		outputDir: outputDir,
+		aliases:   make(map[string]ArtistAlias),
+	}
+
+	_, err := readJSONFile(aliases.Path(), &aliases.aliases)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load artist aliases: %w", err)
+	}
+	return aliases, nil
+}
+
+// Path returns the path of the alias map.
+//
+// Returns:
+//   - string: The path of aliases.json
+func (a *ArtistAliases) Path() string {
+	return filepath.Join(a.outputDir, aliasesFilename)
+}
+
+// Aliases returns a copy of the alias map.
+//
+// Returns:
+//   - map[string]ArtistAlias: The aliases, keyed by old username
+func (a *ArtistAliases) Aliases() map[string]ArtistAlias {
+	aliases := make(map[string]ArtistAlias, len(a.aliases))
+	for oldName, alias := range a.aliases {
+		aliases[oldName] = alias
+	}
+	return aliases
+}
+
+// Record adds an alias and saves the map.
+//
+// Parameters:
+//   - oldName: The artist's old username
+//   - alias: Their new username, and how we found out
+//
+// Returns:
+//   - error: ErrInvalidAlias if the alias would make a loop, or any error
+//     writing the map
+func (a *ArtistAliases) Record(oldName string, alias ArtistAlias) error {
+	oldName = strings.ToLower(oldName)
+	alias.NewName = strings.ToLower(alias.NewName)
+	if a.Resolve(alias.NewName) == oldName {
+		return fmt.Errorf("%w: %s and %s are aliases of each other", ErrInvalidAlias, oldName, alias.NewName)
+	}
+	a.aliases[oldName] = alias
+
+	err := os.MkdirAll(a.outputDir, submissionDirPermissions)
+	if err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	err = writeJSONFileAtomic(a.Path(), a.aliases)
+	if err != nil {
+		return fmt.Errorf("failed to write artist aliases: %w", err)
+	}
+	return nil
+}
+
+// Resolve returns an artist's current username, following any chain of
+// renames.
+//
+// Parameters:
+//   - name: A username, old or current
+//
+// Returns:
+//   - string: The current username, lowercased if it was an alias
+func (a *ArtistAliases) Resolve(name string) string {
+	seen := make(map[string]bool)
+	current := name
+	for {
+		alias, ok := a.aliases[strings.ToLower(current)]
+		if !ok || seen[alias.NewName] {
+			return current
+		}
+		seen[alias.NewName] = true
+		current = alias.NewName
+	}
+}
+
+// MergeResult summarizes a MergeArtistDirs run.
+type MergeResult struct {
+	Moved      int      // Files moved into the new artist's directory
+	Duplicates int      // Files the new directory already had, removed from the old one
+	Superseded int      // Old state files, like status.json, replaced by the new directory's
+	Conflicts  []string // Files which differ from the new directory's copy, left in place
+}
+
+// MergeArtistDirs moves everything from each renamed artist's old directory
+// into their new one, so an artist who changed their name has one directory.
+// Nothing is downloaded.  A file the new directory already has an identical
+// copy of is removed from the old directory, as are state files like
+// status.json which the new directory has its own, more recent, copy of.  Any
+// other file which differs is left where it is and reported.  Old directories
+// left empty are removed.  The archive index is rebuilt afterwards, since the
+// submissions' paths have changed.
+//
+// Parameters:
+//   - logger: Logger instance
+//   - outputDir: The root of the output tree
+//   - aliases: The alias map
+//
+// Returns:
+//   - MergeResult: Counts of moved and duplicate files, and the conflicts
+//   - error: Any error moving files or rebuilding the index
+func MergeArtistDirs(logger *slog.Logger, outputDir string, aliases *ArtistAliases) (MergeResult, error) {
+	var result MergeResult
+	merged := false
+
+	for oldName := range aliases.Aliases() {
+		newName := aliases.Resolve(oldName)
+		oldDir := filepath.Join(outputDir, oldName)
+		newDir := filepath.Join(outputDir, newName)
+		_, err := os.Stat(oldDir)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			continue
+		case err != nil:
+			return result, fmt.Errorf("failed to stat artist directory: %w", err)
+		}
+
+		logger.Info("Merging renamed artist", "old", oldName, "new", newName)
+		err = mergeDir(oldDir, newDir, &result)
+		if err != nil {
+			return result, err
+		}
+		err = removeEmptyDirs(oldDir)
+		if err != nil {
+			return result, err
+		}
+		merged = true
+	}
+
+	if merged {
+		_, err := RebuildArchiveIndex(logger, outputDir)
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// mergeDir moves the files under oldDir to the same place under newDir.
+//
+// Parameters:
+//   - oldDir: The directory to move files from
+//   - newDir: The directory to move them to
+//   - result: Updated with what was done
+//
+// Returns:
+//   - error: Any error walking the directory or moving files
+func mergeDir(oldDir string, newDir string, result *MergeResult) error {
+	return filepath.WalkDir(oldDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(oldDir, path)
+		if err != nil {
+			return fmt.Errorf("failed to find relative path: %w", err)
+		}
+		target := filepath.Join(newDir, rel)
+
+		_, err = os.Stat(target)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			err = os.MkdirAll(filepath.Dir(target), submissionDirPermissions)
+			if err != nil {
+				return fmt.Errorf("failed to create directory: %w", err)
+			}
+			err = os.Rename(path, target)
+			if err != nil {
+				return fmt.Errorf("failed to move file: %w", err)
+			}
+			result.Moved++
+			return nil
+		case err != nil:
+			return fmt.Errorf("failed to stat file: %w", err)
+		}
+
+		if slices.Contains(artistStateFilenames, rel) {
+			err = os.Remove(path)
+			if err != nil {
+				return fmt.Errorf("failed to remove superseded file: %w", err)
+			}
+			result.Superseded++
+			return nil
+		}
+
+		same, err := sameFileContents(path, target)
+		if err != nil {
+			return err
+		}
+		if !same {
+			result.Conflicts = append(result.Conflicts, path)
+			return nil
+		}
+		err = os.Remove(path)
+		if err != nil {
+			return fmt.Errorf("failed to remove duplicate file: %w", err)
+		}
+		result.Duplicates++
+		return nil
+	})
+}
+
+// sameFileContents reports whether two files have the same contents.
+//
+// Parameters:
+//   - a: The first file
+//   - b: The second file
+//
+// Returns:
+//   - bool: true if the contents are identical
+//   - error: Any error reading the files
+func sameFileContents(a string, b string) (bool, error) {
+	aSize, aHash, err := hashFile(a)
+	if err != nil {
+		return false, fmt.Errorf("failed to read file: %w", err)
+	}
+	bSize, bHash, err := hashFile(b)
+	if err != nil {
+		return false, fmt.Errorf("failed to read file: %w", err)
+	}
+	return aSize == bSize && aHash == bHash, nil
+}
+
+// removeEmptyDirs removes a directory and its subdirectories, deepest first,
+// as long as they're empty.  Directories with anything left in them are kept.
+//
+// Parameters:
+//   - dir: The directory to clean up
+//
+// Returns:
+//   - error: Any error reading or removing directories
+func removeEmptyDirs(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read directory: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			err = removeEmptyDirs(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	entries, err = os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read directory: %w", err)
+	}
+	if len(entries) > 0 {
+		return nil
+	}
+	err = os.Remove(dir)
+	if err != nil {
+		return fmt.Errorf("failed to remove empty directory: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package main_test
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"errors"
+	main "furtrap"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+const (
+	renamedOldName = "old-name"
+	renamedNewName = "artist-with-two-submissions"
+)
+
+func TestHTTPClient_ArtistRedirect(t *testing.T) {
+	requests := 0
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/gallery/old-name/1":
+			http.Redirect(w, r, "/gallery/new-name/1", http.StatusMovedPermanently)
+		case "/gallery/Mixed-Case/1":
+			http.Redirect(w, r, "/gallery/mixed-case/1", http.StatusMovedPermanently)
+		case "/view/101":
+			http.Redirect(w, r, "/view/101/", http.StatusMovedPermanently)
+		default:
+			_, _ = w.Write([]byte("ok"))
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+	client := main.NewHTTPClient(NewTestLogger(t))
+	client.SetRetryPolicy(main.RetryPolicy{MaxAttempts: 3})
+
+	t.Run("redirect to another artist is reported", func(t *testing.T) {
+		requests = 0
+		_, err := client.Get(t.Context(), server.URL+"/gallery/old-name/1")
+		assert.ErrorIs(t, err, main.ErrArtistRenamed)
+		var renamedErr *main.ArtistRenamedError
+		assert.Assert(t, errors.As(err, &renamedErr))
+		assert.Equal(t, renamedErr.OldName, "old-name")
+		assert.Equal(t, renamedErr.NewName, "new-name")
+		assert.Equal(t, renamedErr.URL, server.URL+"/gallery/new-name/1")
+
+		// Not retried
+		assert.Equal(t, requests, 1)
+	})
+
+	t.Run("other redirects are followed", func(t *testing.T) {
+		have, err := client.Get(t.Context(), server.URL+"/gallery/Mixed-Case/1")
+		assert.NilError(t, err)
+		assert.Equal(t, string(have), "ok")
+
+		have, err = client.Get(t.Context(), server.URL+"/view/101")
+		assert.NilError(t, err)
+		assert.Equal(t, string(have), "ok")
+	})
+}
+
+func TestArtistAliases(t *testing.T) {
+	tempdir := t.TempDir()
+	aliases, err := main.OpenArtistAliases(tempdir)
+	assert.NilError(t, err)
+	assert.Equal(t, aliases.Resolve("someone"), "someone")
+
+	err = aliases.Record("First", main.ArtistAlias{NewName: "second"})
+	assert.NilError(t, err)
+	err = aliases.Record("second", main.ArtistAlias{NewName: "third"})
+	assert.NilError(t, err)
+	assert.Equal(t, aliases.Resolve("first"), "third")
+	assert.Equal(t, aliases.Resolve("FIRST"), "third")
+
+	err = aliases.Record("third", main.ArtistAlias{NewName: "first"})
+	assert.ErrorIs(t, err, main.ErrInvalidAlias)
+
+	// Saved
+	aliases, err = main.OpenArtistAliases(tempdir)
+	assert.NilError(t, err)
+	assert.Equal(t, len(aliases.Aliases()), 2)
+	assert.Equal(t, aliases.Resolve("first"), "third")
+}
+
+func TestScraper_RenamedArtist(t *testing.T) {
+	tempdir := t.TempDir()
+	client := NewTestClient()
+	client.SetResponse("https://www.furaffinity.net/gallery/"+renamedOldName+"/1", nil, &main.ArtistRenamedError{
+		OldName: renamedOldName,
+		NewName: renamedNewName,
+		URL:     "https://www.furaffinity.net/gallery/" + renamedNewName + "/1",
+	})
+	fullRun := main.RunSummary{
+		ArtistsTotal:     1,
+		ArtistsCompleted: 1,
+		Submissions:      4,
+	}
+
+	scraper := main.NewScraper(NewTestLogger(t), client, "", []string{renamedOldName}, false, false, tempdir)
+	err := scraper.Run(t.Context())
+	assert.NilError(t, err)
+	assert.DeepEqual(t, scraper.Summary(), fullRun)
+
+	aliases, err := main.OpenArtistAliases(tempdir)
+	assert.NilError(t, err)
+	assert.Equal(t, aliases.Resolve(renamedOldName), renamedNewName)
+	_, err = os.Stat(filepath.Join(tempdir, renamedNewName, "status.json"))
+	assert.NilError(t, err)
+
+	// The next run goes straight to the new name, without the redirect.
+	scraper = main.NewScraper(NewTestLogger(t), NewTestClient(), "", []string{renamedOldName}, false, false, tempdir)
+	err = scraper.Run(t.Context())
+	assert.NilError(t, err)
+	assert.DeepEqual(t, scraper.Summary(), main.RunSummary{ArtistsTotal: 1, ArtistsCompleted: 1})
+}
+
+func TestMergeArtistDirs(t *testing.T) {
+	tempdir := t.TempDir()
+	oldDir := filepath.Join(tempdir, renamedOldName)
+	newDir := filepath.Join(tempdir, renamedNewName)
+	writeFile := func(path string, content string) {
+		t.Helper()
+		assert.NilError(t, os.MkdirAll(filepath.Dir(path), 0750))
+		assert.NilError(t, os.WriteFile(path, []byte(content), 0600))
+	}
+
+	// A submission only the old directory has
+	copySampleViewPage(t, "104", filepath.Join(oldDir, "scraps"), "scrap-2.png.104.html")
+	writeFile(filepath.Join(oldDir, "scraps", "scrap-2.png"), "scrap")
+	// One both have
+	writeFile(filepath.Join(oldDir, "image-1.jpg"), "one")
+	writeFile(filepath.Join(newDir, "image-1.jpg"), "one")
+	// The artist's status, which the new directory has more recently
+	writeFile(filepath.Join(oldDir, "status.json"), `{"status":"not_found"}`)
+	writeFile(filepath.Join(newDir, "status.json"), `{"status":"active"}`)
+
+	aliases, err := main.OpenArtistAliases(tempdir)
+	assert.NilError(t, err)
+	err = aliases.Record(renamedOldName, main.ArtistAlias{NewName: renamedNewName, DetectedAt: time.Now()})
+	assert.NilError(t, err)
+
+	t.Run("conflicting files are left in place", func(t *testing.T) {
+		writeFile(filepath.Join(oldDir, "notes.txt"), "old notes")
+		writeFile(filepath.Join(newDir, "notes.txt"), "new notes")
+
+		result, err := main.MergeArtistDirs(NewTestLogger(t), tempdir, aliases)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, result, main.MergeResult{
+			Moved:      2,
+			Duplicates: 1,
+			Superseded: 1,
+			Conflicts:  []string{filepath.Join(oldDir, "notes.txt")},
+		})
+
+		// Moved, and in the rebuilt index
+		_, err = os.Stat(filepath.Join(newDir, "scraps", "scrap-2.png.104.html"))
+		assert.NilError(t, err)
+		index, err := main.OpenArchiveIndex(NewTestLogger(t), tempdir)
+		assert.NilError(t, err)
+		assert.Assert(t, index.Contains(filepath.Join(newDir, "scraps"), 104))
+
+		//#nosec G304: path is from test data
+		data, err := os.ReadFile(filepath.Join(newDir, "status.json"))
+		assert.NilError(t, err)
+		assert.Equal(t, string(data), `{"status":"active"}`)
+
+		entries, err := os.ReadDir(oldDir)
+		assert.NilError(t, err)
+		assert.Equal(t, len(entries), 1)
+	})
+
+	t.Run("empty old directory is removed", func(t *testing.T) {
+		assert.NilError(t, os.Remove(filepath.Join(oldDir, "notes.txt")))
+
+		result, err := main.MergeArtistDirs(NewTestLogger(t), tempdir, aliases)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, result, main.MergeResult{})
+		_, err = os.Stat(oldDir)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
@@ -4,6 +4,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"log/slog"
 	"path/filepath"
@@ -41,10 +42,12 @@ var (
 // Artist represents a FurAffinity artist and provides methods for retrieving
 // their submissions from both gallery and scraps sections.
 type Artist struct {
-	logger    *slog.Logger
-	client    Client
-	username  string
-	artistDir string
+	logger       *slog.Logger
+	client       Client
+	username     string
+	artistDir    string
+	index        *ArchiveIndex
+	folderFilter []string
 }
 
 // NewArtist creates a new Artist instance with the specified logger, client,
@@ -67,6 +70,15 @@ func NewArtist(logger *slog.Logger, client Client, artistUsername string, artist
 	}
 }
 
+// SetIndex attaches an archive index, which is passed along to every
+// submission this artist creates.
+//
+// Parameters:
+//   - index: The archive index for the output directory
+func (a *Artist) SetIndex(index *ArchiveIndex) {
+	a.index = index
+}
+
 // Username returns the FurAffinity username of this artist.
 //
 // Returns:
@@ -75,6 +87,22 @@ func (a *Artist) Username() string {
 	return a.username
 }
 
+// Dir returns the directory this artist's submissions are saved in.
+//
+// Returns:
+//   - string: The artist directory
+func (a *Artist) Dir() string {
+	return a.artistDir
+}
+
+// URL returns the address of this artist's gallery.
+//
+// Returns:
+//   - string: The gallery URL
+func (a *Artist) URL() string {
+	return fmt.Sprintf("https://www.furaffinity.net/gallery/%s/", a.username)
+}
+
 // Submissions retrieves the list of submissions for the artist from their
 // gallery and optionally from their scraps section. The crawling behavior can
 // be controlled with the reCrawl parameter to either stop at already-saved
@@ -82,23 +110,25 @@ func (a *Artist) Username() string {
 // may not have been previously downloaded.
 //
 // Parameters:
+//   - ctx: Context for cancellation
 //   - reCrawl: If false, stops crawling when encountering an already-saved submission;
 //     if true, crawls through all submissions regardless of save status
 //   - skipScraps: If false, also retrieves submissions from the artist's scraps section
 //
 // Returns:
 //   - []*Submission: A slice of all found submissions, with scraps appended after gallery items
-//   - error: An error if the submissions could not be retrieved
-func (a *Artist) Submissions(reCrawl bool, skipScraps bool) ([]*Submission, error) {
+//   - error: An error if the submissions could not be retrieved, or an
+//     *AccountUnavailableError if FA shows a system message instead
+func (a *Artist) Submissions(ctx context.Context, reCrawl bool, skipScraps bool) ([]*Submission, error) {
 	a.logger.Debug("getting submissions for artist", "username", a.username, "reCrawl", reCrawl)
-	submissions, err := a.crawlSubmissions(reCrawl, false)
+	submissions, err := a.crawlSubmissions(ctx, reCrawl, false)
 	if err != nil {
 		return nil, err
 	}
 
 	if !skipScraps {
 		a.logger.Debug("getting scraps for artist", "username", a.username, "reCrawl", reCrawl)
-		scraps, err := a.crawlSubmissions(reCrawl, true)
+		scraps, err := a.crawlSubmissions(ctx, reCrawl, true)
 		if err != nil {
 			return nil, err
 		}
@@ -112,13 +142,14 @@ func (a *Artist) Submissions(reCrawl bool, skipScraps bool) ([]*Submission, erro
 // the pagination logic for crawling either gallery or scraps submissions.
 //
 // Parameters:
+//   - ctx: Context for cancellation
 //   - reCrawl: If false, stops when encountering already-saved submissions
 //   - scraps: If true, crawls the scraps section; if false, crawls the main gallery
 //
 // Returns:
 //   - []*Submission: A slice of submissions found, in reverse chronological order
 //   - error: An error if the submissions could not be retrieved
-func (a *Artist) crawlSubmissions(reCrawl bool, scraps bool) ([]*Submission, error) {
+func (a *Artist) crawlSubmissions(ctx context.Context, reCrawl bool, scraps bool) ([]*Submission, error) {
 	var galleryOrScraps string
 	var submissionDir string
 	if scraps {
@@ -130,24 +161,38 @@ func (a *Artist) crawlSubmissions(reCrawl bool, scraps bool) ([]*Submission, err
 	}
 
 	var submissions []*Submission
+	var url string
+	var body []byte
 
 	for pageNum := 1; ; pageNum++ {
 		// Sanity check to prevent infinite loops
 		if pageNum > maxGalleryPages {
 			a.logger.Error("maximum gallery pages exceeded", "user", a.username, "maxPages", maxGalleryPages)
-			fatalInvariant("maximum gallery pages exceeded")
+			return nil, newSiteLayoutError(url, body,
+				fmt.Sprintf("maximum gallery pages (%d) exceeded", maxGalleryPages), "")
 		}
 
-		url := fmt.Sprintf("https://www.furaffinity.net/%s/%s/%d",
+		url = fmt.Sprintf("https://www.furaffinity.net/%s/%s/%d",
 			galleryOrScraps, a.username, pageNum)
 
-		body, err := a.client.GetWithDelay(url)
+		var err error
+		body, err = a.client.GetWithDelay(ctx, url)
 		if err != nil {
 			a.logger.Error("submissions: page fetch error", "url", url, "error", err)
 			return nil, fmt.Errorf("failed to fetch gallery page: %w", err)
 		}
 
-		pageSubmissions, stopCrawling := a.parseSubmissionsFromPage(body, submissionDir, reCrawl)
+		// A disabled or deleted account has no submissions either, so this
+		// has to be checked before concluding there's nothing new.
+		err = checkAccountStatus(a.username, url, body)
+		if err != nil {
+			return nil, err
+		}
+
+		pageSubmissions, stopCrawling, err := a.parseSubmissionsFromPage(url, body, submissionDir, reCrawl)
+		if err != nil {
+			return nil, err
+		}
 		submissions = append(submissions, pageSubmissions...)
 
 		a.logger.Debug("listing "+galleryOrScraps,
@@ -170,6 +215,7 @@ func (a *Artist) crawlSubmissions(reCrawl bool, scraps bool) ([]*Submission, err
 // This is used internally by crawlSubmissions.
 //
 // Parameters:
+//   - url: The URL of the page, for error reporting
 //   - body: The HTML content of the page
 //   - submissionDir: The directory where submissions are saved
 //   - reCrawl: If false, stops when encountering already-saved submissions
@@ -177,9 +223,13 @@ func (a *Artist) crawlSubmissions(reCrawl bool, scraps bool) ([]*Submission, err
 // Returns:
 //   - []*Submission: A slice of submissions found on this page
 //   - bool: True if crawling should stop (an already-saved submission was found)
-func (a *Artist) parseSubmissionsFromPage(body []byte, submissionDir string, reCrawl bool) ([]*Submission, bool) {
+//   - error: A *SiteLayoutError if the page isn't in the expected format
+func (a *Artist) parseSubmissionsFromPage(
+	url string, body []byte, submissionDir string, reCrawl bool,
+) ([]*Submission, bool, error) {
 	stopCrawling := false
 	var pageSubmissions []*Submission
+	var layoutErr error
 	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
 	if err != nil {
 		a.logger.Error("submissions: failed to parse HTML", "error", err)
@@ -204,9 +254,12 @@ func (a *Artist) parseSubmissionsFromPage(body []byte, submissionDir string, reC
 			// The only way this happens is if the /view/ link has a non-numeric
 			// ID, which breaks our basic assumptions about submission URLs.
 			// The site must have changed in a way we can't handle.
-			fatalInvariant(fmt.Sprintf("Unable to extract id from %s: %v", href, err))
+			a.logger.Error("submissions: unable to extract id", "url", url, "href", href, "error", err)
+			layoutErr = newSiteLayoutError(url, body, "non-numeric submission ID", href)
+			return false
 		}
 		submission := NewSubmission(a.logger, a.client, id, submissionDir)
+		submission.SetIndex(a.index)
 		if !reCrawl && submission.IsSaved() {
 			a.logger.Debug("submission already saved, stopping crawl",
 				"user", a.username,
@@ -217,14 +270,118 @@ func (a *Artist) parseSubmissionsFromPage(body []byte, submissionDir string, reC
 		pageSubmissions = append(pageSubmissions, submission)
 		return true // Continue iterating
 	})
+	if layoutErr != nil {
+		return nil, false, layoutErr
+	}
+
+	return pageSubmissions, stopCrawling, nil
+}
+
+// Journals retrieves the artist's journals.  Like Submissions, unless reCrawl
+// is set this stops at the first journal which has already been saved.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - reCrawl: If true, crawls through all journals regardless of save status
+//
+// Returns:
+//   - []*Journal: The journals found, oldest first
+//   - error: An error if the journals could not be retrieved, or a
+//     *SiteLayoutError if the pages aren't in the expected format
+func (a *Artist) Journals(ctx context.Context, reCrawl bool) ([]*Journal, error) {
+	a.logger.Debug("getting journals for artist", "username", a.username, "reCrawl", reCrawl)
+	journalDir := filepath.Join(a.artistDir, journalsDirname)
+
+	listing := &listingCrawl[*Journal]{
+		name:     "journals",
+		firstURL: a.journalsURL(1),
+		logArgs:  []any{"user", a.username},
+		fetchPage: func(ctx context.Context, url string, _ int) ([]byte, error) {
+			return a.client.GetWithDelay(ctx, url)
+		},
+		nextPage: func(url string, body []byte, pageNum int) ([]*Journal, string, error) {
+			ids, err := parseJournalsFromPage(url, body)
+			if err != nil || len(ids) == 0 {
+				return nil, "", err
+			}
+			journals := make([]*Journal, 0, len(ids))
+			for _, id := range ids {
+				journals = append(journals, NewJournal(a.logger, a.client, id, journalDir))
+			}
+			return journals, a.journalsURL(pageNum + 1), nil
+		},
+		isKnown:     func(journal *Journal) bool { return journal.IsSaved() },
+		stopAtKnown: true,
+	}
+	journals, err := listing.crawl(ctx, a.logger, reCrawl)
+	if err != nil {
+		return nil, err
+	}
+	// Oldest first, so an interrupted run doesn't leave a gap behind the
+	// newest saved journal.
+	slices.Reverse(journals)
+	return journals, nil
+}
 
-	return pageSubmissions, stopCrawling
+// journalsURL returns the address of a page of the artist's journals.
+//
+// Parameters:
+//   - pageNum: The page number, starting from 1
+//
+// Returns:
+//   - string: The journals page URL
+func (a *Artist) journalsURL(pageNum int) string {
+	return fmt.Sprintf("https://www.furaffinity.net/journals/%s/%d", a.username, pageNum)
+}
+
+// parseJournalsFromPage extracts journal IDs from a journals listing page.
+// Each journal is linked several times (title, "read more", comments), so
+// the IDs are deduplicated.
+//
+// Parameters:
+//   - url: The URL of the page, for error reporting
+//   - body: The HTML content of the page
+//
+// Returns:
+//   - []uint64: The journal IDs on this page, newest first
+//   - error: A *SiteLayoutError if the page isn't in the expected format
+func parseJournalsFromPage(url string, body []byte) ([]uint64, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		// As in parseSubmissionsFromPage, this can't happen with an in-memory
+		// byte slice.
+		fatalInvariant(err)
+	}
+
+	seen := make(map[uint64]bool)
+	var ids []uint64
+	var layoutErr error
+	doc.Find("a[href^='/journal/']").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		href, _ := s.Attr("href")
+		path, _, _ := strings.Cut(href, "#")
+		substr := strings.TrimPrefix(strings.TrimSuffix(path, "/"), "/journal/")
+		id, err := strconv.ParseUint(substr, 10, 64)
+		if err != nil {
+			layoutErr = newSiteLayoutError(url, body, "non-numeric journal ID", href)
+			return false
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+		return true
+	})
+	if layoutErr != nil {
+		return nil, layoutErr
+	}
+	return ids, nil
 }
 
 // GetArtistsFromWatchlist creates Artist instances for all artists found in
 // the specified user's watchlist
 //
 // Parameters:
+//   - ctx: Context for cancellation
 //   - logger: Logger instance
 //   - client: HTTP client interface for making web requests
 //   - watcherUsername: The FurAffinity username whose watchlist should be processed
@@ -234,11 +391,11 @@ func (a *Artist) parseSubmissionsFromPage(body []byte, submissionDir string, reC
 //   - []*Artist: A slice of Artist instances, one for each artist in the watchlist
 //   - error: An error if the watchlist could not be retrieved
 func GetArtistsFromWatchlist(
-	logger *slog.Logger, client Client, watcherUsername string, targetDir string,
+	ctx context.Context, logger *slog.Logger, client Client, watcherUsername string, targetDir string,
 ) ([]*Artist, error) {
 	logger.Debug("GetArtistsFromWatchlist", "watcherUsername", watcherUsername, "targetDir", targetDir)
 
-	artistUsernames, err := GetWatchlist(logger, client, watcherUsername)
+	artistUsernames, err := GetWatchlist(ctx, logger, client, watcherUsername)
 	if err != nil {
 		return nil, err
 	}
@@ -255,40 +412,43 @@ func GetArtistsFromWatchlist(
 // GetWatchlist retrieves the list of usernames from a user's watchlist.
 //
 // Parameters:
+//   - ctx: Context for cancellation
 //   - logger: Logger instance
 //   - client: The Client interface used to fetch watchlist pages
 //   - username: The FA username whose watchlist should be retrieved
 //
 // Returns:
 //   - A slice of unique usernames from the watchlist, in order of first appearance
-//   - An error if the watchlist could not be retrieved
-//
-// Panics:
-//   - Maximum watchlist pages exceeded, indicating infinite loop
-func GetWatchlist(logger *slog.Logger, client Client, username string) ([]string, error) {
+//   - An error if the watchlist could not be retrieved, or a *SiteLayoutError if
+//     the watchlist never ends
+func GetWatchlist(ctx context.Context, logger *slog.Logger, client Client, username string) ([]string, error) {
 	logger.Debug("getWatchlist", "username", username)
 
 	// We could parse out the 'a' elements and only match against those, but
 	// this is good enough.
 	seen := make(map[string]bool)
 	var usernames []string
+	var url string
+	var body []byte
 
 	for pageNum := 1; ; pageNum++ {
 		// Sanity check to prevent infinite loops
 		if pageNum > maxWatchlistPages {
 			logger.Error("maximum watchlist pages exceeded", "user", username, "maxPages", maxWatchlistPages)
-			fatalInvariant("maximum watchlist pages exceeded")
+			return nil, newSiteLayoutError(url, body,
+				fmt.Sprintf("maximum watchlist pages (%d) exceeded", maxWatchlistPages), "")
 		}
 		newUsernames := 0 // Used to detect end of watchlist
 
-		url := fmt.Sprintf("https://www.furaffinity.net/watchlist/by/%s/%d", username, pageNum)
+		url = fmt.Sprintf("https://www.furaffinity.net/watchlist/by/%s/%d", username, pageNum)
 
 		// We can't use GetWithDelay here because watchlist pages don't
 		// contain the standard FurAffinity footer that our client uses
 		// to determine when to delay.  So we just use Get directly.
 		// This is fine because it's only a small number of pages, and
 		// GetWatchlist is only called once at the start of the program.
-		body, err := client.Get(url)
+		var err error
+		body, err = client.Get(ctx, url)
 		if err != nil {
 			logger.Error("getWatchlist: page fetch error", "url", url, "error", err)
 			return nil, fmt.Errorf("failed to fetch watchlist page: %w", err)
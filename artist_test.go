@@ -3,11 +3,13 @@ package main_test
 // SPDX-License-Identifier: GPL-3.0-only
 
 import (
+	"errors"
 	"fmt"
 	main "furtrap"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"gotest.tools/v3/assert"
@@ -20,7 +22,7 @@ func TestGetArtists(t *testing.T) {
 		// Aside from making sure it loads the list from all 4 pages, this also
 		// implicitly tests that page 5 is NOT loaded.  Page 5 would 404,
 		// causing an error to be returned.
-		got, err := main.GetArtistsFromWatchlist(NewTestLogger(t), client, "test-watcher", t.TempDir())
+		got, err := main.GetArtistsFromWatchlist(t.Context(), NewTestLogger(t), client, "test-watcher", t.TempDir())
 		assert.NilError(t, err)
 		assert.Equal(t, len(got), 601)
 		assert.Equal(t, got[0].Username(), "lorem")
@@ -32,7 +34,7 @@ func TestGetArtists(t *testing.T) {
 	})
 
 	t.Run("error when getting artists from invalid watchlist user", func(t *testing.T) {
-		_, err := main.GetArtistsFromWatchlist(NewTestLogger(t), client, "invalidusername", t.TempDir())
+		_, err := main.GetArtistsFromWatchlist(t.Context(), NewTestLogger(t), client, "invalidusername", t.TempDir())
 		assert.ErrorContains(t, err, "failed to fetch watchlist page")
 	})
 }
@@ -41,13 +43,13 @@ func TestGetWatchlist(t *testing.T) {
 	client := NewTestClient()
 
 	t.Run("Get watchlist", func(t *testing.T) {
-		got, err := main.GetWatchlist(NewTestLogger(t), client, "test-watcher")
+		got, err := main.GetWatchlist(t.Context(), NewTestLogger(t), client, "test-watcher")
 		assert.NilError(t, err)
 		assert.Equal(t, len(got), 601)
 		assert.DeepEqual(t, got[0:3], []string{"lorem", "ipsum", "dolor"})
 	})
 
-	t.Run("Panic when maximum watchlist pages exceeded", func(t *testing.T) {
+	t.Run("Layout error when maximum watchlist pages exceeded", func(t *testing.T) {
 		// This also implicitly tests that we stop at page 100 and do not try to
 		// load page 101, which would 404 and return a different error.
 		client := NewTestClient()
@@ -64,12 +66,14 @@ func TestGetWatchlist(t *testing.T) {
 		// Discard logs to avoid clutter
 		logger := slog.New(slog.DiscardHandler)
 
-		got := CapturePanic(t, func() {
-			_, err := main.GetWatchlist(logger, client, "infinite-watcher")
-			assert.NilError(t, err)
-		})
+		_, err := main.GetWatchlist(t.Context(), logger, client, "infinite-watcher")
+		assert.ErrorIs(t, err, main.ErrSiteLayoutChanged)
+		assert.ErrorContains(t, err, "maximum watchlist pages (100) exceeded")
 
-		assert.Equal(t, fmt.Sprint(got), "maximum watchlist pages exceeded")
+		var layoutErr *main.SiteLayoutError
+		assert.Assert(t, errors.As(err, &layoutErr))
+		assert.Equal(t, layoutErr.URL, "https://www.furaffinity.net/watchlist/by/infinite-watcher/100")
+		assert.Assert(t, len(layoutErr.Page) > 0)
 	})
 }
 
@@ -77,7 +81,7 @@ func TestSubmissions(t *testing.T) {
 	client := NewTestClient()
 	t.Run("Get all submissions", func(t *testing.T) {
 		artist := main.NewArtist(NewTestLogger(t), client, "test-artist", t.TempDir())
-		submissions, err := artist.Submissions(false, true)
+		submissions, err := artist.Submissions(t.Context(), false, true)
 		assert.NilError(t, err)
 		assert.Equal(t, len(submissions), 56)
 		assert.Equal(t, submissions[0].ID(), uint64(244))
@@ -89,7 +93,7 @@ func TestSubmissions(t *testing.T) {
 
 	t.Run("Get submissions with synthetic data", func(t *testing.T) {
 		artist := main.NewArtist(NewTestLogger(t), client, "artist-with-two-submissions", t.TempDir())
-		submissions, err := artist.Submissions(false, true)
+		submissions, err := artist.Submissions(t.Context(), false, true)
 		assert.NilError(t, err)
 		assert.Equal(t, len(submissions), 2)
 		assert.Equal(t, submissions[0].ID(), uint64(102))
@@ -98,7 +102,7 @@ func TestSubmissions(t *testing.T) {
 
 	t.Run("Get submissions and scraps with synthetic data", func(t *testing.T) {
 		artist := main.NewArtist(NewTestLogger(t), client, "artist-with-two-submissions", t.TempDir())
-		submissions, err := artist.Submissions(false, false)
+		submissions, err := artist.Submissions(t.Context(), false, false)
 		assert.NilError(t, err)
 		assert.Equal(t, len(submissions), 4)
 		assert.Equal(t, submissions[0].ID(), uint64(102))
@@ -132,7 +136,7 @@ func TestSubmissions(t *testing.T) {
 		artist := main.NewArtist(NewTestLogger(t), client, "testartist", artistDir)
 
 		t.Run("Stop crawling watchlist when we reach known submission", func(t *testing.T) {
-			submissions, err := artist.Submissions(false, true)
+			submissions, err := artist.Submissions(t.Context(), false, true)
 			assert.NilError(t, err)
 			assert.Equal(t, len(submissions), 1)
 			assert.Equal(t, submissions[0].ID(), uint64(103))
@@ -146,7 +150,7 @@ func TestSubmissions(t *testing.T) {
 		})
 
 		t.Run("ReCrawl gets all submissions including known ones", func(t *testing.T) {
-			submissions, err := artist.Submissions(true, true)
+			submissions, err := artist.Submissions(t.Context(), true, true)
 			assert.NilError(t, err)
 			assert.Equal(t, len(submissions), 3)
 			assert.Equal(t, submissions[0].ID(), uint64(55555))
@@ -155,7 +159,7 @@ func TestSubmissions(t *testing.T) {
 		})
 	})
 
-	t.Run("Panic when maximum gallery pages exceeded", func(t *testing.T) {
+	t.Run("Layout error when maximum gallery pages exceeded", func(t *testing.T) {
 		// This also implicitly tests that we stop at page 1000 and do not try
 		// to load page 1001, which would 404 and return a different error.
 		client := NewTestClient()
@@ -171,11 +175,25 @@ func TestSubmissions(t *testing.T) {
 		logger := slog.New(slog.DiscardHandler)
 		artist := main.NewArtist(logger, client, "infinite-artist", t.TempDir())
 
-		got := CapturePanic(t, func() {
-			_, err := artist.Submissions(false, true)
-			assert.NilError(t, err)
-		})
+		_, err := artist.Submissions(t.Context(), false, true)
+		assert.ErrorIs(t, err, main.ErrSiteLayoutChanged)
+		assert.ErrorContains(t, err, "maximum gallery pages (1000) exceeded")
+	})
+
+	t.Run("Layout error on non-numeric submission ID", func(t *testing.T) {
+		client := NewTestClient()
+		client.SetResponse("https://www.furaffinity.net/gallery/weird-artist/1",
+			[]byte(`<a href="/view/101"> <img> </a> <a href="/view/abc123/"> <img> </a>`),
+			nil)
+
+		artist := main.NewArtist(NewTestLogger(t), client, "weird-artist", t.TempDir())
+		_, err := artist.Submissions(t.Context(), false, true)
+		assert.ErrorIs(t, err, main.ErrSiteLayoutChanged)
 
-		assert.Equal(t, fmt.Sprint(got), "maximum gallery pages exceeded")
+		var layoutErr *main.SiteLayoutError
+		assert.Assert(t, errors.As(err, &layoutErr))
+		assert.Equal(t, layoutErr.URL, "https://www.furaffinity.net/gallery/weird-artist/1")
+		assert.Equal(t, layoutErr.Snippet, "/view/abc123/")
+		assert.Assert(t, strings.Contains(string(layoutErr.Page), "abc123"))
 	})
 }
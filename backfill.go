@@ -0,0 +1,142 @@
+package main
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+const (
+	// How many regex capture groups savedMarkerRegexp should have.
+	savedMarkerRegexpCaptures = 3
+)
+
+var (
+	// Regex matching the HTML marker written by saveSubmissionFiles:
+	// "<original_filename>.<submission_id>.html".  This is the same set of
+	// files Submission.IsSaved globs for.
+	savedMarkerRegexp = regexp.MustCompile(`^(.+)\.(\d+)\.html$`)
+)
+
+// savedSubmission describes a submission found on disk by its HTML marker.
+type savedSubmission struct {
+	dir      string // Directory containing the submission
+	filename string // Original filename of the submission file
+	id       uint64 // FurAffinity submission ID
+}
+
+// markerPath returns the path of the HTML marker for this submission.
+//
+// Returns:
+//   - string: The path of the saved /view/ page
+func (s savedSubmission) markerPath() string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s.%d.html", s.filename, s.id))
+}
+
+// BackfillResult summarizes a BackfillMetadata run.
+type BackfillResult struct {
+	Written int      // Sidecars written
+	Skipped int      // Submissions which already had a sidecar
+	Failed  []string // Marker paths which could not be parsed
+}
+
+// walkSavedSubmissions walks the output tree and calls fn for every saved
+// submission HTML marker found.  Walking stops at the first error returned by
+// fn.
+//
+// Parameters:
+//   - outputDir: The root of the output tree
+//   - fn: Callback invoked for each saved submission
+//
+// Returns:
+//   - error: Any error encountered while walking, or returned by fn
+func walkSavedSubmissions(outputDir string, fn func(savedSubmission) error) error {
+	return filepath.WalkDir(outputDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		matches := savedMarkerRegexp.FindStringSubmatch(d.Name())
+		if len(matches) != savedMarkerRegexpCaptures {
+			return nil
+		}
+		id, err := strconv.ParseUint(matches[2], 10, 64)
+		if err != nil {
+			// Too many digits to be a real submission ID.  Not one of ours.
+			return nil //nolint:nilerr // not a marker, keep walking
+		}
+
+		return fn(savedSubmission{
+			dir:      filepath.Dir(path),
+			filename: matches[1],
+			id:       id,
+		})
+	})
+}
+
+// BackfillMetadata generates metadata JSON sidecars for submissions saved
+// before sidecars existed.  It works entirely offline from the saved /view/
+// pages.  Pages which can't be parsed are logged and reported in the result
+// rather than aborting the backfill.
+//
+// Parameters:
+//   - logger: Logger instance
+//   - outputDir: The root of the output tree to scan
+//   - force: If true, regenerate sidecars which already exist
+//
+// Returns:
+//   - BackfillResult: Counts of written and skipped sidecars, and failed pages
+//   - error: Any error encountered while walking the tree or writing sidecars
+func BackfillMetadata(logger *slog.Logger, outputDir string, force bool) (BackfillResult, error) {
+	var result BackfillResult
+
+	err := walkSavedSubmissions(outputDir, func(saved savedSubmission) error {
+		jsonPath := filepath.Join(saved.dir, metadataFilename(saved.filename, saved.id))
+		if !force {
+			_, err := os.Stat(jsonPath)
+			if err == nil {
+				result.Skipped++
+				return nil
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("failed to stat metadata: %w", err)
+			}
+		}
+
+		markerPath := saved.markerPath()
+		pageContent, err := os.ReadFile(markerPath) //#nosec G304: path is from walking the output dir
+		if err != nil {
+			return fmt.Errorf("failed to read saved page: %w", err)
+		}
+
+		metadata, err := parseSubmissionMetadata(pageContent, saved.id)
+		if err != nil {
+			logger.Warn("Failed to parse saved page", "file", markerPath, "error", err)
+			result.Failed = append(result.Failed, markerPath)
+			return nil
+		}
+
+		err = writeJSONFileAtomic(jsonPath, metadata)
+		if err != nil {
+			return fmt.Errorf("failed to save metadata: %w", err)
+		}
+		logger.Debug("Wrote metadata", "file", jsonPath)
+		result.Written++
+		return nil
+	})
+	if err != nil {
+		return result, fmt.Errorf("backfill failed: %w", err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,93 @@
+package main_test
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	main "furtrap"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// copySampleViewPage copies a sample /view/ page into dir as a saved HTML
+// marker, the way saveSubmissionFiles would have written it.
+func copySampleViewPage(t *testing.T, id string, dir string, markerName string) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("sample_data", "www.furaffinity.net", "view", id))
+	assert.NilError(t, err)
+	err = os.MkdirAll(dir, 0750)
+	assert.NilError(t, err)
+	err = os.WriteFile(filepath.Join(dir, markerName), data, 0600)
+	assert.NilError(t, err)
+}
+
+func TestBackfillMetadata(t *testing.T) {
+	outputDir := t.TempDir()
+	artistDir := filepath.Join(outputDir, "artist-with-two-submissions")
+	scrapsDir := filepath.Join(artistDir, "scraps")
+
+	copySampleViewPage(t, "102", artistDir, "image-2.png.102.html")
+	copySampleViewPage(t, "104", scrapsDir, "scrap-2.png.104.html")
+
+	// A page which isn't a submission at all
+	brokenMarker := filepath.Join(artistDir, "broken.png.999.html")
+	err := os.WriteFile(brokenMarker, []byte("<html><body>System error</body></html>"), 0600)
+	assert.NilError(t, err)
+
+	// Files which aren't HTML markers should be ignored
+	err = os.WriteFile(filepath.Join(artistDir, "image-2.png"), []byte("image"), 0600)
+	assert.NilError(t, err)
+	err = os.WriteFile(filepath.Join(artistDir, "notes.html"), []byte("notes"), 0600)
+	assert.NilError(t, err)
+
+	t.Run("writes sidecars and reports failures", func(t *testing.T) {
+		result, err := main.BackfillMetadata(NewTestLogger(t), outputDir, false)
+		assert.NilError(t, err)
+		assert.Equal(t, result.Written, 2)
+		assert.Equal(t, result.Skipped, 0)
+		assert.DeepEqual(t, result.Failed, []string{brokenMarker})
+
+		metadata := readJSON[main.SubmissionMetadata](t, filepath.Join(artistDir, "image-2.png.102.json"))
+		assert.Equal(t, metadata.ID, uint64(102))
+		assert.Equal(t, metadata.Title, "Test Submission 102")
+		assert.Equal(t, metadata.Rating, "Mature")
+
+		metadata = readJSON[main.SubmissionMetadata](t, filepath.Join(scrapsDir, "scrap-2.png.104.json"))
+		assert.Equal(t, metadata.ID, uint64(104))
+		assert.Equal(t, metadata.Category, "Artwork (Traditional)")
+	})
+
+	t.Run("skips existing sidecars", func(t *testing.T) {
+		jsonPath := filepath.Join(artistDir, "image-2.png.102.json")
+		err := os.WriteFile(jsonPath, []byte("{}"), 0600)
+		assert.NilError(t, err)
+
+		result, err := main.BackfillMetadata(NewTestLogger(t), outputDir, false)
+		assert.NilError(t, err)
+		assert.Equal(t, result.Written, 0)
+		assert.Equal(t, result.Skipped, 2)
+		assert.Equal(t, len(result.Failed), 1)
+
+		//#nosec G304: filename is from test data
+		data, err := os.ReadFile(jsonPath)
+		assert.NilError(t, err)
+		assert.Equal(t, string(data), "{}")
+	})
+
+	t.Run("force regenerates existing sidecars", func(t *testing.T) {
+		result, err := main.BackfillMetadata(NewTestLogger(t), outputDir, true)
+		assert.NilError(t, err)
+		assert.Equal(t, result.Written, 2)
+		assert.Equal(t, result.Skipped, 0)
+
+		metadata := readJSON[main.SubmissionMetadata](t, filepath.Join(artistDir, "image-2.png.102.json"))
+		assert.Equal(t, metadata.Title, "Test Submission 102")
+	})
+
+	t.Run("error on missing output directory", func(t *testing.T) {
+		_, err := main.BackfillMetadata(NewTestLogger(t), filepath.Join(outputDir, "nonexistent"), false)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
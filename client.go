@@ -3,7 +3,6 @@ package main
 // SPDX-License-Identifier: GPL-3.0-only
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"errors"
@@ -11,9 +10,7 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
-	"net/http/cookiejar"
 	"net/url"
-	"os"
 	"regexp"
 	"strconv"
 	"strings"
@@ -23,34 +20,17 @@ import (
 )
 
 const (
-	// Rate limiting constants.
-	highUserThreshold = 10000
-	highUserDelayTime = 5 * time.Minute
-	// Even during low traffic, we add a small delay to be kind to the server.
-	defaultDelayTime = 1 * time.Second
-
-	// HTTP client retry constants.
-	defaultRetryCount    = 3
-	defaultRetryInterval = 5 * time.Second
-
 	httpTimeout   = 90 * time.Second
 	httpUserAgent = "furtrap/2.0 (+https://github.com/keepiru/furtrap)"
 
 	// How many regex capture groups registeredUsersRegexp should have.
 	registeredUsersRegexpCaptures = 2
-
-	// Number of tab-separated fields in a Netscape/Mozilla cookies.txt file.
-	cookiesTxtFieldCount = 7
-
-	oneWeekDuration = 7 * 24 * time.Hour
 )
 
 var (
 	ErrRegisteredUsersNotFound = errors.New("could not find registered users count")
 	ErrHTTPStatusNotOK         = errors.New("HTTP request failed with non-200 status")
 	ErrHTTPNotFound            = errors.New("HTTP 404 Not Found")
-	ErrExpiredCookie           = errors.New("cookie is expiring, update your cookies.txt file")
-	ErrInvalidCookie           = errors.New("invalid cookie format")
 
 	// Regex to extract number of registered users online from FA HTML.
 	registeredUsersRegexp = regexp.MustCompile(`(\d+)\s+registered`)
@@ -59,18 +39,28 @@ var (
 // Client is an abstract HTTP client.  In prod, this wraps http.Client.  In
 // test, it is a TestClient mock.
 type Client interface {
-	Get(uri string) ([]byte, error)
-	GetWithDelay(uri string) ([]byte, error)
+	Get(ctx context.Context, uri string) ([]byte, error)
+	GetWithDelay(ctx context.Context, uri string) ([]byte, error)
+	PostWithDelay(ctx context.Context, uri string, form url.Values) ([]byte, error)
+	Download(ctx context.Context, uri string, filePath string) error
 }
 
 // HTTPClient is a concrete implementation of the Client interface which
 // performs GETs with retry logic and rate limiting.
 type HTTPClient struct {
-	logger        *slog.Logger
-	client        *http.Client
-	tryCount      int
-	retryInterval time.Duration
-	delayFunc     func(int)
+	logger             *slog.Logger
+	client             *http.Client
+	jar                *recordingJar
+	retryPolicy        RetryPolicy
+	throttlePolicy     ThrottlePolicy
+	throttled          time.Duration   // Time spent waiting on load, against the throttle budget
+	window             OperatingWindow // When requests may be made
+	cookiePolicy       CookiePolicy
+	cookieExpiry       map[string]CookieExpiry // Required cookies loaded by LoadCookies
+	cookieSavePath     string                  // Where to save the cookies, empty for nowhere
+	cookieSaveInterval time.Duration
+	cookiesSavedAt     time.Time
+	delayFunc          func(context.Context, int) error
 }
 
 // NewHTTPClient creates a new HTTPClient instance with default settings for
@@ -83,187 +73,278 @@ type HTTPClient struct {
 // Returns:
 //   - *HTTPClient: A new HTTPClient instance ready for use
 func NewHTTPClient(logger *slog.Logger) *HTTPClient {
-	delayFunc := func(registeredUsers int) {
-		if registeredUsers > highUserThreshold {
-			logger.Info("High registered user count detected, delaying 5 minutes", "count", registeredUsers)
-			time.Sleep(highUserDelayTime)
-		} else {
-			time.Sleep(defaultDelayTime)
-		}
-	}
-
-	jar, err := cookiejar.New(nil)
-	if err != nil {
-		// There are no conditions where cookiejar.New returns an error, ever,
-		// as of Go 1.24.  Just in case that changes in the future, we'll handle
-		// it here.  Fatal because we have no idea what the future error
-		// conditions are.
-		fatalInvariant(fmt.Errorf("failed to create cookie jar: %w", err))
-	}
+	jar := newRecordingJar()
 
 	client := &http.Client{
-		Jar: jar,
+		Jar:           jar,
+		CheckRedirect: checkArtistRedirect,
 	}
 
-	return &HTTPClient{
-		logger:        logger,
-		client:        client,
-		tryCount:      defaultRetryCount,
-		retryInterval: defaultRetryInterval,
-		delayFunc:     delayFunc,
+	h := &HTTPClient{
+		logger:         logger,
+		client:         client,
+		jar:            jar,
+		retryPolicy:    DefaultRetryPolicy(),
+		throttlePolicy: DefaultThrottlePolicy(),
+		cookiePolicy:   DefaultCookiePolicy(),
+		cookieExpiry:   make(map[string]CookieExpiry),
 	}
+	h.delayFunc = h.throttle
+	return h
 }
 
 // SetRetryPolicy configures the retry behavior for failed HTTP requests.  This
-// method is intended for integration testing where we don't actually want to
-// wait between retries.
+// is used in integration testing where we don't actually want to wait between
+// retries.
 //
 // Parameters:
-//   - count: Number of retry attempts before giving up
-//   - interval: Time to wait between retry attempts
-func (h *HTTPClient) SetRetryPolicy(count int, interval time.Duration) {
-	h.tryCount = count
-	h.retryInterval = interval
+//   - policy: The retry policy to use
+func (h *HTTPClient) SetRetryPolicy(policy RetryPolicy) {
+	h.retryPolicy = policy
 }
 
-// SetDelayFunc overrides the default delay function.  This is intended to
-// inject test spies during integration tests instead of sleeping.
+// SetDelayFunc overrides the default delay function, which follows the
+// throttle policy.  This is intended to inject test spies during integration
+// tests instead of sleeping.
 //
 // Parameters:
-//   - fn: Function that takes registered user count and implements delay logic
-func (h *HTTPClient) SetDelayFunc(fn func(int)) {
+//   - fn: Function that takes registered user count and implements delay
+//     logic.  It must return promptly with the context's error if the context
+//     is canceled.
+func (h *HTTPClient) SetDelayFunc(fn func(context.Context, int) error) {
 	h.delayFunc = fn
 }
 
-// LoadCookies loads cookies from a Netscape/Mozilla format cookies.txt file and
-// adds them to the client's cookie jar. This allows access to pages only
-// available to logged-in users.
-//
-// The method parses the "standard" cookies.txt format with tab-separated
-// fields: domain, flag, path, secure, expiration, name, value
+// GetWithDelay wraps Get with a ratelimiting function.  By default it adds a
+// very long delay if too many are online.  This is to comply with FA's
+// request: "Limit bot activity to periods with less than 10k registered users
+// online."  Even when fewer users are online, we'll still add a short delay to
+// be kind.  See ThrottlePolicy.
 //
 // Parameters:
-//   - filename: Path to the cookies.txt file to load
+//   - ctx: Context for cancellation of the request and delay
+//   - uri: The URL to fetch
 //
 // Returns:
-//   - error: Any error encountered while reading or parsing the cookies file
-func (h *HTTPClient) LoadCookies(filename string) error {
-	//#nosec G304: filename is intentionally from user input
-	file, err := os.Open(filename)
-	if err != nil {
-		return fmt.Errorf("failed to open cookies file: %w", err)
-	}
-	defer func() { _ = file.Close() }()
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		err := h.parseCookieLine(line)
-		if err != nil {
-			return fmt.Errorf("failed to load cookie: %w", err)
-		}
-	}
-
-	err = scanner.Err()
+//   - []byte: The response body content
+//   - error: Any error encountered during the request or delay logic
+func (h *HTTPClient) GetWithDelay(ctx context.Context, uri string) ([]byte, error) {
+	ret, err := h.Get(ctx, uri)
 	if err != nil {
-		return fmt.Errorf("error reading cookies file: %w", err)
+		return ret, err
 	}
-
-	h.logger.Info("Loaded cookies from file", "file", filename)
-	return nil
+	return h.delayAfter(ctx, ret)
 }
 
-// GetWithDelay wraps Get with a ratelimiting function.  It simply adds a very
-// long delay if too many are online.  This is to comply with FA's request:
-// "Limit bot activity to periods with less than 10k registered users online."
-// Even when fewer users are online, we'll still add a short delay to be kind.
+// PostWithDelay is GetWithDelay for a form submission.  FA's search is the
+// only thing which needs this, since its pagination is driven by POSTs.
 //
 // Parameters:
-//   - uri: The URL to fetch
+//   - ctx: Context for cancellation of the request and delay
+//   - uri: The URL to post to
+//   - form: The form fields
 //
 // Returns:
 //   - []byte: The response body content
 //   - error: Any error encountered during the request or delay logic
-func (h *HTTPClient) GetWithDelay(uri string) ([]byte, error) {
-	ret, err := h.Get(uri)
+func (h *HTTPClient) PostWithDelay(ctx context.Context, uri string, form url.Values) ([]byte, error) {
+	ret, err := h.Post(ctx, uri, form)
 	if err != nil {
 		return ret, err
 	}
+	return h.delayAfter(ctx, ret)
+}
 
-	registeredUsers, err := h.parseRegisteredUsersOnline(ret)
+// delayAfter applies the ratelimiting delay for a page which has just been
+// fetched.
+//
+// Parameters:
+//   - ctx: Context for cancellation of the delay
+//   - page: The page content, which reports how many users are online
+//
+// Returns:
+//   - []byte: The page content, or nil if the delay was interrupted
+//   - error: Any error parsing the page or from the delay
+func (h *HTTPClient) delayAfter(ctx context.Context, page []byte) ([]byte, error) {
+	registeredUsers, err := h.parseRegisteredUsersOnline(page)
 	if err != nil {
-		return ret, err
+		return page, err
 	}
 
 	// Delay if the number of registered users is high.
 	// In prod, this will log a message and sleep for a while.
 	// In test this will be a spy or no-op.
-	h.delayFunc(registeredUsers)
+	err = h.delayFunc(ctx, registeredUsers)
+	if err != nil {
+		return nil, err
+	}
 
-	return ret, nil
+	return page, nil
 }
 
 // Get performs an HTTP GET request with automatic retries. If the initial
-// request fails, it will retry up to the configured number of times with delays
-// between attempts.
+// request fails, it will be retried according to the retry policy.  Canceling
+// the context aborts the request in flight and any pending retry.
 //
 // Parameters:
+//   - ctx: Context for cancellation
 //   - uri: The URL to fetch
 //
 // Returns:
 //   - []byte: The response body content
 //   - error: The final error if all retry attempts fail, nil on success
-func (h *HTTPClient) Get(uri string) ([]byte, error) {
+func (h *HTTPClient) Get(ctx context.Context, uri string) ([]byte, error) {
 	h.logger.Debug("HTTPClient GET", "uri", uri)
+	var data []byte
+	err := h.withRetries(ctx, "GET", uri, func() error {
+		var err error
+		data, err = h.get(ctx, uri)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Post performs an HTTP POST of a form with automatic retries, like Get.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - uri: The URL to post to
+//   - form: The form fields
+//
+// Returns:
+//   - []byte: The response body content
+//   - error: The final error if all retry attempts fail, nil on success
+func (h *HTTPClient) Post(ctx context.Context, uri string, form url.Values) ([]byte, error) {
+	h.logger.Debug("HTTPClient POST", "uri", uri, "form", form.Encode())
+	var data []byte
+	err := h.withRetries(ctx, "POST", uri, func() error {
+		var err error
+		data, err = h.post(ctx, uri, form)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// withRetries calls fn until it succeeds, up to the retry policy's number of
+// attempts with backoff delays between them.  Errors which can't be fixed by
+// retrying, and cancellation of the context, end the loop early.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - op: Name of the operation for log messages, e.g. "GET"
+//   - uri: The URL being fetched, for log messages
+//   - fn: The operation to attempt
+//
+// Returns:
+//   - error: The final error if all attempts fail, nil on success
+func (h *HTTPClient) withRetries(ctx context.Context, op string, uri string, fn func() error) error {
 	var lastErr error
-	for attempt := range h.tryCount {
-		data, err := h.get(uri)
+	for attempt := range h.retryPolicy.MaxAttempts {
+		err := fn()
 		if err == nil {
-			return data, nil
+			return nil
+		}
+		// Don't retry, or log a scary error, if we're shutting down.
+		if ctx.Err() != nil {
+			return err
+		}
+		if !isRetryable(err) {
+			h.logger.Debug("HTTPClient "+op+" failed permanently", "uri", uri, "error", err)
+			return err
 		}
 		lastErr = err
-		h.logger.Info("HTTPClient GET failed attempt", "uri", uri, "attempt", attempt, "error", err)
-		time.Sleep(h.retryInterval)
+		if attempt < h.retryPolicy.MaxAttempts-1 {
+			delay := h.retryPolicy.delay(attempt, err)
+			h.logger.Info("HTTPClient "+op+" failed attempt",
+				"uri", uri, "attempt", attempt, "retryIn", delay, "error", err)
+			err = sleepContext(ctx, delay)
+			if err != nil {
+				return err
+			}
+		}
 	}
-	h.logger.Error("HTTPClient GET all attempts failed", "uri", uri, "error", lastErr)
-	return nil, lastErr
+	h.logger.Error("HTTPClient "+op+" all attempts failed", "uri", uri, "error", lastErr)
+	return lastErr
 }
 
 // get performs a single HTTP GET request without retries. This is used inside
 // the public Get method's retry loop.
 //
 // Parameters:
+//   - ctx: Context for cancellation
 //   - uri: The URL to fetch
 //
 // Returns:
 //   - []byte: The response body content
 //   - error: Any error encountered during the request
-func (h *HTTPClient) get(uri string) ([]byte, error) {
-	// This is the only place where we need a context, so we create one with a
-	// timeout here.  The whole program is intentionally designed so nothing
-	// needs to be cleaned up on shutdown.
-	ctx, cancel := context.WithTimeout(context.Background(), httpTimeout)
+func (h *HTTPClient) get(ctx context.Context, uri string) ([]byte, error) {
+	return h.request(ctx, http.MethodGet, uri, nil)
+}
+
+// post performs a single HTTP POST of a form without retries. This is used
+// inside the public Post method's retry loop.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - uri: The URL to post to
+//   - form: The form fields
+//
+// Returns:
+//   - []byte: The response body content
+//   - error: Any error encountered during the request
+func (h *HTTPClient) post(ctx context.Context, uri string, form url.Values) ([]byte, error) {
+	return h.request(ctx, http.MethodPost, uri, form)
+}
+
+// request performs a single HTTP request and reads the response.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - method: http.MethodGet or http.MethodPost
+//   - uri: The URL to request
+//   - form: Form fields to post, or nil for a GET
+//
+// Returns:
+//   - []byte: The response body content
+//   - error: Any error encountered during the request
+func (h *HTTPClient) request(ctx context.Context, method string, uri string, form url.Values) ([]byte, error) {
+	err := h.waitForWindow(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, httpTimeout)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	var requestBody io.Reader
+	if form != nil {
+		requestBody = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, uri, requestBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("User-Agent", httpUserAgent)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
 
 	response, err := h.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("GET failed: %w", err)
+		return nil, fmt.Errorf("%s failed: %w", method, err)
 	}
 	defer func() { _ = response.Body.Close() }()
-
-	if response.StatusCode == http.StatusNotFound {
-		return nil, fmt.Errorf("resource not found: %w", ErrHTTPNotFound)
-	}
+	h.saveCookiesIfDue()
 
 	if response.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("%w: %s", ErrHTTPStatusNotOK, response.Status)
+		return nil, newHTTPStatusError(response)
 	}
 
 	body, err := io.ReadAll(response.Body)
@@ -320,68 +401,23 @@ func (h *HTTPClient) parseRegisteredUsersOnline(htmlContent []byte) (int, error)
 	return registeredUsers, nil
 }
 
-// parseCookieLine parses a single line from a cookies.txt file and adds the
-// cookie to the client's cookie jar.
+// sleepContext sleeps for the given duration, returning early with the
+// context's error if it is canceled first.
 //
 // Parameters:
-//   - line: A single line from a cookies.txt file
-func (h *HTTPClient) parseCookieLine(line string) error {
-	// Skip comments and empty lines
-	if line == "" || strings.HasPrefix(line, "#") {
+//   - ctx: Context for cancellation
+//   - d: How long to sleep
+//
+// Returns:
+//   - error: The context's error if canceled, nil if the full duration elapsed
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("sleep interrupted: %w", ctx.Err())
+	case <-timer.C:
 		return nil
 	}
-
-	// Parse cookie line format: domain	flag	path	secure	expiration	name	value
-	parts := strings.Split(line, "\t")
-	if len(parts) != cookiesTxtFieldCount {
-		return fmt.Errorf("%w: %v", ErrInvalidCookie, line)
-	}
-
-	domain := parts[0]
-	// flag := parts[1] // not used
-	path := parts[2]
-	secure := strings.ToUpper(parts[3]) == "TRUE"
-	expiration := parts[4]
-	name := parts[5]
-	value := parts[6]
-
-	// Abort if a cookie is expired or will expire soon.  We don't want to
-	// continue without being logged in because it will result in silently
-	// missed submissions.  The user should update their cookies.txt file, or
-	// they can re-run without a cookies.txt file if they don't need logged-in
-	// access.  One week is chosen as a reasonable maximum time the program
-	// might be run without user intervention.
-	expireTime, err := strconv.ParseInt(expiration, 10, 64)
-	if err != nil {
-		return fmt.Errorf("invalid expiration time for cookie %s: %w", name, err)
-	}
-	cookieExpire := time.Unix(expireTime, 0)
-	oneWeekFromNow := time.Now().Add(oneWeekDuration)
-	if cookieExpire.Before(oneWeekFromNow) {
-		return fmt.Errorf("%w: %s", ErrExpiredCookie, name)
-	}
-
-	// Create URL for the domain
-	scheme := "http"
-	if secure {
-		scheme = "https"
-	}
-
-	cookieURL, err := url.Parse(
-		fmt.Sprintf("%s://%s%s", scheme, domain, path))
-	if err != nil {
-		return fmt.Errorf("invalid URL for cookie %s: %w", name, err)
-	}
-
-	// Create cookie
-	cookie := &http.Cookie{
-		Name:   name,
-		Value:  value,
-		Domain: domain,
-		Path:   path,
-	}
-
-	// Add cookie to jar
-	h.client.Jar.SetCookies(cookieURL, []*http.Cookie{cookie})
-	return nil
 }
@@ -4,6 +4,7 @@ package main_test
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	main "furtrap"
@@ -64,9 +65,9 @@ func TestHTTPClient_Get(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(SampleDataHandler))
 	defer server.Close()
 	client := main.NewHTTPClient(NewTestLogger(t))
-	client.SetRetryPolicy(3, 0*time.Millisecond)
+	client.SetRetryPolicy(main.RetryPolicy{MaxAttempts: 3})
 	t.Run("Basic GET", func(t *testing.T) {
-		have, err := client.Get(server.URL + "/view/101")
+		have, err := client.Get(t.Context(), server.URL+"/view/101")
 		assert.NilError(t, err)
 
 		got := bytes.Contains(have, []byte("Test Submission 101"))
@@ -74,7 +75,7 @@ func TestHTTPClient_Get(t *testing.T) {
 	})
 
 	t.Run("404", func(t *testing.T) {
-		_, err := client.Get(server.URL + "/view/00000")
+		_, err := client.Get(t.Context(), server.URL+"/view/00000")
 		assert.ErrorIs(t, err, main.ErrHTTPNotFound, "Should get ErrHTTPNotFound on 404")
 	})
 
@@ -83,7 +84,7 @@ func TestHTTPClient_Get(t *testing.T) {
 		flakyServer := httptest.NewServer(flakyHandler)
 		defer flakyServer.Close()
 
-		have, err := client.Get(flakyServer.URL + "/view/101")
+		have, err := client.Get(t.Context(), flakyServer.URL+"/view/101")
 		assert.NilError(t, err)
 
 		got := bytes.Contains(have, []byte("Test Submission 101"))
@@ -98,10 +99,33 @@ func TestHTTPClient_Get(t *testing.T) {
 		flakyServer := httptest.NewServer(flakyHandler)
 		defer flakyServer.Close()
 
-		_, err := client.Get(flakyServer.URL + "/view/101")
+		_, err := client.Get(t.Context(), flakyServer.URL+"/view/101")
 		assert.ErrorContains(t, err, "502 Bad Gateway")
 	})
 
+	t.Run("HTTPClient#Get stops retrying when the context is canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+
+		requests := 0
+		handler := func(w http.ResponseWriter, _ *http.Request) {
+			requests++
+			cancel()
+			http.Error(w, "502 Bad Gateway", http.StatusBadGateway)
+		}
+		cancelServer := httptest.NewServer(http.HandlerFunc(handler))
+		defer cancelServer.Close()
+
+		// A retry interval this long would hang the test if it weren't
+		// interrupted.
+		slowClient := main.NewHTTPClient(NewTestLogger(t))
+		slowClient.SetRetryPolicy(main.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour})
+
+		_, err := slowClient.Get(ctx, cancelServer.URL)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, requests, 1)
+	})
+
 	t.Run("HTTPClient sends correct User-Agent", func(t *testing.T) {
 		handler := func(w http.ResponseWriter, r *http.Request) {
 			ua := r.Header.Get("User-Agent")
@@ -110,7 +134,7 @@ func TestHTTPClient_Get(t *testing.T) {
 		uaServer := httptest.NewServer(http.HandlerFunc(handler))
 		defer uaServer.Close()
 
-		have, err := client.Get(uaServer.URL)
+		have, err := client.Get(t.Context(), uaServer.URL)
 		assert.NilError(t, err)
 
 		want := "furtrap/2.0 (+https://github.com/keepiru/furtrap)"
@@ -118,6 +142,36 @@ func TestHTTPClient_Get(t *testing.T) {
 	})
 }
 
+func TestHTTPClient_Post(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(r.Method + " " + r.PostForm.Get("q") + " " + r.Header.Get("User-Agent")))
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	client := main.NewHTTPClient(NewTestLogger(t))
+	have, err := client.Post(t.Context(), server.URL+"/search/", url.Values{"q": {"red fox"}})
+	assert.NilError(t, err)
+	assert.Equal(t, string(have), "POST red fox furtrap/2.0 (+https://github.com/keepiru/furtrap)")
+
+	t.Run("retries like Get", func(t *testing.T) {
+		flakyHandler := &Flaky502Handler{failuresRemaining: 2}
+		flakyServer := httptest.NewServer(flakyHandler)
+		defer flakyServer.Close()
+
+		client := main.NewHTTPClient(NewTestLogger(t))
+		client.SetRetryPolicy(main.RetryPolicy{MaxAttempts: 3})
+		_, err := client.Post(t.Context(), flakyServer.URL+"/view/101", url.Values{})
+		assert.NilError(t, err)
+		assert.Equal(t, flakyHandler.failuresRemaining, 0)
+	})
+}
+
 // Integration test for GetWithDelay, calling down through parseRegisteredUsersOnline,
 // and ensuring it calls the delayFunc callback with the number of registered users online.
 func TestHTTPClient_GetWithDelay(t *testing.T) {
@@ -141,9 +195,12 @@ func TestHTTPClient_GetWithDelay(t *testing.T) {
 		t.Run(tt.uri, func(t *testing.T) {
 			registeredUsers := 0
 			client := main.NewHTTPClient(NewTestLogger(t))
-			client.SetDelayFunc(func(ru int) { registeredUsers = ru })
+			client.SetDelayFunc(func(_ context.Context, ru int) error {
+				registeredUsers = ru
+				return nil
+			})
 
-			_, err := client.GetWithDelay(server.URL + tt.uri)
+			_, err := client.GetWithDelay(t.Context(), server.URL+tt.uri)
 			if tt.expectError {
 				assert.Error(t, err, "could not find registered users count")
 			} else {
@@ -154,9 +211,27 @@ func TestHTTPClient_GetWithDelay(t *testing.T) {
 	}
 }
 
+func TestHTTPClient_GetWithDelay_Canceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(SampleDataHandler))
+	defer server.Close()
+
+	// /view/103 reports enough registered users to trigger the 5 minute
+	// delay, which must be cut short by the context.
+	ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+	defer cancel()
+
+	client := main.NewHTTPClient(NewTestLogger(t))
+	start := time.Now()
+	_, err := client.GetWithDelay(ctx, server.URL+"/view/103")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Assert(t, time.Since(start) < time.Minute)
+}
+
 func TestHTTPClient_LoadCookies(t *testing.T) {
 	t.Run("Load some cookies", func(t *testing.T) {
 		cookiesContent := `# Netscape HTTP Cookie File
+.furaffinity.net	TRUE	/	TRUE	4070937600	a	auth_a
+.furaffinity.net	TRUE	/	TRUE	4070937600	b	auth_b
 .furaffinity.net	TRUE	/	TRUE	4070937600	test_cookie	test_value
 .furaffinity.net	TRUE	/path	FALSE	4070937600	another_cookie	another_value`
 
@@ -191,9 +266,11 @@ func TestHTTPClient_LoadCookies(t *testing.T) {
 		assert.NilError(t, err)
 
 		format := "# Netscape HTTP Cookie File\n" +
-			"%s\tTRUE\t/\tFALSE\t4070937600\ttest_cookie\ttest_value\n" +
-			"%s\tTRUE\t/\tFALSE\t4070937600\tanother_cookie\tanother_value\n"
-		cookies := fmt.Sprintf(format, serverURL.Hostname(), serverURL.Hostname())
+			"%[1]s\tTRUE\t/\tFALSE\t4070937600\ta\tauth_a\n" +
+			"%[1]s\tTRUE\t/\tFALSE\t4070937600\tb\tauth_b\n" +
+			"%[1]s\tTRUE\t/\tFALSE\t4070937600\ttest_cookie\ttest_value\n" +
+			"%[1]s\tTRUE\t/\tFALSE\t4070937600\tanother_cookie\tanother_value\n"
+		cookies := fmt.Sprintf(format, serverURL.Hostname())
 
 		tempfile := filepath.Join(t.TempDir(), "cookies.txt")
 		err = os.WriteFile(tempfile, []byte(cookies), 0600)
@@ -205,7 +282,7 @@ func TestHTTPClient_LoadCookies(t *testing.T) {
 		assert.NilError(t, err)
 
 		// Make request to test server
-		respData, err := client.Get(server.URL)
+		respData, err := client.Get(t.Context(), server.URL)
 		assert.NilError(t, err)
 
 		// Verify that the cookies were sent and received correctly
@@ -217,19 +294,6 @@ func TestHTTPClient_LoadCookies(t *testing.T) {
 			"Response should contain the another_cookie")
 	})
 
-	t.Run("Abort if cookie is expired", func(t *testing.T) {
-		fiveDaysFromNow := time.Now().Add(5 * 24 * time.Hour).Unix()
-		cookiesContent := fmt.Sprintf(`.furaffinity.net	TRUE	/	TRUE	%d	expired_cookie	expired_value`, fiveDaysFromNow)
-
-		tempfile := filepath.Join(t.TempDir(), "cookies.txt")
-		err := os.WriteFile(tempfile, []byte(cookiesContent), 0600)
-		assert.NilError(t, err)
-
-		client := main.NewHTTPClient(NewTestLogger(t))
-		err = client.LoadCookies(tempfile)
-		assert.Error(t, err, "failed to load cookie: cookie is expiring, update your cookies.txt file: expired_cookie")
-	})
-
 	t.Run("Abort if cookie is malformed", func(t *testing.T) {
 		cookiesContent := `.furaffinity.net	TRUE	/	TRUE	4070937600	malformed_cookie`
 
@@ -0,0 +1,377 @@
+package main
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+// This file contains the entry points for furtrap's subcommands.  These are
+// tasks which operate on an existing output directory, as opposed to the
+// default mode which crawls FA for new submissions.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	// merge-aliases takes either no arguments, or an old and a new name.
+	mergeAliasesArgs = 2
+
+	// cookies takes the action, check, and a cookies file.
+	cookiesCheckArgs = 2
+)
+
+// subcommands maps subcommand names to their entry points.  Each entry point
+// takes the arguments following the subcommand name and returns the process
+// exit code.
+var subcommands = map[string]func(args []string) int{
+	"backfill-metadata": runBackfillMetadata,
+	"cookies":           runCookies,
+	"merge-aliases":     runMergeAliases,
+	"rebuild-index":     runRebuildIndex,
+	"refresh-comments":  runRefreshComments,
+	"retry-failed":      runRetryFailed,
+}
+
+// newSubcommandFlagSet creates a flag set for a subcommand, with a usage
+// message in the same style as the main command.
+//
+// Parameters:
+//   - name: The subcommand name
+//   - usage: The argument synopsis shown after the subcommand name
+//
+// Returns:
+//   - *pflag.FlagSet: A new flag set which exits on parse errors
+func newSubcommandFlagSet(name string, usage string) *pflag.FlagSet {
+	flags := pflag.NewFlagSet(name, pflag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s %s %s\n\n", os.Args[0], name, usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// runBackfillMetadata implements the backfill-metadata subcommand, which
+// writes metadata sidecars for every saved submission that lacks one.
+//
+// Parameters:
+//   - args: Command line arguments following the subcommand name
+//
+// Returns:
+//   - int: The process exit code
+func runBackfillMetadata(args []string) int {
+	flags := newSubcommandFlagSet("backfill-metadata", "[-df] [-o <output_dir>]")
+	debug := flags.BoolP("debug", "d", false, "Enable debug logging")
+	force := flags.BoolP("force", "f", false, "Regenerate metadata which already exists")
+	outputDir := flags.StringP("output", "o", "dl", "Output directory to scan")
+	_ = flags.Parse(args) // ExitOnError
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return exitCodeError
+	}
+
+	logger := CreateLogger(os.Stderr, *debug)
+	result, err := BackfillMetadata(logger, *outputDir, *force)
+	logger.Info("Backfill finished",
+		"written", result.Written,
+		"skipped", result.Skipped,
+		"failed", len(result.Failed))
+	if err != nil {
+		logger.Error("Backfill error", "error", err)
+		return exitCodeError
+	}
+
+	for _, path := range result.Failed {
+		logger.Warn("Could not parse", "file", path)
+	}
+	if len(result.Failed) > 0 {
+		return exitCodeError
+	}
+	return 0
+}
+
+// runCookies implements the cookies subcommand.  Its only action is check,
+// which loads a cookies file the way a run would, and prints which auth
+// cookies were found and when they expire.  Nothing is fetched from FA.
+//
+// Parameters:
+//   - args: Command line arguments following the subcommand name
+//
+// Returns:
+//   - int: The process exit code
+func runCookies(args []string) int {
+	flags := newSubcommandFlagSet("cookies", "check [-d] [--cookie-warning <duration>] <cookies_file>")
+	debug := flags.BoolP("debug", "d", false, "Enable debug logging")
+	cookieWarning := flags.Duration("cookie-warning", defaultCookieWarning,
+		"Warn if the auth cookies expire within this long")
+	_ = flags.Parse(args) // ExitOnError
+	if flags.NArg() != cookiesCheckArgs || flags.Arg(0) != "check" {
+		flags.Usage()
+		return exitCodeError
+	}
+	filename := flags.Arg(1)
+
+	format, cookies, err := ReadCookiesFile(filename)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", filename, err)
+		return exitCodeError
+	}
+	fmt.Printf("%s: %d cookies in %s format\n", filename, len(cookies), format)
+
+	now := time.Now()
+	for _, name := range authCookieNames {
+		fmt.Printf("  %s: %s\n", name, describeCookieExpiry(cookies, name, now, *cookieWarning))
+	}
+
+	// Load them for real, so the verdict is exactly what a run would decide.
+	client := NewHTTPClient(CreateLogger(os.Stderr, *debug))
+	policy := DefaultCookiePolicy()
+	policy.WarnWithin = *cookieWarning
+	client.SetCookiePolicy(policy)
+	err = client.LoadCookies(filename)
+	if err != nil {
+		fmt.Printf("Not usable: %v\n", err)
+		return exitCodeError
+	}
+	fmt.Println("OK")
+	return 0
+}
+
+// runMergeAliases implements the merge-aliases subcommand, which merges
+// renamed artists' old directories into their new ones.  Given an old and new
+// name, it records that alias first, for renames FA doesn't redirect.
+//
+// Parameters:
+//   - args: Command line arguments following the subcommand name
+//
+// Returns:
+//   - int: The process exit code
+func runMergeAliases(args []string) int {
+	flags := newSubcommandFlagSet("merge-aliases", "[-d] [-o <output_dir>] [<old_name> <new_name>]")
+	debug := flags.BoolP("debug", "d", false, "Enable debug logging")
+	outputDir := flags.StringP("output", "o", "dl", "Output directory to merge in")
+	_ = flags.Parse(args) // ExitOnError
+	if flags.NArg() != 0 && flags.NArg() != mergeAliasesArgs {
+		flags.Usage()
+		return exitCodeError
+	}
+
+	logger := CreateLogger(os.Stderr, *debug)
+	aliases, err := OpenArtistAliases(*outputDir)
+	if err != nil {
+		logger.Error("Failed to load aliases", "error", err)
+		return exitCodeError
+	}
+	if flags.NArg() == mergeAliasesArgs {
+		err = aliases.Record(flags.Arg(0), ArtistAlias{NewName: flags.Arg(1), DetectedAt: time.Now().UTC()})
+		if err != nil {
+			logger.Error("Failed to record alias", "error", err)
+			return exitCodeError
+		}
+	}
+
+	result, err := MergeArtistDirs(logger, *outputDir, aliases)
+	logger.Info("Merge finished",
+		"moved", result.Moved,
+		"duplicates", result.Duplicates,
+		"superseded", result.Superseded,
+		"conflicts", len(result.Conflicts))
+	if err != nil {
+		logger.Error("Merge error", "error", err)
+		return exitCodeError
+	}
+
+	for _, path := range result.Conflicts {
+		logger.Warn("Differs from the new artist's copy, left in place", "file", path)
+	}
+	if len(result.Conflicts) > 0 {
+		return exitCodeError
+	}
+	return 0
+}
+
+// runRebuildIndex implements the rebuild-index subcommand, which replaces the
+// archive index with one built from the files on disk.
+//
+// Parameters:
+//   - args: Command line arguments following the subcommand name
+//
+// Returns:
+//   - int: The process exit code
+func runRebuildIndex(args []string) int {
+	flags := newSubcommandFlagSet("rebuild-index", "[-d] [-o <output_dir>]")
+	debug := flags.BoolP("debug", "d", false, "Enable debug logging")
+	outputDir := flags.StringP("output", "o", "dl", "Output directory to scan")
+	_ = flags.Parse(args) // ExitOnError
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return exitCodeError
+	}
+
+	logger := CreateLogger(os.Stderr, *debug)
+	_, err := RebuildArchiveIndex(logger, *outputDir)
+	if err != nil {
+		logger.Error("Rebuild error", "error", err)
+		return exitCodeError
+	}
+	return 0
+}
+
+// runRetryFailed implements the retry-failed subcommand, which re-attempts
+// the artists and submissions listed in the failure ledger.
+//
+// Parameters:
+//   - args: Command line arguments following the subcommand name
+//
+// Returns:
+//   - int: The process exit code
+func runRetryFailed(args []string) int {
+	flags := newSubcommandFlagSet("retry-failed",
+		"[-drsjpn] [-o <output_dir>] [-c <cookies_file>] [--cookie-warning <duration>] [--save-cookies <file>] "+
+			"[--login-recheck <duration>] [--login-match -u <username>] [--window <window>] [throttle options]")
+	debug := flags.BoolP("debug", "d", false, "Enable debug logging")
+	reCrawl := flags.BoolP("recrawl", "r", false, "Re-crawl failed artists' galleries looking for missed submissions")
+	skipScraps := flags.BoolP("skip-scraps", "s", false, "Don't download scraps of failed artists")
+	journals := flags.BoolP("journals", "j", false, "Download journals of failed artists")
+	profiles := flags.BoolP("profiles", "p", false, "Save snapshots of failed artists' profiles")
+	noThrottle := flags.BoolP("no-throttle", "n", false, "Disable wait time between requests")
+	var throttle ThrottlePolicy
+	addThrottleFlags(flags, &throttle)
+	windowSpec := flags.String("window", "",
+		"Only make requests during this time of day, e.g. \"01:00-07:00 America/Chicago\", pausing outside it")
+	outputDir := flags.StringP("output", "o", "dl", "Output directory containing the failure ledger")
+	var cookieFile string
+	var cookieWarning time.Duration
+	addCookieFlags(flags, &cookieFile, &cookieWarning)
+	saveCookies := flags.String("save-cookies", "",
+		"Write the cookies back to this file in cookies.txt format, at exit and as FA refreshes them")
+	var loginRecheck time.Duration
+	var loginMatch bool
+	addLoginFlags(flags, &loginRecheck, &loginMatch)
+	username := flags.StringP("username", "u", "", "With --login-match, the user the cookies must be logged in as")
+	_ = flags.Parse(args) // ExitOnError
+	if flags.NArg() > 0 || (*saveCookies != "" && cookieFile == "") ||
+		(loginMatch && (cookieFile == "" || *username == "")) {
+		flags.Usage()
+		return exitCodeError
+	}
+
+	err := throttle.Validate()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCodeError
+	}
+
+	logger := CreateLogger(os.Stderr, *debug)
+	client, err := setupHTTPClient(logger, cookieFile, cookieWarning, throttle, *noThrottle)
+	if err != nil {
+		logger.Error("Failed to load cookies", "file", cookieFile, "error", err)
+		return exitCodeError
+	}
+	window, err := ParseOperatingWindow(*windowSpec)
+	if err != nil {
+		logger.Error("Invalid operating window", "error", err)
+		return exitCodeError
+	}
+	client.SetOperatingWindow(window)
+	client.SetCookieSaving(*saveCookies, defaultCookieSaveInterval)
+
+	scraper := NewScraper(logger, client, "", nil, *reCrawl, *skipScraps, *outputDir)
+	scraper.SetJournals(*journals)
+	scraper.SetProfiles(*profiles)
+	if cookieFile != "" {
+		expected := ""
+		if loginMatch {
+			expected = *username
+		}
+		scraper.SetLoginCheck(expected, loginRecheck)
+	}
+	return runScraper(logger, client, scraper, scraper.RetryFailed)
+}
+
+// runRefreshComments implements the refresh-comments subcommand, which
+// re-fetches saved submissions' /view/ pages and merges new comments into
+// their comments sidecars.
+//
+// Parameters:
+//   - args: Command line arguments following the subcommand name
+//
+// Returns:
+//   - int: The process exit code
+func runRefreshComments(args []string) int {
+	flags := newSubcommandFlagSet("refresh-comments",
+		"[-dn] [-o <output_dir>] [-c <cookies_file>] [--cookie-warning <duration>] [--older-than <duration>] "+
+			"[--window <window>] [throttle options]")
+	debug := flags.BoolP("debug", "d", false, "Enable debug logging")
+	noThrottle := flags.BoolP("no-throttle", "n", false, "Disable wait time between requests")
+	var throttle ThrottlePolicy
+	addThrottleFlags(flags, &throttle)
+	windowSpec := flags.String("window", "",
+		"Only make requests during this time of day, e.g. \"01:00-07:00 America/Chicago\", pausing outside it")
+	outputDir := flags.StringP("output", "o", "dl", "Output directory to scan")
+	var cookieFile string
+	var cookieWarning time.Duration
+	addCookieFlags(flags, &cookieFile, &cookieWarning)
+	olderThan := flags.Duration("older-than", defaultCommentsRefreshAge,
+		"Only refresh comments last fetched longer ago than this, 0 for all")
+	_ = flags.Parse(args) // ExitOnError
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return exitCodeError
+	}
+
+	err := throttle.Validate()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCodeError
+	}
+
+	logger := CreateLogger(os.Stderr, *debug)
+	client, err := setupHTTPClient(logger, cookieFile, cookieWarning, throttle, *noThrottle)
+	if err != nil {
+		logger.Error("Failed to load cookies", "file", cookieFile, "error", err)
+		return exitCodeError
+	}
+	window, err := ParseOperatingWindow(*windowSpec)
+	if err != nil {
+		logger.Error("Invalid operating window", "error", err)
+		return exitCodeError
+	}
+	client.SetOperatingWindow(window)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Comments on some submissions are only visible when logged in.
+	if cookieFile != "" {
+		username, err := VerifyLogin(ctx, client, "")
+		if err != nil {
+			logger.Error("Login check failed", "error", err)
+			return exitCodeError
+		}
+		logger.Info("Logged in", "username", username)
+	}
+
+	result, err := RefreshComments(ctx, logger, client, *outputDir, *olderThan)
+	logger.Info("Comment refresh finished",
+		"refreshed", result.Refreshed,
+		"skipped", result.Skipped,
+		"new", result.NewComments,
+		"failed", result.Failed)
+	switch {
+	case errors.Is(err, context.Canceled):
+		logger.Warn("Interrupted, exiting")
+		return exitCodeInterrupted
+	case err != nil:
+		logger.Error("Refresh error", "error", err)
+		return exitCodeError
+	case result.Failed > 0:
+		return exitCodeError
+	}
+	return 0
+}
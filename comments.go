@@ -0,0 +1,367 @@
+package main
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	// How much narrower FA draws each level of reply, in percent.
+	commentIndentPercent = 3
+
+	// How many regex capture groups commentIDRegexp and commentWidthRegexp
+	// should have.
+	commentIDRegexpCaptures    = 2
+	commentWidthRegexpCaptures = 2
+)
+
+var (
+	ErrNotViewPage = errors.New("not a submission page")
+
+	// Regex matching the anchor each comment has, e.g. id="cid:123456".
+	commentIDRegexp = regexp.MustCompile(`^cid:(\d+)$`)
+
+	// Regex to pull the width out of a comment container's style or width
+	// attribute, e.g. "width:97%" or "97%".  Replies are narrower than the
+	// comment they reply to.
+	commentWidthRegexp = regexp.MustCompile(`(\d+(?:\.\d+)?)%`)
+)
+
+// Comment is a single comment on a submission.
+type Comment struct {
+	ID      uint64    `json:"id"`
+	Parent  uint64    `json:"parent,omitempty"` // The comment this replies to, unset at the top level
+	Author  string    `json:"author"`           // Empty if hidden or deleted
+	Posted  time.Time `json:"posted,omitzero"`
+	Text    string    `json:"text"`
+	Hidden  bool      `json:"hidden,omitempty"`  // Hidden or deleted on FA
+	Removed bool      `json:"removed,omitempty"` // No longer on the page at all
+}
+
+// SubmissionComments is the comments JSON sidecar, written next to the
+// metadata sidecar as "<original_filename>.<submission_id>.comments.json".
+type SubmissionComments struct {
+	ID          uint64    `json:"id"`
+	RefreshedAt time.Time `json:"refreshed_at"` // When the /view/ page was last fetched
+	Comments    []Comment `json:"comments"`     // In page order
+}
+
+// CommentsRefreshResult summarizes a RefreshComments run.
+type CommentsRefreshResult struct {
+	Refreshed   int // Submissions whose comments were fetched again
+	Skipped     int // Submissions refreshed too recently
+	NewComments int // Comments which weren't in the sidecars before
+	Failed      int // Submissions which couldn't be refreshed
+}
+
+// commentsFilename returns the name of the comments JSON sidecar for a
+// submission: "<original_filename>.<submission_id>.comments.json".
+//
+// Parameters:
+//   - filename: The original filename of the submission file
+//   - id: The FurAffinity submission ID
+//
+// Returns:
+//   - string: The sidecar filename
+func commentsFilename(filename string, id uint64) string {
+	return fmt.Sprintf("%s.%d.comments.json", filename, id)
+}
+
+// saveComments parses the comments from a /view/ page and merges them into
+// the comments sidecar.
+//
+// Parameters:
+//   - dir: The directory the submission is saved in
+//   - filename: The original filename of the submission file
+//   - id: The FurAffinity submission ID
+//   - pageContent: The /view/ page
+//
+// Returns:
+//   - int: How many comments weren't in the sidecar before
+//   - error: Any error parsing the page or reading or writing the sidecar
+func saveComments(dir string, filename string, id uint64, pageContent []byte) (int, error) {
+	fetched, err := parseComments(pageContent)
+	if err != nil {
+		return 0, err
+	}
+
+	path := filepath.Join(dir, commentsFilename(filename, id))
+	existing, err := loadComments(path)
+	if err != nil {
+		return 0, err
+	}
+
+	merged, added := mergeComments(existing.Comments, fetched)
+	sidecar := &SubmissionComments{
+		ID:          id,
+		RefreshedAt: time.Now().UTC(),
+		Comments:    merged,
+	}
+	err = writeJSONFileAtomic(path, sidecar)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save comments: %w", err)
+	}
+	return added, nil
+}
+
+// loadComments reads a comments sidecar.  A missing sidecar is returned
+// empty.
+//
+// Parameters:
+//   - path: The sidecar path
+//
+// Returns:
+//   - *SubmissionComments: The saved comments
+//   - error: Any error reading or parsing the sidecar
+func loadComments(path string) (*SubmissionComments, error) {
+	sidecar := &SubmissionComments{}
+
+	_, err := readJSONFile(path, sidecar)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load comments: %w", err)
+	}
+	return sidecar, nil
+}
+
+// mergeComments merges freshly fetched comments into the saved ones.  The
+// fetched comments come first, in page order, followed by any saved comments
+// which have since disappeared from the page, marked as removed.  A comment
+// which has been hidden since it was saved keeps its saved author and text.
+//
+// Parameters:
+//   - saved: The comments from the sidecar
+//   - fetched: The comments parsed from the page just fetched
+//
+// Returns:
+//   - []Comment: The merged comments
+//   - int: How many fetched comments weren't saved before
+func mergeComments(saved []Comment, fetched []Comment) ([]Comment, int) {
+	byID := make(map[uint64]Comment, len(saved))
+	for _, comment := range saved {
+		byID[comment.ID] = comment
+	}
+
+	merged := make([]Comment, 0, len(fetched))
+	seen := make(map[uint64]bool, len(fetched))
+	added := 0
+	for _, comment := range fetched {
+		seen[comment.ID] = true
+		old, ok := byID[comment.ID]
+		switch {
+		case !ok:
+			added++
+		case comment.Hidden && !old.Hidden:
+			comment.Author = old.Author
+			comment.Posted = old.Posted
+			comment.Text = old.Text
+		}
+		merged = append(merged, comment)
+	}
+
+	for _, comment := range saved {
+		if !seen[comment.ID] {
+			comment.Removed = true
+			merged = append(merged, comment)
+		}
+	}
+	return merged, added
+}
+
+// parseComments extracts the comment tree from a /view/ page.  Both the
+// modern and "classic" templates are supported.  Neither marks up which
+// comment a reply belongs to; a reply is drawn narrower than its parent, so
+// the tree is rebuilt from the widths.
+//
+// Parameters:
+//   - pageContent: Raw HTML content from the submission view page
+//
+// Returns:
+//   - []Comment: The comments, in page order.  Empty if there are none.
+//   - error: Any error parsing the HTML
+func parseComments(pageContent []byte) ([]Comment, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(pageContent))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	comments := []Comment{}
+	var ancestors []uint64 // The most recent comment at each depth
+	doc.Find("[id^='cid:']").Each(func(_ int, s *goquery.Selection) {
+		idAttr, _ := s.Attr("id")
+		matches := commentIDRegexp.FindStringSubmatch(idAttr)
+		if len(matches) != commentIDRegexpCaptures {
+			return
+		}
+		id, err := strconv.ParseUint(matches[1], 10, 64)
+		if err != nil {
+			return
+		}
+
+		// In the modern template the ID is on an empty anchor inside the
+		// container.  In the classic template it's on the container table.
+		container := s
+		if goquery.NodeName(s) == "a" {
+			container = s.Closest(".comment_container")
+		}
+
+		comment := Comment{ID: id}
+		depth := commentDepth(container)
+		if depth > len(ancestors) {
+			depth = len(ancestors)
+		}
+		if depth > 0 {
+			comment.Parent = ancestors[depth-1]
+		}
+		ancestors = append(ancestors[:depth], id)
+
+		comment.Hidden = container.Find(".deleted-comment-container").Length() > 0 ||
+			container.HasClass("deleted-comment-container")
+		text := container.Find("comment-user-text, .comment_text, .replytext").First()
+		comment.Text = multilineText(text)
+		if !comment.Hidden {
+			comment.Author = userFromLinks(container.Find("a[href^='/user/']"))
+			comment.Posted = parsePopupDate(container.Find(".popup_date").First())
+		}
+		comments = append(comments, comment)
+	})
+	return comments, nil
+}
+
+// commentDepth works out how deeply a comment is nested from how much
+// narrower than full width it's drawn.
+//
+// Parameters:
+//   - container: The comment's container element
+//
+// Returns:
+//   - int: The depth, 0 at the top level
+func commentDepth(container *goquery.Selection) int {
+	width, ok := container.Attr("style")
+	if !ok {
+		width, ok = container.Attr("width")
+	}
+	if !ok {
+		return 0
+	}
+
+	matches := commentWidthRegexp.FindStringSubmatch(width)
+	if len(matches) != commentWidthRegexpCaptures {
+		return 0
+	}
+	percent, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil || percent >= 100 {
+		return 0
+	}
+	return int(math.Round((100 - percent) / commentIndentPercent))
+}
+
+// RefreshComments re-fetches the /view/ page of every saved submission whose
+// comments haven't been refreshed within olderThan, and merges any new
+// comments into its sidecar.  The submission file itself isn't downloaded
+// again, and the saved /view/ page is left as it was.  Submissions which fail,
+// including those where FA answers with something other than the /view/ page,
+// are logged and counted, and the refresh carries on with their sidecars left
+// as they were.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - logger: Logger instance
+//   - client: HTTP client interface for making web requests
+//   - outputDir: The root of the output tree to scan
+//   - olderThan: How long ago comments must have been refreshed to be
+//     refreshed again.  Zero refreshes everything.
+//
+// Returns:
+//   - CommentsRefreshResult: Counts of what was refreshed
+//   - error: Any error walking the tree, or cancellation
+func RefreshComments(
+	ctx context.Context,
+	logger *slog.Logger,
+	client Client,
+	outputDir string,
+	olderThan time.Duration,
+) (CommentsRefreshResult, error) {
+	var result CommentsRefreshResult
+	now := time.Now()
+
+	err := walkSavedSubmissions(outputDir, func(saved savedSubmission) error {
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+
+		path := filepath.Join(saved.dir, commentsFilename(saved.filename, saved.id))
+		existing, err := loadComments(path)
+		if err != nil {
+			return err
+		}
+		if !existing.RefreshedAt.IsZero() && now.Sub(existing.RefreshedAt) < olderThan {
+			result.Skipped++
+			return nil
+		}
+
+		pageContent, err := client.GetWithDelay(ctx, viewPageURL(saved.id))
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			logger.Warn("Failed to refresh comments", "id", saved.id, "error", err)
+			result.Failed++
+			return nil
+		}
+		err = checkViewPage(pageContent)
+		if err != nil {
+			logger.Warn("Failed to refresh comments", "id", saved.id, "error", err)
+			result.Failed++
+			return nil
+		}
+
+		added, err := saveComments(saved.dir, saved.filename, saved.id, pageContent)
+		if err != nil {
+			return err
+		}
+		logger.Debug("Refreshed comments", "id", saved.id, "new", added)
+		result.Refreshed++
+		result.NewComments += added
+		return nil
+	})
+	if err != nil {
+		return result, fmt.Errorf("comment refresh failed: %w", err)
+	}
+	return result, nil
+}
+
+// checkViewPage makes sure a page fetched to refresh comments really is the
+// submission's /view/ page.  A system message, like the one for a deleted
+// submission, or anything else without the download link, like a login form
+// or an error page, has no comments on it.  Merging it would mark every
+// comment removed.
+//
+// Parameters:
+//   - pageContent: The page fetched
+//
+// Returns:
+//   - error: ErrNotViewPage if it isn't the /view/ page
+func checkViewPage(pageContent []byte) error {
+	message, ok := parseSystemMessage(pageContent)
+	if ok {
+		return fmt.Errorf("%w: system message: %s", ErrNotViewPage, message)
+	}
+	_, _, err := parseURLAndFilenameFromViewPage(pageContent)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrNotViewPage, err)
+	}
+	return nil
+}
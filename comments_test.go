@@ -0,0 +1,160 @@
+package main_test
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	main "furtrap"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+const (
+	commentsView102 = "https://www.furaffinity.net/view/102"
+
+	// A later version of view/102 in the classic template: 1001 has since
+	// been hidden, 1002 and 1003 are gone, and there's a new reply to 1001.
+	// There's no download link, as refreshing comments shouldn't need one.
+	commentsClassicPage = `<html><body><div id="page-submission">
+		<a href="//d.furaffinity.net/art/artist-with-two-submissions/1/image-2.png">Download</a>
+		<table class="container-comment" id="cid:1001" width="100%"><tr><td>
+			<div class="deleted-comment-container">Comment hidden by its owner</div>
+		</td></tr></table>
+		<table class="container-comment" id="cid:1004" width="97%"><tr><td>
+			<a href="/user/newcomer/">newcomer</a>
+			<span class="popup_date" title="Nov 5th, 2025 09:15 PM">a day ago</span>
+			<div class="replytext">Me too</div>
+		</td></tr></table>
+	</div></body></html>`
+)
+
+// sampleComments are the comments on the sample view/102 page.
+func sampleComments() []main.Comment {
+	return []main.Comment{
+		{
+			ID:     1001,
+			Author: "someone",
+			Posted: time.Date(2025, time.November, 4, 10, 2, 0, 0, time.UTC),
+			Text:   "Love the colors!\nGreat work.",
+		},
+		{
+			ID:     1002,
+			Parent: 1001,
+			Author: "artist-with-two-submissions",
+			Posted: time.Date(2025, time.November, 4, 11, 30, 0, 0, time.UTC),
+			Text:   "Thank you!",
+		},
+		{
+			ID:     1003,
+			Text:   "Comment hidden by its owner",
+			Hidden: true,
+		},
+	}
+}
+
+func TestSubmission_SaveComments(t *testing.T) {
+	submissionDir := t.TempDir()
+	submission := main.NewSubmission(NewTestLogger(t), NewTestClient(), 102, submissionDir)
+	err := submission.Save(t.Context())
+	assert.NilError(t, err)
+
+	matches, err := filepath.Glob(filepath.Join(submissionDir, "*.102.comments.json"))
+	assert.NilError(t, err)
+	assert.Equal(t, len(matches), 1)
+
+	sidecar := readJSON[main.SubmissionComments](t, matches[0])
+	assert.Equal(t, sidecar.ID, uint64(102))
+	assert.Assert(t, !sidecar.RefreshedAt.IsZero())
+	assert.DeepEqual(t, sidecar.Comments, sampleComments())
+}
+
+func TestRefreshComments(t *testing.T) {
+	outputDir := t.TempDir()
+	artistDir := filepath.Join(outputDir, "artist-with-two-submissions")
+	copySampleViewPage(t, "102", artistDir, "image-2.png.102.html")
+	err := os.WriteFile(filepath.Join(artistDir, "image-2.png"), []byte("image"), 0600)
+	assert.NilError(t, err)
+	sidecarPath := filepath.Join(artistDir, "image-2.png.102.comments.json")
+
+	t.Run("creates missing sidecars", func(t *testing.T) {
+		result, err := main.RefreshComments(t.Context(), NewTestLogger(t), NewTestClient(), outputDir, time.Hour)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, result, main.CommentsRefreshResult{Refreshed: 1, NewComments: 3})
+		assert.DeepEqual(t, readJSON[main.SubmissionComments](t, sidecarPath).Comments, sampleComments())
+	})
+
+	t.Run("skips recently refreshed", func(t *testing.T) {
+		client := NewTestClient()
+		client.SetResponse(commentsView102, []byte(commentsClassicPage), nil)
+		result, err := main.RefreshComments(t.Context(), NewTestLogger(t), client, outputDir, time.Hour)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, result, main.CommentsRefreshResult{Skipped: 1})
+	})
+
+	t.Run("merges new comments and keeps old ones", func(t *testing.T) {
+		client := NewTestClient()
+		client.SetResponse(commentsView102, []byte(commentsClassicPage), nil)
+		result, err := main.RefreshComments(t.Context(), NewTestLogger(t), client, outputDir, 0)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, result, main.CommentsRefreshResult{Refreshed: 1, NewComments: 1})
+
+		want := sampleComments()
+		hidden := want[0]
+		hidden.Hidden = true
+		removed1002, removed1003 := want[1], want[2]
+		removed1002.Removed = true
+		removed1003.Removed = true
+		assert.DeepEqual(t, readJSON[main.SubmissionComments](t, sidecarPath).Comments, []main.Comment{
+			hidden,
+			{
+				ID:     1004,
+				Parent: 1001,
+				Author: "newcomer",
+				Posted: time.Date(2025, time.November, 5, 21, 15, 0, 0, time.UTC),
+				Text:   "Me too",
+			},
+			removed1002,
+			removed1003,
+		})
+
+		// The file is untouched
+		//#nosec G304: filename is from test data
+		data, err := os.ReadFile(filepath.Join(artistDir, "image-2.png"))
+		assert.NilError(t, err)
+		assert.Equal(t, string(data), "image")
+	})
+
+	t.Run("failed fetches are counted", func(t *testing.T) {
+		client := NewTestClient()
+		client.SetResponse(commentsView102, nil, main.ErrHTTPNotFound)
+		result, err := main.RefreshComments(t.Context(), NewTestLogger(t), client, outputDir, 0)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, result, main.CommentsRefreshResult{Failed: 1})
+	})
+
+	t.Run("pages which aren't the view page leave the sidecar alone", func(t *testing.T) {
+		//#nosec G304: filename is from test data
+		before, err := os.ReadFile(sidecarPath)
+		assert.NilError(t, err)
+
+		for name, page := range map[string][]byte{
+			"modern system message":  modernSystemMessage("The submission you are trying to find is not in our database."),
+			"classic system message": classicSystemMessage("The submission you are trying to find is not in our database."),
+			"login page":             []byte(`<html><body><form action="/login/"><input name="name"></form></body></html>`),
+		} {
+			client := NewTestClient()
+			client.SetResponse(commentsView102, page, nil)
+			result, err := main.RefreshComments(t.Context(), NewTestLogger(t), client, outputDir, 0)
+			assert.NilError(t, err, name)
+			assert.DeepEqual(t, result, main.CommentsRefreshResult{Failed: 1})
+
+			//#nosec G304: filename is from test data
+			after, err := os.ReadFile(sidecarPath)
+			assert.NilError(t, err)
+			assert.Equal(t, string(after), string(before), name)
+		}
+	})
+}
@@ -0,0 +1,485 @@
+package main
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Default for how long before the auth cookies expire to start warning.
+	// One week is a reasonable maximum time the program might be run without
+	// user intervention.
+	defaultCookieWarning = 7 * 24 * time.Hour
+
+	// Number of tab-separated fields in a Netscape/Mozilla cookies.txt file.
+	cookiesTxtFieldCount = 7
+
+	// The domain cookies from a Cookie header are for.  The header doesn't
+	// say, but it can only have come from FA.
+	cookieHeaderDomain = ".furaffinity.net"
+
+	// The prefix of a Cookie header copied with its name.
+	cookieHeaderPrefix = "cookie:"
+
+	// How long a day is, for reporting when cookies expire.
+	cookieExpiryDay = 24 * time.Hour
+)
+
+// CookieFormat is the format of a cookies file.
+type CookieFormat string
+
+const (
+	CookieFormatNetscape CookieFormat = "netscape" // cookies.txt, as exported by most browser extensions
+	CookieFormatJSON     CookieFormat = "json"     // A JSON array, as exported by EditThisCookie or Cookie-Editor
+	CookieFormatHeader   CookieFormat = "header"   // A Cookie request header, as copied from devtools
+)
+
+var (
+	ErrExpiredCookie = errors.New("cookie has expired, update your cookies file")
+	ErrInvalidCookie = errors.New("invalid cookie format")
+	ErrMissingCookie = errors.New("required cookie not found, update your cookies file")
+
+	// FA's auth cookies.  The rest of what a browser exports isn't needed.
+	authCookieNames = []string{"a", "b"}
+)
+
+// CookiePolicy controls which cookies LoadCookies insists on, and when it
+// warns that they're about to expire.  Without the auth cookies we'd carry on
+// logged out and silently miss submissions, so those must be present and
+// unexpired.  Anything else a browser exports is optional, and is skipped if
+// it has expired.
+type CookiePolicy struct {
+	// Cookies which must be present and unexpired.
+	Required []string
+	// Warn about required cookies which expire within this long.
+	WarnWithin time.Duration
+}
+
+// DefaultCookiePolicy returns the cookie policy used in prod.
+//
+// Returns:
+//   - CookiePolicy: The default policy
+func DefaultCookiePolicy() CookiePolicy {
+	return CookiePolicy{
+		Required:   authCookieNames,
+		WarnWithin: defaultCookieWarning,
+	}
+}
+
+// CookieExpiry records when one of the required cookies expires.
+type CookieExpiry struct {
+	Name    string
+	Expires time.Time // Zero for a session cookie
+}
+
+// jsonCookie is one cookie in the JSON arrays exported by EditThisCookie and
+// Cookie-Editor.  Fields we don't need, like httpOnly and sameSite, are
+// ignored.
+type jsonCookie struct {
+	Domain         string  `json:"domain"`
+	ExpirationDate float64 `json:"expirationDate"` // Seconds since the epoch, with a fraction
+	HostOnly       bool    `json:"hostOnly"`
+	Name           string  `json:"name"`
+	Path           string  `json:"path"`
+	Secure         bool    `json:"secure"`
+	Session        bool    `json:"session"`
+	Value          string  `json:"value"`
+}
+
+// LoadCookies loads cookies from a file and adds them to the client's cookie
+// jar.  This allows access to pages only available to logged-in users.  The
+// file's format is detected: Netscape cookies.txt, a JSON array from a
+// browser extension, or a Cookie header copied from devtools.
+//
+// The cookies are checked against the cookie policy.  The auth cookies must be
+// there and unexpired, other expired cookies are skipped, and a warning is
+// logged if the auth cookies expire soon.
+//
+// Parameters:
+//   - filename: Path to the cookies file to load
+//
+// Returns:
+//   - error: Any error encountered while reading or parsing the cookies file,
+//     ErrExpiredCookie or ErrMissingCookie
+func (h *HTTPClient) LoadCookies(filename string) error {
+	format, cookies, err := ReadCookiesFile(filename)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, cookie := range cookies {
+		err = h.addCookie(cookie, now)
+		if err != nil {
+			return fmt.Errorf("failed to load cookie: %w", err)
+		}
+	}
+
+	err = h.checkRequiredCookies(now)
+	if err != nil {
+		return err
+	}
+	// Only cookies FA sets are worth saving again.
+	h.jar.changed = false
+
+	h.logger.Info("Loaded cookies from file", "file", filename, "format", format)
+	return nil
+}
+
+// ReadCookiesFile reads and parses a cookies file, detecting its format.  No
+// policy is applied, so expired and unneeded cookies are included.
+//
+// Parameters:
+//   - filename: Path to the cookies file
+//
+// Returns:
+//   - CookieFormat: The format the file was in
+//   - []*http.Cookie: The cookies, in file order.  A zero Expires means a
+//     session cookie.
+//   - error: Any error reading the file, or ErrInvalidCookie
+func ReadCookiesFile(filename string) (CookieFormat, []*http.Cookie, error) {
+	//#nosec G304: filename is intentionally from user input
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to open cookies file: %w", err)
+	}
+
+	format := detectCookieFormat(data)
+	var cookies []*http.Cookie
+	switch format {
+	case CookieFormatJSON:
+		cookies, err = parseCookiesJSON(data)
+	case CookieFormatHeader:
+		cookies, err = parseCookieHeader(data)
+	default:
+		cookies, err = parseCookiesTxt(data)
+	}
+	if err != nil {
+		return format, nil, fmt.Errorf("failed to load cookie: %w", err)
+	}
+	return format, cookies, nil
+}
+
+// detectCookieFormat works out what format a cookies file is in.  JSON
+// exports are arrays, and a Cookie header is a single line of name=value
+// pairs, with or without the header name.  Anything else is assumed to be
+// cookies.txt, which reports any problems as it's parsed.
+//
+// Parameters:
+//   - data: The contents of the file
+//
+// Returns:
+//   - CookieFormat: The detected format
+func detectCookieFormat(data []byte) CookieFormat {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		return CookieFormatJSON
+	case bytes.HasPrefix(bytes.ToLower(trimmed), []byte(cookieHeaderPrefix)):
+		return CookieFormatHeader
+	case !bytes.ContainsAny(trimmed, "\t\n#") && bytes.Contains(trimmed, []byte("=")):
+		return CookieFormatHeader
+	}
+	return CookieFormatNetscape
+}
+
+// parseCookiesTxt parses a Netscape/Mozilla cookies.txt file, with
+// tab-separated fields: domain, flag, path, secure, expiration, name, value.
+//
+// Parameters:
+//   - data: The contents of the file
+//
+// Returns:
+//   - []*http.Cookie: The cookies
+//   - error: ErrInvalidCookie if a line can't be parsed
+func parseCookiesTxt(data []byte) ([]*http.Cookie, error) {
+	var cookies []*http.Cookie
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// Skip comments and empty lines
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		cookie, err := parseCookieLine(line)
+		if err != nil {
+			return nil, err
+		}
+		cookies = append(cookies, cookie)
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error reading cookies file: %w", err)
+	}
+	return cookies, nil
+}
+
+// parseCookieLine parses a single line from a cookies.txt file.
+//
+// Parameters:
+//   - line: A single line from a cookies.txt file
+//
+// Returns:
+//   - *http.Cookie: The cookie
+//   - error: ErrInvalidCookie if the line can't be parsed
+func parseCookieLine(line string) (*http.Cookie, error) {
+	// Parse cookie line format: domain	flag	path	secure	expiration	name	value
+	parts := strings.Split(line, "\t")
+	if len(parts) != cookiesTxtFieldCount {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCookie, line)
+	}
+
+	domain := parts[0]
+	// flag := parts[1] // not used
+	path := parts[2]
+	secure := strings.ToUpper(parts[3]) == "TRUE"
+	expiration := parts[4]
+	name := parts[5]
+	value := parts[6]
+
+	// An expiration of 0 is a session cookie.
+	expireTime, err := strconv.ParseInt(expiration, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid expiration time for cookie %s: %w", ErrInvalidCookie, name, err)
+	}
+	var cookieExpire time.Time
+	if expireTime != 0 {
+		cookieExpire = time.Unix(expireTime, 0)
+	}
+
+	return &http.Cookie{
+		Name:    name,
+		Value:   value,
+		Domain:  domain,
+		Path:    path,
+		Secure:  secure,
+		Expires: cookieExpire,
+	}, nil
+}
+
+// parseCookiesJSON parses the JSON array of cookies exported by browser
+// extensions like EditThisCookie and Cookie-Editor.
+//
+// Parameters:
+//   - data: The contents of the file
+//
+// Returns:
+//   - []*http.Cookie: The cookies
+//   - error: ErrInvalidCookie if the JSON can't be parsed, or a cookie has no
+//     name or domain
+func parseCookiesJSON(data []byte) ([]*http.Cookie, error) {
+	var exported []jsonCookie
+	err := json.Unmarshal(data, &exported)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCookie, err)
+	}
+
+	cookies := make([]*http.Cookie, 0, len(exported))
+	for i, c := range exported {
+		if c.Name == "" || c.Domain == "" {
+			return nil, fmt.Errorf("%w: cookie %d has no name or domain", ErrInvalidCookie, i)
+		}
+
+		path := c.Path
+		if path == "" {
+			path = "/"
+		}
+		// Host-only cookies are written as a domain without the leading dot,
+		// which is how cookies.txt marks them too.
+		domain := c.Domain
+		if c.HostOnly {
+			domain = strings.TrimPrefix(domain, ".")
+		}
+		var expires time.Time
+		if !c.Session && c.ExpirationDate != 0 {
+			seconds, fraction := math.Modf(c.ExpirationDate)
+			expires = time.Unix(int64(seconds), int64(fraction*float64(time.Second)))
+		}
+
+		cookies = append(cookies, &http.Cookie{
+			Name:    c.Name,
+			Value:   c.Value,
+			Domain:  domain,
+			Path:    path,
+			Secure:  c.Secure,
+			Expires: expires,
+		})
+	}
+	return cookies, nil
+}
+
+// parseCookieHeader parses a Cookie request header, e.g. "Cookie: a=1; b=2".
+// The header doesn't say when the cookies expire, so they're treated as
+// session cookies.
+//
+// Parameters:
+//   - data: The contents of the file
+//
+// Returns:
+//   - []*http.Cookie: The cookies
+//   - error: ErrInvalidCookie if the header can't be parsed
+func parseCookieHeader(data []byte) ([]*http.Cookie, error) {
+	header := strings.TrimSpace(string(data))
+	if strings.HasPrefix(strings.ToLower(header), cookieHeaderPrefix) {
+		header = strings.TrimSpace(header[len(cookieHeaderPrefix):])
+	}
+
+	parsed, err := http.ParseCookie(header)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCookie, err)
+	}
+
+	cookies := make([]*http.Cookie, 0, len(parsed))
+	for _, c := range parsed {
+		cookies = append(cookies, &http.Cookie{
+			Name:   c.Name,
+			Value:  c.Value,
+			Domain: cookieHeaderDomain,
+			Path:   "/",
+			Secure: true,
+		})
+	}
+	return cookies, nil
+}
+
+// SetCookiePolicy configures which cookies are required, and when to warn
+// that they're expiring.  It must be called before LoadCookies.
+//
+// Parameters:
+//   - policy: The cookie policy to use
+func (h *HTTPClient) SetCookiePolicy(policy CookiePolicy) {
+	h.cookiePolicy = policy
+}
+
+// ExpiringCookies lists the required cookies which expire within the
+// policy's warning period.  Callers log them again at the end of a run, so
+// the warning isn't lost in hours of output.
+//
+// Parameters:
+//   - now: The current time
+//
+// Returns:
+//   - []CookieExpiry: The expiring cookies, soonest first
+func (h *HTTPClient) ExpiringCookies(now time.Time) []CookieExpiry {
+	var expiring []CookieExpiry
+	for _, expiry := range h.cookieExpiry {
+		if !expiry.Expires.IsZero() && expiry.Expires.Before(now.Add(h.cookiePolicy.WarnWithin)) {
+			expiring = append(expiring, expiry)
+		}
+	}
+	sort.Slice(expiring, func(i, j int) bool { return expiring[i].Expires.Before(expiring[j].Expires) })
+	return expiring
+}
+
+// addCookie applies the cookie policy to a cookie read from a cookies file,
+// and adds it to the cookie jar if it passes.  Expired optional cookies are
+// skipped.
+//
+// Parameters:
+//   - cookie: The cookie.  A zero Expires means a session cookie.
+//   - now: The current time
+//
+// Returns:
+//   - error: ErrExpiredCookie if a required cookie has expired
+func (h *HTTPClient) addCookie(cookie *http.Cookie, now time.Time) error {
+	expired := !cookie.Expires.IsZero() && !cookie.Expires.After(now)
+	required := slices.Contains(h.cookiePolicy.Required, cookie.Name)
+	switch {
+	case expired && required:
+		return fmt.Errorf("%w: %s expired at %s", ErrExpiredCookie, cookie.Name, cookie.Expires.Format(time.RFC3339))
+	case expired:
+		h.logger.Debug("Skipping expired cookie", "cookie", cookie.Name, "expired", cookie.Expires)
+		return nil
+	}
+
+	// Create URL for the domain
+	scheme := "http"
+	if cookie.Secure {
+		scheme = "https"
+	}
+	cookieURL, err := url.Parse(fmt.Sprintf("%s://%s%s", scheme, cookie.Domain, cookie.Path))
+	if err != nil {
+		return fmt.Errorf("invalid URL for cookie %s: %w", cookie.Name, err)
+	}
+
+	if required {
+		h.cookieExpiry[cookie.Name] = CookieExpiry{Name: cookie.Name, Expires: cookie.Expires}
+	}
+	h.client.Jar.SetCookies(cookieURL, []*http.Cookie{cookie})
+	return nil
+}
+
+// checkRequiredCookies makes sure every required cookie was loaded, and
+// warns about any which are about to expire.
+//
+// Parameters:
+//   - now: The current time
+//
+// Returns:
+//   - error: ErrMissingCookie if a required cookie wasn't loaded
+func (h *HTTPClient) checkRequiredCookies(now time.Time) error {
+	for _, name := range h.cookiePolicy.Required {
+		_, ok := h.cookieExpiry[name]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrMissingCookie, name)
+		}
+	}
+	for _, expiry := range h.ExpiringCookies(now) {
+		h.logger.Warn("Cookie expires soon, update your cookies file",
+			"cookie", expiry.Name, "expires", expiry.Expires)
+	}
+	return nil
+}
+
+// describeCookieExpiry describes whether a cookie is in a cookies file, and
+// when it expires, for the cookies check subcommand.
+//
+// Parameters:
+//   - cookies: The cookies read from the file
+//   - name: The cookie to describe
+//   - now: The current time
+//   - warnWithin: How soon an expiry is worth warning about
+//
+// Returns:
+//   - string: A short description, e.g. "expires 2026-01-02T15:04:05Z (in 40 days)"
+func describeCookieExpiry(cookies []*http.Cookie, name string, now time.Time, warnWithin time.Duration) string {
+	// If a cookie is listed more than once, the last one wins, as in the jar.
+	var found *http.Cookie
+	for _, cookie := range cookies {
+		if cookie.Name == name {
+			found = cookie
+		}
+	}
+
+	switch {
+	case found == nil:
+		return "missing"
+	case found.Expires.IsZero():
+		return "session cookie, no expiry"
+	case !found.Expires.After(now):
+		return fmt.Sprintf("EXPIRED %s", found.Expires.UTC().Format(time.RFC3339))
+	}
+
+	days := int(found.Expires.Sub(now) / cookieExpiryDay)
+	description := fmt.Sprintf("expires %s (in %d days)", found.Expires.UTC().Format(time.RFC3339), days)
+	if found.Expires.Before(now.Add(warnWithin)) {
+		description += ", expiring soon"
+	}
+	return description
+}
@@ -0,0 +1,226 @@
+package main_test
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"fmt"
+	main "furtrap"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+// cookiesTxtLine builds a cookies.txt line for FA expiring at the given time,
+// or a session cookie if it is zero.
+func cookiesTxtLine(name string, expires time.Time) string {
+	var expiration int64
+	if !expires.IsZero() {
+		expiration = expires.Unix()
+	}
+	return fmt.Sprintf(".furaffinity.net\tTRUE\t/\tTRUE\t%d\t%s\t%s_value", expiration, name, name)
+}
+
+// writeCookiesFile writes a cookies.txt file with the given lines.
+func writeCookiesFile(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "cookies.txt")
+	content := "# Netscape HTTP Cookie File\n" + strings.Join(lines, "\n") + "\n"
+	err := os.WriteFile(path, []byte(content), 0600)
+	assert.NilError(t, err)
+	return path
+}
+
+func TestHTTPClient_CookiePolicy(t *testing.T) {
+	now := time.Now()
+	farFuture := now.Add(365 * 24 * time.Hour)
+	fiveDays := now.Add(5 * 24 * time.Hour)
+	yesterday := now.Add(-24 * time.Hour)
+
+	tests := []struct {
+		name     string
+		lines    []string
+		policy   *main.CookiePolicy
+		err      error
+		expiring []string
+	}{
+		{
+			name: "auth cookies valid",
+			lines: []string{
+				cookiesTxtLine("a", farFuture),
+				cookiesTxtLine("b", farFuture),
+			},
+		},
+		{
+			name: "expired optional cookies are skipped",
+			lines: []string{
+				cookiesTxtLine("a", farFuture),
+				cookiesTxtLine("b", farFuture),
+				cookiesTxtLine("__cf_bm", yesterday),
+			},
+		},
+		{
+			name: "session cookies don't expire",
+			lines: []string{
+				cookiesTxtLine("a", time.Time{}),
+				cookiesTxtLine("b", farFuture),
+			},
+		},
+		{
+			name: "auth cookies expiring soon are warned about",
+			lines: []string{
+				cookiesTxtLine("a", farFuture),
+				cookiesTxtLine("b", fiveDays),
+			},
+			expiring: []string{"b"},
+		},
+		{
+			name: "warning threshold is configurable",
+			lines: []string{
+				cookiesTxtLine("a", farFuture),
+				cookiesTxtLine("b", fiveDays),
+			},
+			policy: &main.CookiePolicy{Required: []string{"a", "b"}, WarnWithin: 24 * time.Hour},
+		},
+		{
+			name: "expired auth cookie",
+			lines: []string{
+				cookiesTxtLine("a", yesterday),
+				cookiesTxtLine("b", farFuture),
+			},
+			err: main.ErrExpiredCookie,
+		},
+		{
+			name: "missing auth cookie",
+			lines: []string{
+				cookiesTxtLine("a", farFuture),
+				cookiesTxtLine("other", farFuture),
+			},
+			err: main.ErrMissingCookie,
+		},
+		{
+			name: "nothing required",
+			lines: []string{
+				cookiesTxtLine("other", farFuture),
+			},
+			policy: &main.CookiePolicy{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := main.NewHTTPClient(NewTestLogger(t))
+			if tt.policy != nil {
+				client.SetCookiePolicy(*tt.policy)
+			}
+
+			err := client.LoadCookies(writeCookiesFile(t, tt.lines...))
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NilError(t, err)
+
+			var expiring []string
+			for _, expiry := range client.ExpiringCookies(now) {
+				expiring = append(expiring, expiry.Name)
+			}
+			assert.DeepEqual(t, expiring, tt.expiring)
+		})
+	}
+}
+
+func TestReadCookiesFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		format  main.CookieFormat
+		cookies []string
+		expires time.Time // Of the first cookie
+		err     error
+	}{
+		{
+			name: "cookies.txt",
+			content: "# Netscape HTTP Cookie File\n" +
+				".furaffinity.net\tTRUE\t/\tTRUE\t4070937600\ta\tauth_a\n" +
+				".furaffinity.net\tTRUE\t/\tTRUE\t0\tb\tauth_b\n",
+			format:  main.CookieFormatNetscape,
+			cookies: []string{"a=auth_a", "b=auth_b"},
+			expires: time.Unix(4070937600, 0),
+		},
+		{
+			name: "JSON export",
+			content: `[
+				{"domain": ".furaffinity.net", "expirationDate": 4070937600.5, "hostOnly": false,
+					"httpOnly": true, "name": "a", "path": "/", "sameSite": "no_restriction",
+					"secure": true, "session": false, "storeId": "0", "value": "auth_a", "id": 1},
+				{"domain": "www.furaffinity.net", "hostOnly": true, "name": "b", "path": "/",
+					"secure": true, "session": true, "value": "auth_b", "id": 2}
+			]`,
+			format:  main.CookieFormatJSON,
+			cookies: []string{"a=auth_a", "b=auth_b"},
+			expires: time.Unix(4070937600, int64(time.Second/2)),
+		},
+		{
+			name:    "Cookie header",
+			content: "Cookie: a=auth_a; b=auth_b; sz=1920x1080\n",
+			format:  main.CookieFormatHeader,
+			cookies: []string{"a=auth_a", "b=auth_b", "sz=1920x1080"},
+		},
+		{
+			name:    "Cookie header value only",
+			content: "a=auth_a; b=auth_b",
+			format:  main.CookieFormatHeader,
+			cookies: []string{"a=auth_a", "b=auth_b"},
+		},
+		{
+			name:    "JSON without a name",
+			content: `[{"domain": ".furaffinity.net", "value": "auth_a"}]`,
+			err:     main.ErrInvalidCookie,
+		},
+		{
+			name:    "malformed JSON",
+			content: `[{"domain": ".furaffinity.net"`,
+			err:     main.ErrInvalidCookie,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "cookies")
+			err := os.WriteFile(path, []byte(tt.content), 0600)
+			assert.NilError(t, err)
+
+			format, cookies, err := main.ReadCookiesFile(path)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, format, tt.format)
+
+			var have []string
+			for _, cookie := range cookies {
+				have = append(have, cookie.Name+"="+cookie.Value)
+			}
+			assert.DeepEqual(t, have, tt.cookies)
+			assert.Assert(t, cookies[0].Expires.Equal(tt.expires))
+		})
+	}
+
+	t.Run("same expiry rules for every format", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "cookies.json")
+		content := fmt.Sprintf(`[{"domain": ".furaffinity.net", "name": "a", "value": "1", "expirationDate": %d},
+			{"domain": ".furaffinity.net", "name": "b", "value": "2", "session": true}]`,
+			time.Now().Add(-time.Hour).Unix())
+		err := os.WriteFile(path, []byte(content), 0600)
+		assert.NilError(t, err)
+
+		client := main.NewHTTPClient(NewTestLogger(t))
+		err = client.LoadCookies(path)
+		assert.ErrorIs(t, err, main.ErrExpiredCookie)
+	})
+}
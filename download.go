@@ -0,0 +1,315 @@
+package main
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	// Submission files can be hundreds of megabytes, so downloads get much
+	// longer than httpTimeout.  An interrupted download resumes where it left
+	// off, so this only needs to catch connections which have stalled.
+	downloadTimeout = 30 * time.Minute
+
+	// Permissions for downloaded submission files.
+	downloadFilePermissions = 0600
+
+	// Suffix of a submission file while it's being downloaded
+	downloadPartSuffix = ".part"
+
+	// How many regex capture groups contentRangeRegexp should have.
+	contentRangeRegexpCaptures = 4
+)
+
+var (
+	ErrDownloadWrite      = errors.New("failed to write downloaded file")
+	ErrDownloadIncomplete = errors.New("download incomplete")
+	ErrDownloadMismatch   = errors.New("partial download doesn't match server")
+
+	// Regex to parse a Content-Range header, e.g. "bytes 100-199/200" or
+	// "bytes */200".  The total may be "*" if unknown.
+	contentRangeRegexp = regexp.MustCompile(`^bytes (?:(\d+)-(\d+)|\*)/(\d+|\*)$`)
+)
+
+// downloadFileWriter wraps the destination file of a download so local write
+// errors can be told apart from network read errors after io.Copy.
+type downloadFileWriter struct {
+	fh *os.File
+}
+
+// Write implements io.Writer, tagging errors with ErrDownloadWrite.
+//
+// Parameters:
+//   - p: The data to write
+//
+// Returns:
+//   - int: The number of bytes written
+//   - error: Any write error, wrapping ErrDownloadWrite
+func (w downloadFileWriter) Write(p []byte) (int, error) {
+	n, err := w.fh.Write(p)
+	if err != nil {
+		return n, fmt.Errorf("%w: %w", ErrDownloadWrite, err)
+	}
+	return n, nil
+}
+
+// Download streams the file at uri to filePath without holding it in memory.
+// The file is written to <filePath>.part, and only renamed into place once its
+// length has been verified against the server's Content-Length and it has
+// been fsynced, so filePath never holds a partial file.
+//
+// If a .part file is left from a failed attempt or an interrupted run, the
+// download resumes from where it left off using an HTTP Range request.  The
+// .part file's mtime is set to the server's Last-Modified, and sent back in
+// If-Range, so if the file has changed on the server since, the server sends
+// the whole new file instead and the download starts over.
+//
+// Failed attempts are retried like Get, resuming each time.  Local write
+// errors are not retried, and are reported wrapping ErrDownloadWrite.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - uri: The URL to download
+//   - filePath: Where to write the file
+//
+// Returns:
+//   - error: Any error encountered during the download, nil on success
+func (h *HTTPClient) Download(ctx context.Context, uri string, filePath string) error {
+	h.logger.Debug("HTTPClient download", "uri", uri, "file", filePath)
+	return h.withRetries(ctx, "download", uri, func() error {
+		return h.download(ctx, uri, filePath)
+	})
+}
+
+// download performs a single download attempt without retries. This is used
+// inside the public Download method's retry loop.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - uri: The URL to download
+//   - filePath: Where to write the file
+//
+// Returns:
+//   - error: Any error encountered during the attempt
+func (h *HTTPClient) download(ctx context.Context, uri string, filePath string) error {
+	err := h.waitForWindow(ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, downloadTimeout)
+	defer cancel()
+
+	partPath := filePath + downloadPartSuffix
+	offset, validator, err := existingPartFile(partPath)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", httpUserAgent)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", validator.UTC().Format(http.TimeFormat))
+	}
+
+	response, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("GET failed: %w", err)
+	}
+	defer func() { _ = response.Body.Close() }()
+
+	// Work out where the response body goes, and how long the file should be
+	// once it's written.
+	var flags int
+	var expectedSize int64
+	switch response.StatusCode {
+	case http.StatusOK:
+		// Either a fresh download, the file changed since the partial
+		// download, or the server ignored our Range header.  Either way,
+		// start over.
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		offset = 0
+		expectedSize = response.ContentLength
+	case http.StatusPartialContent:
+		start, total, ok := parseContentRange(response.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			return h.restartDownload(partPath, response.Header.Get("Content-Range"))
+		}
+		flags = os.O_WRONLY | os.O_APPEND
+		expectedSize = total
+	case http.StatusRequestedRangeNotSatisfiable:
+		// We asked for bytes past the end.  If we already have exactly the
+		// whole file, a previous attempt finished the download but didn't get
+		// to rename it into place.
+		_, total, ok := parseContentRange(response.Header.Get("Content-Range"))
+		if ok && total == offset {
+			err = syncFile(partPath)
+			if err != nil {
+				return err
+			}
+			return finishDownload(partPath, filePath)
+		}
+		return h.restartDownload(partPath, response.Header.Get("Content-Range"))
+	default:
+		return newHTTPStatusError(response)
+	}
+
+	//#nosec G304: partPath is built from a sanitized filename
+	fh, err := os.OpenFile(partPath, flags, downloadFilePermissions)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDownloadWrite, err)
+	}
+	defer func() { _ = fh.Close() }()
+
+	written, err := io.Copy(downloadFileWriter{fh: fh}, response.Body)
+
+	// Whatever made it to disk is kept for the next attempt to resume, as
+	// long as the server said which version of the file it is.
+	lastModified, lastModifiedErr := http.ParseTime(response.Header.Get("Last-Modified"))
+	if lastModifiedErr == nil {
+		_ = os.Chtimes(partPath, time.Time{}, lastModified)
+	}
+	if err != nil {
+		return fmt.Errorf("download interrupted after %d bytes: %w", offset+written, err)
+	}
+
+	// A size of -1 means the server didn't tell us, so there's nothing to
+	// check against.
+	if expectedSize >= 0 && offset+written != expectedSize {
+		return fmt.Errorf("%w: got %d of %d bytes", ErrDownloadIncomplete, offset+written, expectedSize)
+	}
+
+	err = fh.Sync()
+	if err != nil {
+		return fmt.Errorf("%w: failed to sync file: %w", ErrDownloadWrite, err)
+	}
+	err = fh.Close()
+	if err != nil {
+		return fmt.Errorf("%w: failed to close file: %w", ErrDownloadWrite, err)
+	}
+	return finishDownload(partPath, filePath)
+}
+
+// restartDownload discards a partial download which doesn't line up with what
+// the server has, so the next attempt starts from scratch.
+//
+// Parameters:
+//   - partPath: The partially downloaded file
+//   - contentRange: The Content-Range header the server sent, for the error
+//
+// Returns:
+//   - error: ErrDownloadMismatch, which is retried, or a local error removing the file
+func (h *HTTPClient) restartDownload(partPath string, contentRange string) error {
+	h.logger.Warn("Partial download doesn't match server, restarting", "file", partPath, "range", contentRange)
+	err := os.Remove(partPath)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDownloadWrite, err)
+	}
+	return fmt.Errorf("%w: Content-Range %q", ErrDownloadMismatch, contentRange)
+}
+
+// existingPartFile returns the size of a partial download, and the server's
+// Last-Modified time for it, or 0 if there isn't one.
+//
+// Parameters:
+//   - partPath: The .part file
+//
+// Returns:
+//   - int64: The size of the file, or 0 if it doesn't exist
+//   - time.Time: Its mtime, which is the server's Last-Modified if it sent one
+//   - error: Any error other than the file not existing, wrapping ErrDownloadWrite
+func existingPartFile(partPath string) (int64, time.Time, error) {
+	info, err := os.Stat(partPath)
+	switch {
+	case err == nil:
+		return info.Size(), info.ModTime(), nil
+	case errors.Is(err, fs.ErrNotExist):
+		return 0, time.Time{}, nil
+	default:
+		return 0, time.Time{}, fmt.Errorf("%w: %w", ErrDownloadWrite, err)
+	}
+}
+
+// syncFile fsyncs an existing file.  This is used when a download turns out to
+// be complete already, since we can't be sure the previous attempt got as far
+// as syncing it.
+//
+// Parameters:
+//   - filePath: The file to sync
+//
+// Returns:
+//   - error: Any error encountered, wrapping ErrDownloadWrite
+func syncFile(filePath string) error {
+	//#nosec G304: filePath is built from a sanitized filename
+	fh, err := os.OpenFile(filePath, os.O_WRONLY, downloadFilePermissions)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDownloadWrite, err)
+	}
+	defer func() { _ = fh.Close() }()
+
+	err = fh.Sync()
+	if err != nil {
+		return fmt.Errorf("%w: failed to sync file: %w", ErrDownloadWrite, err)
+	}
+	return nil
+}
+
+// finishDownload renames a complete, fsynced .part file into place.
+//
+// Parameters:
+//   - partPath: The complete .part file
+//   - filePath: Its final name
+//
+// Returns:
+//   - error: Any error encountered, wrapping ErrDownloadWrite
+func finishDownload(partPath string, filePath string) error {
+	err := os.Rename(partPath, filePath)
+	if err != nil {
+		return fmt.Errorf("%w: failed to rename file: %w", ErrDownloadWrite, err)
+	}
+	return nil
+}
+
+// parseContentRange parses a Content-Range response header.
+//
+// Parameters:
+//   - header: The header value, e.g. "bytes 100-199/200" or "bytes */200"
+//
+// Returns:
+//   - int64: The first byte position, or 0 for "bytes */N"
+//   - int64: The total length of the file
+//   - bool: false if the header is missing, malformed, or the total is unknown
+func parseContentRange(header string) (int64, int64, bool) {
+	matches := contentRangeRegexp.FindStringSubmatch(header)
+	if len(matches) != contentRangeRegexpCaptures {
+		return 0, 0, false
+	}
+
+	total, err := strconv.ParseInt(matches[3], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	if matches[1] == "" {
+		return 0, total, true
+	}
+
+	start, err := strconv.ParseInt(matches[1], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return start, total, true
+}
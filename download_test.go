@@ -0,0 +1,202 @@
+package main_test
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"bytes"
+	main "furtrap"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+// RangeHandler serves fixed content with support for Range and If-Range
+// requests, and records the Range and If-Range headers of every request it
+// receives.
+type RangeHandler struct {
+	content  []byte
+	modtime  time.Time
+	ranges   []string
+	ifRanges []string
+	// Number of upcoming requests to cut off halfway through the body
+	truncateRemaining int
+}
+
+func (h *RangeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.ranges = append(h.ranges, r.Header.Get("Range"))
+	h.ifRanges = append(h.ifRanges, r.Header.Get("If-Range"))
+
+	if h.truncateRemaining > 0 {
+		h.truncateRemaining--
+		// Promise the whole file, but only send half.  The client sees an
+		// unexpected EOF.
+		w.Header().Set("Content-Length", strconv.Itoa(len(h.content)))
+		w.Header().Set("Last-Modified", h.modtime.UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(h.content[:len(h.content)/2])
+		return
+	}
+
+	http.ServeContent(w, r, "file.bin", h.modtime, bytes.NewReader(h.content))
+}
+
+func TestHTTPClient_Download(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	modtime := time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC)
+	ifRange := "Wed, 01 May 2024 12:00:00 GMT"
+
+	newClient := func(t *testing.T) *main.HTTPClient {
+		t.Helper()
+		client := main.NewHTTPClient(NewTestLogger(t))
+		client.SetRetryPolicy(main.RetryPolicy{MaxAttempts: 3})
+		return client
+	}
+
+	// Leaves a partial download of the file last modified at mtime
+	writePart := func(t *testing.T, filePath string, data []byte, mtime time.Time) {
+		t.Helper()
+		err := os.WriteFile(filePath+".part", data, 0600)
+		assert.NilError(t, err)
+		err = os.Chtimes(filePath+".part", mtime, mtime)
+		assert.NilError(t, err)
+	}
+
+	// Checks the download ended up complete under its real name
+	assertDownloaded := func(t *testing.T, filePath string) {
+		t.Helper()
+		//#nosec G304: filename is from test data
+		have, err := os.ReadFile(filePath)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, have, content)
+		_, err = os.Stat(filePath + ".part")
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	}
+
+	t.Run("fresh download", func(t *testing.T) {
+		handler := &RangeHandler{content: content, modtime: modtime}
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		filePath := filepath.Join(t.TempDir(), "file.bin")
+		err := newClient(t).Download(t.Context(), server.URL, filePath)
+		assert.NilError(t, err)
+		assertDownloaded(t, filePath)
+		assert.DeepEqual(t, handler.ranges, []string{""})
+	})
+
+	t.Run("resumes a partial file", func(t *testing.T) {
+		handler := &RangeHandler{content: content, modtime: modtime}
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		filePath := filepath.Join(t.TempDir(), "file.bin")
+		writePart(t, filePath, content[:1234], modtime)
+
+		err := newClient(t).Download(t.Context(), server.URL, filePath)
+		assert.NilError(t, err)
+		assertDownloaded(t, filePath)
+		assert.DeepEqual(t, handler.ranges, []string{"bytes=1234-"})
+		assert.DeepEqual(t, handler.ifRanges, []string{ifRange})
+	})
+
+	t.Run("partial file of an older version is restarted", func(t *testing.T) {
+		handler := &RangeHandler{content: content, modtime: modtime}
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		filePath := filepath.Join(t.TempDir(), "file.bin")
+		writePart(t, filePath, []byte("old version"), modtime.Add(-time.Hour))
+
+		err := newClient(t).Download(t.Context(), server.URL, filePath)
+		assert.NilError(t, err)
+		assertDownloaded(t, filePath)
+		assert.DeepEqual(t, handler.ranges, []string{"bytes=11-"})
+	})
+
+	t.Run("complete partial file is renamed into place", func(t *testing.T) {
+		handler := &RangeHandler{content: content, modtime: modtime}
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		filePath := filepath.Join(t.TempDir(), "file.bin")
+		writePart(t, filePath, content, modtime)
+
+		err := newClient(t).Download(t.Context(), server.URL, filePath)
+		assert.NilError(t, err)
+		assertDownloaded(t, filePath)
+		assert.Equal(t, len(handler.ranges), 1)
+	})
+
+	t.Run("oversized partial file is discarded and restarted", func(t *testing.T) {
+		handler := &RangeHandler{content: content, modtime: modtime}
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		filePath := filepath.Join(t.TempDir(), "file.bin")
+		writePart(t, filePath, append(bytes.Clone(content), "extra"...), modtime)
+
+		err := newClient(t).Download(t.Context(), server.URL, filePath)
+		assert.NilError(t, err)
+		assertDownloaded(t, filePath)
+		assert.DeepEqual(t, handler.ranges, []string{"bytes=10005-", ""})
+	})
+
+	t.Run("interrupted download resumes on retry", func(t *testing.T) {
+		handler := &RangeHandler{content: content, modtime: modtime, truncateRemaining: 1}
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		filePath := filepath.Join(t.TempDir(), "file.bin")
+		err := newClient(t).Download(t.Context(), server.URL, filePath)
+		assert.NilError(t, err)
+		assertDownloaded(t, filePath)
+		assert.DeepEqual(t, handler.ranges, []string{"", "bytes=5000-"})
+		assert.DeepEqual(t, handler.ifRanges, []string{"", ifRange})
+	})
+
+	t.Run("incomplete after all retries", func(t *testing.T) {
+		handler := &RangeHandler{content: content, modtime: modtime, truncateRemaining: 3}
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		filePath := filepath.Join(t.TempDir(), "file.bin")
+		err := newClient(t).Download(t.Context(), server.URL, filePath)
+		assert.ErrorContains(t, err, "download interrupted")
+
+		// Nothing under the real name for other tools to pick up
+		_, err = os.Stat(filePath)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		info, err := os.Stat(filePath + ".part")
+		assert.NilError(t, err)
+		assert.Equal(t, info.Size(), int64(len(content)/2))
+	})
+	t.Run("404 creates no file", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		defer server.Close()
+
+		dir := t.TempDir()
+		err := newClient(t).Download(t.Context(), server.URL, filepath.Join(dir, "file.bin"))
+		assert.ErrorIs(t, err, main.ErrHTTPNotFound)
+
+		files, err := os.ReadDir(dir)
+		assert.NilError(t, err)
+		assert.Equal(t, len(files), 0)
+	})
+
+	t.Run("local write errors are not retried", func(t *testing.T) {
+		handler := &RangeHandler{content: content, modtime: modtime}
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		filePath := filepath.Join(t.TempDir(), "nonexistent", "file.bin")
+		err := newClient(t).Download(t.Context(), server.URL, filePath)
+		assert.ErrorIs(t, err, main.ErrDownloadWrite)
+		assert.Equal(t, len(handler.ranges), 1)
+	})
+}
@@ -0,0 +1,365 @@
+package main
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// Name of the failure ledger file in the output directory.
+	failureLedgerFilename = "failures.json"
+
+	// Kinds of failure recorded in the ledger.
+	failureKindArtist     = "artist"
+	failureKindSubmission = "submission"
+	failureKindFavorites  = "favorites"
+	failureKindJournal    = "journal"
+	failureKindProfile    = "profile"
+	failureKindInbox      = "inbox"
+	failureKindSearch     = "search"
+)
+
+var (
+	ErrFailureLedgerInvalid = errors.New("invalid failure ledger entry")
+)
+
+// FailureEntry is a single record in the failure ledger, describing an artist
+// or submission which could not be downloaded.
+type FailureEntry struct {
+	Kind     string       `json:"kind"`              // "artist", "submission", "journal", "profile", "favorites", "inbox" or "search"
+	ID       uint64       `json:"id,omitempty"`      // Submission or journal ID, unset for artists and lists
+	Artist   string       `json:"artist"`            // For favorites, whose they are.  Unset for the inbox and searches
+	Folders  []string     `json:"folders,omitempty"` // For artists, the folder filter, if any
+	Search   *SearchQuery `json:"search,omitempty"`  // For searches, what to search for
+	Dir      string       `json:"dir"`               // Relative to the output dir, slash separated
+	URL      string       `json:"url"`
+	Error    string       `json:"error"`
+	Attempts int          `json:"attempts"` // Number of runs which have failed on this
+	FailedAt time.Time    `json:"failed_at"`
+}
+
+// FailureLedger is a JSON file in the output directory listing everything a
+// run in continue-on-error mode had to skip.  Entries are added as failures
+// happen and removed once a later run, or the retry-failed subcommand,
+// succeeds.  The file is rewritten atomically on every change, so it is
+// always consistent even if the run is interrupted.
+type FailureLedger struct {
+	logger    *slog.Logger
+	outputDir string
+	entries   []FailureEntry
+}
+
+// OpenFailureLedger loads the failure ledger from the output directory.  A
+// missing ledger is treated as empty.  The file isn't created until there is
+// a failure to record.
+//
+// Parameters:
+//   - logger: Logger instance
+//   - outputDir: The root of the output tree
+//
+// Returns:
+//   - *FailureLedger: The loaded ledger
+//   - error: Any error encountered while reading or parsing the ledger
+func OpenFailureLedger(logger *slog.Logger, outputDir string) (*FailureLedger, error) {
+	ledger := &FailureLedger{
+		logger:    logger,
+		outputDir: outputDir,
+	}
+
+	found, err := readJSONFile(ledger.Path(), &ledger.entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load failure ledger: %w", err)
+	}
+	if !found {
+		return ledger, nil
+	}
+
+	logger.Debug("Loaded failure ledger", "entries", len(ledger.entries))
+	return ledger, nil
+}
+
+// Path returns the path of the ledger file.
+//
+// Returns:
+//   - string: The path of the ledger file
+func (l *FailureLedger) Path() string {
+	return filepath.Join(l.outputDir, failureLedgerFilename)
+}
+
+// Entries returns a copy of the entries in the ledger, oldest first.
+//
+// Returns:
+//   - []FailureEntry: The recorded failures
+func (l *FailureLedger) Entries() []FailureEntry {
+	return append([]FailureEntry(nil), l.entries...)
+}
+
+// Record adds a failure to the ledger and saves it.  If the same artist or
+// submission has already failed, that entry is updated and its attempt count
+// incremented.
+//
+// Parameters:
+//   - entry: Identifies what failed, as built by artistFailure or submissionFailure
+//   - cause: The error which caused the failure
+//
+// Returns:
+//   - error: Any error encountered while saving the ledger
+func (l *FailureLedger) Record(entry FailureEntry, cause error) error {
+	entry, err := l.normalize(entry)
+	if err != nil {
+		return err
+	}
+	entry.Error = cause.Error()
+	entry.FailedAt = time.Now().UTC()
+	entry.Attempts = 1
+
+	i := l.find(entry)
+	if i < 0 {
+		l.entries = append(l.entries, entry)
+	} else {
+		entry.Attempts = l.entries[i].Attempts + 1
+		l.entries[i] = entry
+	}
+	return l.save()
+}
+
+// Resolve removes an entry from the ledger after the artist or submission has
+// succeeded.  The ledger is only rewritten if the entry was present.
+//
+// Parameters:
+//   - entry: Identifies what succeeded, as built by artistFailure or submissionFailure
+//
+// Returns:
+//   - error: Any error encountered while saving the ledger
+func (l *FailureLedger) Resolve(entry FailureEntry) error {
+	entry, err := l.normalize(entry)
+	if err != nil {
+		return err
+	}
+
+	i := l.find(entry)
+	if i < 0 {
+		return nil
+	}
+	l.entries = append(l.entries[:i], l.entries[i+1:]...)
+	return l.save()
+}
+
+// LocalDir converts an entry's directory back into a path under the output
+// directory.  Entries are read from a file on disk, so this refuses anything
+// which would escape the output directory.
+//
+// Parameters:
+//   - entry: A ledger entry
+//
+// Returns:
+//   - string: The directory the artist or submission is saved in
+//   - error: ErrFailureLedgerInvalid if the directory isn't inside the output dir
+func (l *FailureLedger) LocalDir(entry FailureEntry) (string, error) {
+	dir := filepath.FromSlash(entry.Dir)
+	if !filepath.IsLocal(dir) {
+		return "", fmt.Errorf("%w: directory %q", ErrFailureLedgerInvalid, entry.Dir)
+	}
+	return filepath.Join(l.outputDir, dir), nil
+}
+
+// normalize converts an entry's directory to the slash separated form stored
+// in the ledger, relative to the output directory.
+//
+// Parameters:
+//   - entry: An entry with an absolute or working-directory-relative Dir
+//
+// Returns:
+//   - FailureEntry: The entry with Dir relative to the output dir
+//   - error: An error if Dir can't be expressed relative to the output dir
+func (l *FailureLedger) normalize(entry FailureEntry) (FailureEntry, error) {
+	relDir, err := filepath.Rel(l.outputDir, entry.Dir)
+	if err != nil {
+		return FailureEntry{}, fmt.Errorf("failed to find relative path: %w", err)
+	}
+	entry.Dir = filepath.ToSlash(relDir)
+	return entry, nil
+}
+
+// find returns the position of the ledger entry for the same artist,
+// submission or favorites list as entry.
+//
+// Parameters:
+//   - entry: A normalized entry
+//
+// Returns:
+//   - int: The index of the matching entry, or -1 if there isn't one
+func (l *FailureLedger) find(entry FailureEntry) int {
+	for i, existing := range l.entries {
+		if existing.Kind == entry.Kind && existing.Dir == entry.Dir && existing.ID == entry.ID &&
+			existing.Artist == entry.Artist && searchName(existing.Search) == searchName(entry.Search) {
+			return i
+		}
+	}
+	return -1
+}
+
+// save writes the ledger to disk.  An empty ledger is removed instead, so a
+// clean output directory has no ledger at all.
+//
+// Returns:
+//   - error: Any error encountered while writing or removing the file
+func (l *FailureLedger) save() error {
+	if len(l.entries) == 0 {
+		err := os.Remove(l.Path())
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove failure ledger: %w", err)
+		}
+		return nil
+	}
+
+	// An artist can fail before anything has been saved.
+	err := os.MkdirAll(l.outputDir, submissionDirPermissions)
+	if err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	err = writeJSONFileAtomic(l.Path(), l.entries)
+	if err != nil {
+		return fmt.Errorf("failed to write failure ledger: %w", err)
+	}
+	return nil
+}
+
+// artistFailure builds a ledger entry identifying an artist.
+//
+// Parameters:
+//   - artist: The artist
+//
+// Returns:
+//   - FailureEntry: An entry for use with Record and Resolve
+func artistFailure(artist *Artist) FailureEntry {
+	return FailureEntry{
+		Kind:    failureKindArtist,
+		Artist:  artist.Username(),
+		Folders: artist.FolderFilter(),
+		Dir:     artist.Dir(),
+		URL:     artist.URL(),
+	}
+}
+
+// submissionFailure builds a ledger entry identifying a submission.
+//
+// Parameters:
+//   - artistName: The artist the submission belongs to
+//   - submission: The submission
+//
+// Returns:
+//   - FailureEntry: An entry for use with Record and Resolve
+func submissionFailure(artistName string, submission *Submission) FailureEntry {
+	return FailureEntry{
+		Kind:   failureKindSubmission,
+		ID:     submission.ID(),
+		Artist: artistName,
+		Dir:    submission.Dir(),
+		URL:    submission.URL(),
+	}
+}
+
+// profileFailure builds a ledger entry identifying an artist's profile.
+//
+// Parameters:
+//   - artist: The artist
+//
+// Returns:
+//   - FailureEntry: An entry for use with Record and Resolve
+func profileFailure(artist *Artist) FailureEntry {
+	return FailureEntry{
+		Kind:   failureKindProfile,
+		Artist: artist.Username(),
+		Dir:    artist.Dir(),
+		URL:    artist.ProfileURL(),
+	}
+}
+
+// journalFailure builds a ledger entry identifying a journal.
+//
+// Parameters:
+//   - artistName: The artist the journal belongs to
+//   - journal: The journal
+//
+// Returns:
+//   - FailureEntry: An entry for use with Record and Resolve
+func journalFailure(artistName string, journal *Journal) FailureEntry {
+	return FailureEntry{
+		Kind:   failureKindJournal,
+		ID:     journal.ID(),
+		Artist: artistName,
+		Dir:    journal.Dir(),
+		URL:    journal.URL(),
+	}
+}
+
+// favoritesFailure builds a ledger entry identifying a user's favorites.
+//
+// Parameters:
+//   - favorites: The favorites
+//
+// Returns:
+//   - FailureEntry: An entry for use with Record and Resolve
+func favoritesFailure(favorites *Favorites) FailureEntry {
+	return FailureEntry{
+		Kind:   failureKindFavorites,
+		Artist: favorites.Username(),
+		Dir:    filepath.Dir(favorites.Path()),
+		URL:    favorites.URL(),
+	}
+}
+
+// inboxFailure builds a ledger entry identifying the submission inbox.
+//
+// Parameters:
+//   - inbox: The inbox
+//
+// Returns:
+//   - FailureEntry: An entry for use with Record and Resolve
+func inboxFailure(inbox *Inbox) FailureEntry {
+	return FailureEntry{
+		Kind: failureKindInbox,
+		Dir:  filepath.Dir(inbox.Path()),
+		URL:  inbox.URL(),
+	}
+}
+
+// searchFailure builds a ledger entry identifying a search.
+//
+// Parameters:
+//   - search: The search
+//
+// Returns:
+//   - FailureEntry: An entry for use with Record and Resolve
+func searchFailure(search *Search) FailureEntry {
+	query := search.Query()
+	return FailureEntry{
+		Kind:   failureKindSearch,
+		Search: &query,
+		Dir:    filepath.Dir(search.Path()),
+		URL:    search.URL(),
+	}
+}
+
+// searchName identifies the search in a ledger entry, if any.
+//
+// Parameters:
+//   - search: The entry's search, or nil
+//
+// Returns:
+//   - string: The search's name, or empty if there isn't one
+func searchName(search *SearchQuery) string {
+	if search == nil {
+		return ""
+	}
+	return search.Name()
+}
@@ -0,0 +1,135 @@
+package main_test
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"errors"
+	main "furtrap"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestScraper_ContinueOnError(t *testing.T) {
+	const artist = "artist-with-two-submissions"
+
+	t.Run("failed submission is recorded and the run continues", func(t *testing.T) {
+		tempdir := t.TempDir()
+		client := NewTestClient()
+		client.SetResponse("https://www.furaffinity.net/view/102", nil,
+			errors.New("network error")) //nolint:err113 // dynamic test error
+
+		scraper := main.NewScraper(NewTestLogger(t), client, "", []string{artist}, false, false, tempdir)
+		scraper.SetContinueOnError(true)
+		err := scraper.Run(t.Context())
+		assert.NilError(t, err)
+
+		assert.DeepEqual(t, scraper.Summary(), main.RunSummary{
+			ArtistsTotal:     1,
+			ArtistsCompleted: 1,
+			Submissions:      3,
+			Failures:         1,
+		})
+		assert.Equal(t, len(readArchiveIndex(t, tempdir)), 3)
+
+		entries := readJSON[[]main.FailureEntry](t, filepath.Join(tempdir, "failures.json"))
+		assert.Equal(t, len(entries), 1)
+		assert.Equal(t, entries[0].Kind, "submission")
+		assert.Equal(t, entries[0].ID, uint64(102))
+		assert.Equal(t, entries[0].Artist, artist)
+		assert.Equal(t, entries[0].Dir, artist)
+		assert.Equal(t, entries[0].URL, "https://www.furaffinity.net/view/102")
+		assert.Equal(t, entries[0].Error, "failed to get submission page: network error")
+		assert.Equal(t, entries[0].Attempts, 1)
+		assert.Assert(t, !entries[0].FailedAt.IsZero())
+
+		// Failing again bumps the attempt count
+		scraper = main.NewScraper(NewTestLogger(t), client, "", nil, false, false, tempdir)
+		err = scraper.RetryFailed(t.Context())
+		assert.NilError(t, err)
+		entries = readJSON[[]main.FailureEntry](t, filepath.Join(tempdir, "failures.json"))
+		assert.Equal(t, len(entries), 1)
+		assert.Equal(t, entries[0].Attempts, 2)
+
+		// Once the problem is fixed, retry-failed saves it and the ledger goes away
+		scraper = main.NewScraper(NewTestLogger(t), NewTestClient(), "", nil, false, false, tempdir)
+		err = scraper.RetryFailed(t.Context())
+		assert.NilError(t, err)
+		assert.DeepEqual(t, scraper.Summary(), main.RunSummary{Submissions: 1})
+		assert.Equal(t, len(readArchiveIndex(t, tempdir)), 4)
+		_, err = os.Stat(filepath.Join(tempdir, "failures.json"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("failed artist is recorded and retried", func(t *testing.T) {
+		tempdir := t.TempDir()
+		client := NewTestClient()
+		client.SetResponse("https://www.furaffinity.net/gallery/"+artist+"/1", nil,
+			errors.New("network error")) //nolint:err113 // dynamic test error
+
+		scraper := main.NewScraper(NewTestLogger(t), client, "", []string{artist}, false, false, tempdir)
+		scraper.SetContinueOnError(true)
+		err := scraper.Run(t.Context())
+		assert.NilError(t, err)
+		assert.DeepEqual(t, scraper.Summary(), main.RunSummary{ArtistsTotal: 1, Failures: 1})
+
+		entries := readJSON[[]main.FailureEntry](t, filepath.Join(tempdir, "failures.json"))
+		assert.Equal(t, len(entries), 1)
+		assert.Equal(t, entries[0].Kind, "artist")
+		assert.Equal(t, entries[0].Artist, artist)
+		assert.Equal(t, entries[0].URL, "https://www.furaffinity.net/gallery/"+artist+"/")
+
+		scraper = main.NewScraper(NewTestLogger(t), NewTestClient(), "", nil, false, false, tempdir)
+		err = scraper.RetryFailed(t.Context())
+		assert.NilError(t, err)
+		assert.DeepEqual(t, scraper.Summary(), main.RunSummary{
+			ArtistsTotal:     1,
+			ArtistsCompleted: 1,
+			Submissions:      4,
+		})
+		_, err = os.Stat(filepath.Join(tempdir, "failures.json"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("without continue-on-error the run stops", func(t *testing.T) {
+		tempdir := t.TempDir()
+		client := NewTestClient()
+		client.SetResponse("https://www.furaffinity.net/view/102", nil,
+			errors.New("network error")) //nolint:err113 // dynamic test error
+
+		scraper := main.NewScraper(NewTestLogger(t), client, "", []string{artist}, false, false, tempdir)
+		err := scraper.Run(t.Context())
+		assert.ErrorContains(t, err, "network error")
+		_, err = os.Stat(filepath.Join(tempdir, "failures.json"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("running out of throttle budget stops the run anyway", func(t *testing.T) {
+		tempdir := t.TempDir()
+		client := NewTestClient()
+		client.SetResponse("https://www.furaffinity.net/view/102", nil, main.ErrThrottleBudgetExceeded)
+
+		scraper := main.NewScraper(NewTestLogger(t), client, "", []string{artist}, false, false, tempdir)
+		scraper.SetContinueOnError(true)
+		err := scraper.Run(t.Context())
+		assert.ErrorIs(t, err, main.ErrThrottleBudgetExceeded)
+		_, err = os.Stat(filepath.Join(tempdir, "failures.json"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("entries outside the output dir are skipped", func(t *testing.T) {
+		tempdir := t.TempDir()
+		err := os.WriteFile(filepath.Join(tempdir, "failures.json"),
+			[]byte(`[{"kind": "submission", "id": 101, "artist": "x", "dir": "../escape"}]`), 0600)
+		assert.NilError(t, err)
+
+		scraper := main.NewScraper(NewTestLogger(t), NewTestClient(), "", nil, false, false, tempdir)
+		err = scraper.RetryFailed(t.Context())
+		assert.NilError(t, err)
+		assert.DeepEqual(t, scraper.Summary(), main.RunSummary{})
+		_, err = os.Stat(filepath.Join(filepath.Dir(tempdir), "escape"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
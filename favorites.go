@@ -0,0 +1,207 @@
+package main
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	// Directory under the output dir where favorites lists are recorded.
+	favoritesDirname = "favorites"
+)
+
+var (
+	// Regex matching the "next" link on a favorites page.  Favorites are
+	// paginated by a cursor rather than a page number, e.g.
+	// /favorites/<user>/1234567890/next
+	favoritesNextRegexp = regexp.MustCompile(`^/favorites/[^/]+/\d+/next/?$`)
+)
+
+// FavoritesList is the record of a user's favorites saved in the favorites
+// directory, most recently favorited first.
+type FavoritesList struct {
+	User string `json:"user"`
+	SubmissionList
+}
+
+// Favorites crawls a user's favorites.  The favorited submissions themselves
+// belong to other artists, so saving them is left to the caller.  This only
+// finds them and keeps the record of which submissions are in the list.
+type Favorites struct {
+	logger    *slog.Logger
+	client    Client
+	username  string
+	outputDir string
+}
+
+// NewFavorites creates a new Favorites instance for the specified user.
+//
+// Parameters:
+//   - logger: Logger instance
+//   - client: HTTP client interface for making web requests
+//   - username: The FurAffinity username whose favorites should be crawled
+//   - outputDir: The root of the output tree
+//
+// Returns:
+//   - *Favorites: A new Favorites instance ready for use
+func NewFavorites(logger *slog.Logger, client Client, username string, outputDir string) *Favorites {
+	return &Favorites{
+		logger:    logger,
+		client:    client,
+		username:  username,
+		outputDir: outputDir,
+	}
+}
+
+// Username returns the user whose favorites these are.
+//
+// Returns:
+//   - string: The username
+func (f *Favorites) Username() string {
+	return f.username
+}
+
+// URL returns the address of the first page of favorites.
+//
+// Returns:
+//   - string: The favorites URL
+func (f *Favorites) URL() string {
+	return fmt.Sprintf("https://www.furaffinity.net/favorites/%s/", f.username)
+}
+
+// Path returns where the favorites list is recorded.
+//
+// Returns:
+//   - string: The path of the favorites list JSON file
+func (f *Favorites) Path() string {
+	return filepath.Join(f.outputDir, favoritesDirname, f.username+".json")
+}
+
+// Load reads the previously recorded favorites list.  A list which hasn't
+// been recorded yet is returned empty.
+//
+// Returns:
+//   - *FavoritesList: The recorded list
+//   - error: Any error reading or parsing the list
+func (f *Favorites) Load() (*FavoritesList, error) {
+	list := &FavoritesList{User: f.username}
+
+	_, err := readJSONFile(f.Path(), list)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load favorites list: %w", err)
+	}
+	return list, nil
+}
+
+// Crawl follows the "next" links through the user's favorites, newest first.
+// Unless reCrawl is set, it stops after the first page with nothing that
+// isn't already in the recorded list, the same way crawlSubmissions stops at
+// the first saved submission.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - reCrawl: If true, crawl the whole list
+//
+// Returns:
+//   - []ListedSubmission: The favorites found, most recently favorited first
+//   - error: Any error fetching the pages, or a *SiteLayoutError
+func (f *Favorites) Crawl(ctx context.Context, reCrawl bool) ([]ListedSubmission, error) {
+	f.logger.Debug("getting favorites", "user", f.username, "reCrawl", reCrawl)
+
+	recorded, err := f.Load()
+	if err != nil {
+		return nil, err
+	}
+	known := recorded.known()
+
+	listing := &listingCrawl[ListedSubmission]{
+		name:     "favorites",
+		firstURL: f.URL(),
+		logArgs:  []any{"user", f.username},
+		fetchPage: func(ctx context.Context, url string, _ int) ([]byte, error) {
+			return f.client.GetWithDelay(ctx, url)
+		},
+		nextPage: func(url string, body []byte, _ int) ([]ListedSubmission, string, error) {
+			entries, next, err := parseFavoritesPage(url, body)
+			if next != "" {
+				next = "https://www.furaffinity.net" + next
+			}
+			return entries, next, err
+		},
+		isKnown: func(entry ListedSubmission) bool { return known[entry.ID] },
+	}
+	return listing.crawl(ctx, f.logger, reCrawl)
+}
+
+// Record saves the favorites list, merging newly crawled entries with the
+// previously recorded ones.  This should be called once the crawled
+// submissions have been saved, so an interrupted run crawls them again.
+//
+// Parameters:
+//   - crawled: The entries returned by Crawl
+//   - complete: If true, crawled is the whole list, and replaces the record so
+//     unfavorited submissions are dropped
+//
+// Returns:
+//   - error: Any error reading or writing the list
+func (f *Favorites) Record(crawled []ListedSubmission, complete bool) error {
+	list, err := f.Load()
+	if err != nil {
+		return err
+	}
+
+	err = recordListed(f.Path(), list, &list.SubmissionList, crawled, complete)
+	if err != nil {
+		return fmt.Errorf("failed to record favorites list: %w", err)
+	}
+	return nil
+}
+
+// parseFavoritesPage extracts the favorited submissions and the "next" link
+// from a favorites page.
+//
+// Parameters:
+//   - url: The URL of the page, for error reporting
+//   - body: The HTML content of the page
+//
+// Returns:
+//   - []ListedSubmission: The favorites on this page
+//   - string: The path of the next page, or empty on the last page
+//   - error: A *SiteLayoutError if the page isn't in the expected format
+func parseFavoritesPage(url string, body []byte) ([]ListedSubmission, string, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		// goquery only fails if reading fails, which can't happen with an
+		// in-memory byte slice.
+		return nil, "", fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	entries, err := parseSubmissionFigures(url, body, doc)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// The "next" button is a link in some templates and a form in others.
+	var next string
+	doc.Find("a[href], form[action]").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		target, ok := s.Attr("href")
+		if !ok {
+			target, _ = s.Attr("action")
+		}
+		if favoritesNextRegexp.MatchString(target) {
+			next = target
+			return false
+		}
+		return true
+	})
+
+	return entries, next, nil
+}
@@ -0,0 +1,197 @@
+package main_test
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"errors"
+	main "furtrap"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+const (
+	favoritesUser  = "test-favoriter"
+	favoritesPage1 = "https://www.furaffinity.net/favorites/test-favoriter/"
+	favoritesPage2 = "https://www.furaffinity.net/favorites/test-favoriter/1234/next"
+
+	// The section a favorites page lists submissions in, and the "next"
+	// button linking to favoritesPage2
+	favoritesSection = "class='gallery'"
+	favoritesNext    = "<form action='/favorites/test-favoriter/1234/next' method='get'>" +
+		"<button type='submit'>Next</button></form>"
+)
+
+// favoritesPages are two pages of favorites: 104 (a scrap) and 102, then 101.
+var favoritesPages = map[string][]byte{
+	favoritesPage1: listingPage(favoritesSection, favoritesNext, 104, 102),
+	favoritesPage2: listingPage(favoritesSection, "", 101),
+}
+
+func TestFavorites_Crawl(t *testing.T) {
+	allEntries := []main.ListedSubmission{
+		{ID: 104, Artist: listedArtist},
+		{ID: 102, Artist: listedArtist},
+		{ID: 101, Artist: listedArtist},
+	}
+
+	t.Run("follows next links to the end", func(t *testing.T) {
+		favorites := main.NewFavorites(NewTestLogger(t), newPagesTestClient(favoritesPages), favoritesUser, t.TempDir())
+		assert.Equal(t, favorites.URL(), favoritesPage1)
+
+		have, err := favorites.Crawl(t.Context(), false)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, have, allEntries)
+	})
+
+	t.Run("stops at a page with nothing new", func(t *testing.T) {
+		tempdir := t.TempDir()
+		favorites := main.NewFavorites(NewTestLogger(t), newPagesTestClient(favoritesPages), favoritesUser, tempdir)
+		err := favorites.Record(allEntries[:2], true)
+		assert.NilError(t, err)
+
+		have, err := favorites.Crawl(t.Context(), false)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, have, allEntries[:2])
+
+		// Unless re-crawling
+		have, err = favorites.Crawl(t.Context(), true)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, have, allEntries)
+	})
+
+	t.Run("fetch errors are returned", func(t *testing.T) {
+		client := newPagesTestClient(favoritesPages)
+		client.SetResponse(favoritesPage2, nil, errors.New("network error")) //nolint:err113 // dynamic test error
+		favorites := main.NewFavorites(NewTestLogger(t), client, favoritesUser, t.TempDir())
+
+		_, err := favorites.Crawl(t.Context(), false)
+		assert.ErrorContains(t, err, "network error")
+	})
+
+	t.Run("non-numeric ID is a layout error", func(t *testing.T) {
+		client := NewTestClient()
+		client.SetResponse(favoritesPage1, []byte("<figure id='sid-abc'></figure>"), nil)
+		favorites := main.NewFavorites(NewTestLogger(t), client, favoritesUser, t.TempDir())
+
+		_, err := favorites.Crawl(t.Context(), false)
+		assert.ErrorIs(t, err, main.ErrSiteLayoutChanged)
+	})
+
+	t.Run("next link loop is a layout error", func(t *testing.T) {
+		client := NewTestClient()
+		client.SetResponse(favoritesPage1, listingPage(favoritesSection, favoritesNext, 101), nil)
+		client.SetResponse(favoritesPage2, listingPage(favoritesSection, favoritesNext, 101), nil)
+		favorites := main.NewFavorites(NewTestLogger(t), client, favoritesUser, t.TempDir())
+
+		_, err := favorites.Crawl(t.Context(), true)
+		assert.ErrorIs(t, err, main.ErrSiteLayoutChanged)
+	})
+}
+
+func TestFavorites_Record(t *testing.T) {
+	tempdir := t.TempDir()
+	favorites := main.NewFavorites(NewTestLogger(t), NewTestClient(), favoritesUser, tempdir)
+	assert.Equal(t, favorites.Path(), filepath.Join(tempdir, "favorites", favoritesUser+".json"))
+
+	list, err := favorites.Load()
+	assert.NilError(t, err)
+	assert.Equal(t, len(list.Submissions), 0)
+
+	err = favorites.Record([]main.ListedSubmission{{ID: 102}, {ID: 101}}, false)
+	assert.NilError(t, err)
+
+	// New favorites go ahead of the old ones
+	err = favorites.Record([]main.ListedSubmission{{ID: 104}, {ID: 102}}, false)
+	assert.NilError(t, err)
+	list, err = favorites.Load()
+	assert.NilError(t, err)
+	assert.Equal(t, list.User, favoritesUser)
+	assert.Assert(t, !list.UpdatedAt.IsZero())
+	assert.DeepEqual(t, list.Submissions, []main.ListedSubmission{{ID: 104}, {ID: 102}, {ID: 101}})
+
+	// A complete list replaces the record, dropping unfavorited submissions
+	err = favorites.Record([]main.ListedSubmission{{ID: 104}}, true)
+	assert.NilError(t, err)
+	list, err = favorites.Load()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, list.Submissions, []main.ListedSubmission{{ID: 104}})
+}
+
+func TestScraper_Favorites(t *testing.T) {
+	t.Run("favorites are saved in their artists' directories", func(t *testing.T) {
+		tempdir := t.TempDir()
+		scraper := main.NewScraper(NewTestLogger(t), newPagesTestClient(favoritesPages), "", nil, false, false, tempdir)
+		scraper.SetFavorites([]string{favoritesUser})
+		err := scraper.Run(t.Context())
+		assert.NilError(t, err)
+		assert.DeepEqual(t, scraper.Summary(), main.RunSummary{Submissions: 3})
+
+		for _, fn := range []string{
+			"artist-with-two-submissions/1111111111.artist-with-two-submissions_test-image-1.jpg.101.html",
+			"artist-with-two-submissions/2222222222.artist-with-two-submissions_test-image-2.png.102.html",
+			"artist-with-two-submissions/scraps/4444444444.artist-with-two-submissions_scrap-image-2.png.104.html",
+		} {
+			_, err := os.Stat(filepath.Join(tempdir, fn))
+			assert.NilError(t, err, fn)
+		}
+
+		list := readJSON[main.FavoritesList](t, filepath.Join(tempdir, "favorites", favoritesUser+".json"))
+		assert.Equal(t, list.User, favoritesUser)
+		assert.Equal(t, len(list.Submissions), 3)
+
+		// A second run finds nothing new, and fetches no submissions
+		client := newPagesTestClient(favoritesPages)
+		client.SetResponse("https://www.furaffinity.net/view/104", nil,
+			errors.New("should not be fetched")) //nolint:err113 // dynamic test error
+		scraper = main.NewScraper(NewTestLogger(t), client, "", nil, false, false, tempdir)
+		scraper.SetFavorites([]string{favoritesUser})
+		scraper.SetContinueOnError(true)
+		err = scraper.Run(t.Context())
+		assert.NilError(t, err)
+		assert.DeepEqual(t, scraper.Summary(), main.RunSummary{})
+	})
+
+	t.Run("failed favorites are recorded and retried", func(t *testing.T) {
+		tempdir := t.TempDir()
+		client := newPagesTestClient(favoritesPages)
+		client.SetResponse(favoritesPage1, nil, errors.New("network error")) //nolint:err113 // dynamic test error
+
+		scraper := main.NewScraper(NewTestLogger(t), client, "", nil, false, false, tempdir)
+		scraper.SetFavorites([]string{favoritesUser})
+		scraper.SetContinueOnError(true)
+		err := scraper.Run(t.Context())
+		assert.NilError(t, err)
+		assert.DeepEqual(t, scraper.Summary(), main.RunSummary{Failures: 1})
+
+		entries := readJSON[[]main.FailureEntry](t, filepath.Join(tempdir, "failures.json"))
+		assert.Equal(t, len(entries), 1)
+		assert.Equal(t, entries[0].Kind, "favorites")
+		assert.Equal(t, entries[0].Artist, favoritesUser)
+		assert.Equal(t, entries[0].URL, favoritesPage1)
+
+		scraper = main.NewScraper(NewTestLogger(t), newPagesTestClient(favoritesPages), "", nil, false, false, tempdir)
+		err = scraper.RetryFailed(t.Context())
+		assert.NilError(t, err)
+		assert.DeepEqual(t, scraper.Summary(), main.RunSummary{Submissions: 3})
+		_, err = os.Stat(filepath.Join(tempdir, "failures.json"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("layout errors save a diagnostic page", func(t *testing.T) {
+		tempdir := t.TempDir()
+		client := NewTestClient()
+		client.SetResponse(favoritesPage1, []byte("<figure id='sid-abc'></figure>"), nil)
+
+		scraper := main.NewScraper(NewTestLogger(t), client, "", nil, false, false, tempdir)
+		scraper.SetFavorites([]string{favoritesUser})
+		err := scraper.Run(t.Context())
+		assert.ErrorIs(t, err, main.ErrSiteLayoutChanged)
+
+		diagnostics, err := os.ReadDir(filepath.Join(tempdir, "diagnostics"))
+		assert.NilError(t, err)
+		assert.Equal(t, len(diagnostics), 1)
+	})
+}
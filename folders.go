@@ -0,0 +1,356 @@
+package main
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	// Name of the folder membership file in the artist directory.
+	foldersFilename = "folders.json"
+
+	// How many regex capture groups folderLinkRegexp should have.
+	folderLinkRegexpCaptures = 3
+)
+
+var (
+	ErrFolderNotFound = errors.New("gallery folder not found")
+
+	// Regex to pull the ID and name out of a gallery folder link, e.g.
+	// /gallery/<artist>/folder/123456/Comic-Pages/
+	folderLinkRegexp = regexp.MustCompile(`^/gallery/[^/]+/folder/(\d+)/([^/]+)/?$`)
+)
+
+// GalleryFolder is one of an artist's gallery folders, and the submissions
+// in it.
+type GalleryFolder struct {
+	ID          uint64   `json:"id"`
+	Name        string   `json:"name"`        // As it appears in the folder URL
+	Title       string   `json:"title"`       // As it appears in the folder list
+	Submissions []uint64 `json:"submissions"` // Newest first
+}
+
+// FoldersFile is the record of an artist's gallery folders, saved as
+// folders.json in the artist directory.  Submissions are saved in the artist
+// directory as usual, since a submission can be in several folders.  This
+// file is what records which folders they're in.
+type FoldersFile struct {
+	Artist    string          `json:"artist"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	Folders   []GalleryFolder `json:"folders"`
+}
+
+// ParseArtistArg splits an artist given on the command line into the
+// username and an optional folder, e.g. "artist/comics".  The folder may be
+// given as its name, title or numeric ID.
+//
+// Parameters:
+//   - arg: The command line argument
+//
+// Returns:
+//   - string: The artist's username
+//   - string: The folder, or empty for the whole gallery
+func ParseArtistArg(arg string) (string, string) {
+	username, folder, _ := strings.Cut(arg, "/")
+	return username, folder
+}
+
+// SetFolderFilter limits the artist to the given gallery folders.  When set,
+// only submissions in these folders are downloaded.
+//
+// Parameters:
+//   - folders: Folder names, titles or IDs, or nil for the whole gallery
+func (a *Artist) SetFolderFilter(folders []string) {
+	a.folderFilter = folders
+}
+
+// FolderFilter returns the folders the artist is limited to, if any.
+//
+// Returns:
+//   - []string: Folder names, titles or IDs, or nil for the whole gallery
+func (a *Artist) FolderFilter() []string {
+	return a.folderFilter
+}
+
+// FoldersPath returns where the artist's folder membership is recorded.
+//
+// Returns:
+//   - string: The path of the folders file
+func (a *Artist) FoldersPath() string {
+	return filepath.Join(a.artistDir, foldersFilename)
+}
+
+// ListFolders retrieves the list of the artist's gallery folders from the
+// first page of their gallery.  Submissions aren't filled in.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//
+// Returns:
+//   - []GalleryFolder: The folders, in the order the gallery lists them
+//   - error: An error if the gallery could not be retrieved, or an
+//     *AccountUnavailableError if FA shows a system message instead
+func (a *Artist) ListFolders(ctx context.Context) ([]GalleryFolder, error) {
+	url := fmt.Sprintf("https://www.furaffinity.net/gallery/%s/1", a.username)
+	body, err := a.client.GetWithDelay(ctx, url)
+	if err != nil {
+		a.logger.Error("folders: page fetch error", "url", url, "error", err)
+		return nil, fmt.Errorf("failed to fetch gallery page: %w", err)
+	}
+	err = checkAccountStatus(a.username, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		// As in parseSubmissionsFromPage, this can't happen with an in-memory
+		// byte slice.
+		fatalInvariant(err)
+	}
+
+	seen := make(map[uint64]bool)
+	var folders []GalleryFolder
+	doc.Find("a[href*='/folder/']").Each(func(_ int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		matches := folderLinkRegexp.FindStringSubmatch(href)
+		if len(matches) != folderLinkRegexpCaptures {
+			return
+		}
+		id, err := strconv.ParseUint(matches[1], 10, 64)
+		if err != nil || seen[id] {
+			return
+		}
+		seen[id] = true
+		folders = append(folders, GalleryFolder{
+			ID:    id,
+			Name:  matches[2],
+			Title: cleanText(s.Text()),
+		})
+	})
+
+	a.logger.Debug("listing folders", "user", a.username, "count", len(folders))
+	return folders, nil
+}
+
+// FolderSubmissions crawls a gallery folder, newest first, stopping at the
+// first submission in known.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - folder: The folder to crawl
+//   - known: Submissions already recorded in the folder, or nil to crawl the
+//     whole folder
+//
+// Returns:
+//   - []uint64: The submission IDs found, newest first
+//   - error: An error if the folder could not be retrieved, or a
+//     *SiteLayoutError if the pages aren't in the expected format
+func (a *Artist) FolderSubmissions(ctx context.Context, folder GalleryFolder, known map[uint64]bool) ([]uint64, error) {
+	var ids []uint64
+	var url string
+	var body []byte
+
+	for pageNum := 1; ; pageNum++ {
+		// Sanity check to prevent infinite loops
+		if pageNum > maxGalleryPages {
+			a.logger.Error("maximum folder pages exceeded", "user", a.username, "maxPages", maxGalleryPages)
+			return nil, newSiteLayoutError(url, body,
+				fmt.Sprintf("maximum gallery pages (%d) exceeded", maxGalleryPages), "")
+		}
+
+		url = fmt.Sprintf("https://www.furaffinity.net/gallery/%s/folder/%d/%s/%d",
+			a.username, folder.ID, folder.Name, pageNum)
+
+		var err error
+		body, err = a.client.GetWithDelay(ctx, url)
+		if err != nil {
+			a.logger.Error("folders: page fetch error", "url", url, "error", err)
+			return nil, fmt.Errorf("failed to fetch folder page: %w", err)
+		}
+
+		// The folder pages look just like gallery pages.  Where the
+		// submissions are saved doesn't matter here, only their IDs.
+		pageSubmissions, _, err := a.parseSubmissionsFromPage(url, body, a.artistDir, true)
+		if err != nil {
+			return nil, err
+		}
+
+		stopCrawling := false
+		for _, submission := range pageSubmissions {
+			if known[submission.ID()] {
+				stopCrawling = true
+				break
+			}
+			ids = append(ids, submission.ID())
+		}
+
+		a.logger.Debug("listing folder",
+			"user", a.username,
+			"folder", folder.Name,
+			"page", pageNum,
+			"count", len(pageSubmissions),
+		)
+
+		if len(pageSubmissions) == 0 || stopCrawling {
+			break
+		}
+	}
+	return ids, nil
+}
+
+// LoadFolders reads the artist's recorded folder membership.  Folders which
+// haven't been recorded yet are returned empty.
+//
+// Returns:
+//   - *FoldersFile: The recorded folders
+//   - error: Any error reading or parsing the file
+func (a *Artist) LoadFolders() (*FoldersFile, error) {
+	file := &FoldersFile{Artist: a.username}
+
+	_, err := readJSONFile(a.FoldersPath(), file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load folders file: %w", err)
+	}
+	return file, nil
+}
+
+// CrawlFolders crawls the artist's folder membership, merging it with the
+// recorded folders.  If the artist has a folder filter, only those folders
+// are crawled, otherwise all of them are.  Folders which no longer exist are
+// dropped.  Unless reCrawl is set, each folder is only crawled as far as the
+// first submission already recorded in it.
+//
+// Nothing is written.  Pass the result to RecordFolders once the submissions
+// found have been saved, so an interrupted run crawls them again.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - reCrawl: If true, crawl each folder completely, replacing its record
+//
+// Returns:
+//   - *FoldersFile: The updated folder membership, for RecordFolders
+//   - []uint64: Submissions newly found in the crawled folders, newest first
+//   - error: Any error crawling the folders or reading the record,
+//     ErrFolderNotFound if the filter names a folder which doesn't exist, or a
+//     *SiteLayoutError
+func (a *Artist) CrawlFolders(ctx context.Context, reCrawl bool) (*FoldersFile, []uint64, error) {
+	listed, err := a.ListFolders(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	selected, err := selectFolders(listed, a.folderFilter)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", a.username, err)
+	}
+
+	file, err := a.LoadFolders()
+	if err != nil {
+		return nil, nil, err
+	}
+	recorded := make(map[uint64]GalleryFolder, len(file.Folders))
+	for _, folder := range file.Folders {
+		recorded[folder.ID] = folder
+	}
+
+	var found []uint64
+	for _, folder := range selected {
+		var known map[uint64]bool
+		previous := recorded[folder.ID].Submissions
+		if !reCrawl {
+			known = make(map[uint64]bool, len(previous))
+			for _, id := range previous {
+				known[id] = true
+			}
+		}
+
+		ids, err := a.FolderSubmissions(ctx, folder, known)
+		if err != nil {
+			return nil, nil, err
+		}
+		found = append(found, ids...)
+
+		folder.Submissions = ids
+		if !reCrawl {
+			folder.Submissions = append(folder.Submissions, previous...)
+		}
+		recorded[folder.ID] = folder
+	}
+
+	// Keep the order the gallery lists them in.  With a filter, the folders
+	// we didn't crawl are kept as they were.
+	folders := make([]GalleryFolder, 0, len(listed))
+	for _, folder := range listed {
+		if existing, ok := recorded[folder.ID]; ok {
+			folders = append(folders, existing)
+		}
+	}
+	file.Folders = folders
+	file.UpdatedAt = time.Now().UTC()
+	return file, found, nil
+}
+
+// RecordFolders saves the folder membership returned by CrawlFolders.  This
+// should be called once the submissions it found have been saved.
+//
+// Parameters:
+//   - file: The folder membership to save
+//
+// Returns:
+//   - error: Any error writing the file
+func (a *Artist) RecordFolders(file *FoldersFile) error {
+	err := os.MkdirAll(a.artistDir, submissionDirPermissions)
+	if err != nil {
+		return fmt.Errorf("failed to create artist directory: %w", err)
+	}
+	err = writeJSONFileAtomic(a.FoldersPath(), file)
+	if err != nil {
+		return fmt.Errorf("failed to write folders file: %w", err)
+	}
+	return nil
+}
+
+// selectFolders picks the folders matching a filter.
+//
+// Parameters:
+//   - folders: All of the artist's folders
+//   - filter: Folder names, titles or IDs, or nil for all of them
+//
+// Returns:
+//   - []GalleryFolder: The selected folders
+//   - error: ErrFolderNotFound if something in the filter matches nothing
+func selectFolders(folders []GalleryFolder, filter []string) ([]GalleryFolder, error) {
+	if len(filter) == 0 {
+		return folders, nil
+	}
+
+	var selected []GalleryFolder
+	for _, want := range filter {
+		found := false
+		for _, folder := range folders {
+			if strconv.FormatUint(folder.ID, 10) == want ||
+				strings.EqualFold(folder.Name, want) ||
+				strings.EqualFold(folder.Title, want) {
+				selected = append(selected, folder)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: %q", ErrFolderNotFound, want)
+		}
+	}
+	return selected, nil
+}
@@ -0,0 +1,249 @@
+package main_test
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"context"
+	"errors"
+	main "furtrap"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+const (
+	folderArtist  = "artist-with-two-submissions"
+	comicPagesURL = "https://www.furaffinity.net/gallery/artist-with-two-submissions/folder/5001/Comic-Pages/1"
+)
+
+// crawlAndRecordFolders crawls an artist's folders and records them, as the
+// scraper does once it has saved what was found.
+func crawlAndRecordFolders(t *testing.T, artist *main.Artist, reCrawl bool) []uint64 {
+	t.Helper()
+	file, found, err := artist.CrawlFolders(t.Context(), reCrawl)
+	assert.NilError(t, err)
+	err = artist.RecordFolders(file)
+	assert.NilError(t, err)
+	return found
+}
+
+// cancelingClient is a TestClient which cancels the run when one page is
+// requested, as if interrupted partway through.
+type cancelingClient struct {
+	*TestClient
+	cancelAt string
+	cancel   context.CancelFunc
+}
+
+// GetWithDelay cancels the run if the page is cancelAt, then serves it from
+// the TestClient.
+func (c *cancelingClient) GetWithDelay(ctx context.Context, uri string) ([]byte, error) {
+	if uri == c.cancelAt {
+		c.cancel()
+	}
+	return c.TestClient.GetWithDelay(ctx, uri)
+}
+
+func TestParseArtistArg(t *testing.T) {
+	for arg, want := range map[string][2]string{
+		"artist":              {"artist", ""},
+		"artist/Comic-Pages":  {"artist", "Comic-Pages"},
+		"artist/Comic Pages/": {"artist", "Comic Pages/"},
+		"artist/5001":         {"artist", "5001"},
+	} {
+		username, folder := main.ParseArtistArg(arg)
+		assert.Equal(t, username, want[0], arg)
+		assert.Equal(t, folder, want[1], arg)
+	}
+}
+
+func TestArtist_ListFolders(t *testing.T) {
+	artist := main.NewArtist(NewTestLogger(t), NewTestClient(), folderArtist, t.TempDir())
+	folders, err := artist.ListFolders(t.Context())
+	assert.NilError(t, err)
+	assert.DeepEqual(t, folders, []main.GalleryFolder{
+		{ID: 5001, Name: "Comic-Pages", Title: "Comic Pages"},
+		{ID: 5002, Name: "Sketches", Title: "Sketches"},
+	})
+}
+
+func TestArtist_CrawlFolders(t *testing.T) {
+	t.Run("records every folder", func(t *testing.T) {
+		artist := main.NewArtist(NewTestLogger(t), NewTestClient(), folderArtist, t.TempDir())
+		found := crawlAndRecordFolders(t, artist, false)
+		assert.DeepEqual(t, found, []uint64{102})
+
+		file := readJSON[main.FoldersFile](t, artist.FoldersPath())
+		assert.Equal(t, file.Artist, folderArtist)
+		assert.Assert(t, !file.UpdatedAt.IsZero())
+		assert.DeepEqual(t, file.Folders, []main.GalleryFolder{
+			{ID: 5001, Name: "Comic-Pages", Title: "Comic Pages", Submissions: []uint64{102}},
+			{ID: 5002, Name: "Sketches", Title: "Sketches", Submissions: nil},
+		})
+	})
+
+	t.Run("nothing is written until recorded", func(t *testing.T) {
+		artist := main.NewArtist(NewTestLogger(t), NewTestClient(), folderArtist, t.TempDir())
+		_, found, err := artist.CrawlFolders(t.Context(), false)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, found, []uint64{102})
+		_, err = os.Stat(artist.FoldersPath())
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("only new submissions are found", func(t *testing.T) {
+		client := NewTestClient()
+		artist := main.NewArtist(NewTestLogger(t), client, folderArtist, t.TempDir())
+		crawlAndRecordFolders(t, artist, false)
+
+		client.SetResponse(comicPagesURL,
+			[]byte(`<a href="/view/103"><img></a><a href="/view/102"><img></a><a href="/view/101"><img></a>`), nil)
+		found := crawlAndRecordFolders(t, artist, false)
+		assert.DeepEqual(t, found, []uint64{103})
+		file := readJSON[main.FoldersFile](t, artist.FoldersPath())
+		assert.DeepEqual(t, file.Folders[0].Submissions, []uint64{103, 102})
+
+		// Re-crawling replaces the record
+		found = crawlAndRecordFolders(t, artist, true)
+		assert.DeepEqual(t, found, []uint64{103, 102, 101})
+		file = readJSON[main.FoldersFile](t, artist.FoldersPath())
+		assert.DeepEqual(t, file.Folders[0].Submissions, []uint64{103, 102, 101})
+	})
+
+	t.Run("filter by name, title or ID", func(t *testing.T) {
+		for _, filter := range []string{"comic-pages", "Comic Pages", "5001"} {
+			artist := main.NewArtist(NewTestLogger(t), NewTestClient(), folderArtist, t.TempDir())
+			artist.SetFolderFilter([]string{filter})
+			found := crawlAndRecordFolders(t, artist, false)
+			assert.DeepEqual(t, found, []uint64{102})
+
+			// Folders outside the filter aren't recorded
+			file := readJSON[main.FoldersFile](t, artist.FoldersPath())
+			assert.Equal(t, len(file.Folders), 1, filter)
+			assert.Equal(t, file.Folders[0].ID, uint64(5001), filter)
+		}
+	})
+
+	t.Run("unknown folder is an error", func(t *testing.T) {
+		artist := main.NewArtist(NewTestLogger(t), NewTestClient(), folderArtist, t.TempDir())
+		artist.SetFolderFilter([]string{"Nope"})
+		_, _, err := artist.CrawlFolders(t.Context(), false)
+		assert.ErrorIs(t, err, main.ErrFolderNotFound)
+		_, err = os.Stat(artist.FoldersPath())
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
+
+func TestScraper_Folders(t *testing.T) {
+	t.Run("artist/folder downloads only that folder", func(t *testing.T) {
+		tempdir := t.TempDir()
+		scraper := main.NewScraper(NewTestLogger(t), NewTestClient(), "",
+			[]string{folderArtist + "/Comic-Pages"}, false, false, tempdir)
+		err := scraper.Run(t.Context())
+		assert.NilError(t, err)
+		assert.DeepEqual(t, scraper.Summary(), main.RunSummary{
+			ArtistsTotal:     1,
+			ArtistsCompleted: 1,
+			Submissions:      1,
+		})
+		matches, err := filepath.Glob(filepath.Join(tempdir, folderArtist, "*.102.html"))
+		assert.NilError(t, err)
+		assert.Equal(t, len(matches), 1)
+		matches, err = filepath.Glob(filepath.Join(tempdir, folderArtist, "*.101.html"))
+		assert.NilError(t, err)
+		assert.Equal(t, len(matches), 0)
+
+		// Already saved
+		err = scraper.Run(t.Context())
+		assert.NilError(t, err)
+		assert.Equal(t, scraper.Summary().Submissions, 1)
+	})
+
+	t.Run("interrupted folder download is picked up by the next run", func(t *testing.T) {
+		tempdir := t.TempDir()
+		folderPage := []byte(`<a href="/view/102"><img></a><a href="/view/101"><img></a>`)
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+
+		// 101 is saved first, being older, then the run is interrupted
+		// fetching 102.
+		client := &cancelingClient{TestClient: NewTestClient(), cancelAt: "https://www.furaffinity.net/view/102",
+			cancel: cancel}
+		client.SetResponse(comicPagesURL, folderPage, nil)
+		scraper := main.NewScraper(NewTestLogger(t), client, "",
+			[]string{folderArtist + "/Comic-Pages"}, false, false, tempdir)
+		err := scraper.Run(ctx)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, scraper.Summary().Submissions, 1)
+		_, err = os.Stat(filepath.Join(tempdir, folderArtist, "folders.json"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+
+		// So the next run crawls the folder again and gets 102.
+		next := NewTestClient()
+		next.SetResponse(comicPagesURL, folderPage, nil)
+		scraper = main.NewScraper(NewTestLogger(t), next, "",
+			[]string{folderArtist + "/Comic-Pages"}, false, false, tempdir)
+		err = scraper.Run(t.Context())
+		assert.NilError(t, err)
+		assert.Equal(t, scraper.Summary().Submissions, 1)
+		matches, err := filepath.Glob(filepath.Join(tempdir, folderArtist, "*.102.html"))
+		assert.NilError(t, err)
+		assert.Equal(t, len(matches), 1)
+
+		artist := main.NewArtist(NewTestLogger(t), next, folderArtist, filepath.Join(tempdir, folderArtist))
+		assert.DeepEqual(t, readJSON[main.FoldersFile](t, artist.FoldersPath()).Folders[0].Submissions, []uint64{102, 101})
+	})
+
+	t.Run("the whole gallery overrides a folder", func(t *testing.T) {
+		tempdir := t.TempDir()
+		scraper := main.NewScraper(NewTestLogger(t), NewTestClient(), "",
+			[]string{folderArtist + "/Comic-Pages", folderArtist}, false, false, tempdir)
+		err := scraper.Run(t.Context())
+		assert.NilError(t, err)
+		assert.Equal(t, scraper.Summary().ArtistsTotal, 1)
+		assert.Equal(t, scraper.Summary().Submissions, 4)
+		_, err = os.Stat(filepath.Join(tempdir, folderArtist, "folders.json"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("record folders", func(t *testing.T) {
+		tempdir := t.TempDir()
+		scraper := main.NewScraper(NewTestLogger(t), NewTestClient(), "", []string{folderArtist}, false, false, tempdir)
+		scraper.SetRecordFolders(true)
+		err := scraper.Run(t.Context())
+		assert.NilError(t, err)
+		assert.Equal(t, scraper.Summary().Submissions, 4)
+
+		artist := main.NewArtist(NewTestLogger(t), NewTestClient(), folderArtist, filepath.Join(tempdir, folderArtist))
+		file := readJSON[main.FoldersFile](t, artist.FoldersPath())
+		assert.Equal(t, len(file.Folders), 2)
+	})
+
+	t.Run("failed folder crawl keeps its filter for retry", func(t *testing.T) {
+		tempdir := t.TempDir()
+		client := NewTestClient()
+		client.SetResponse(comicPagesURL, nil, errors.New("network error")) //nolint:err113 // dynamic test error
+
+		scraper := main.NewScraper(NewTestLogger(t), client, "",
+			[]string{folderArtist + "/Comic-Pages"}, false, false, tempdir)
+		scraper.SetContinueOnError(true)
+		err := scraper.Run(t.Context())
+		assert.NilError(t, err)
+
+		entries := readJSON[[]main.FailureEntry](t, filepath.Join(tempdir, "failures.json"))
+		assert.Equal(t, len(entries), 1)
+		assert.Equal(t, entries[0].Kind, "artist")
+		assert.DeepEqual(t, entries[0].Folders, []string{"Comic-Pages"})
+
+		scraper = main.NewScraper(NewTestLogger(t), NewTestClient(), "", nil, false, false, tempdir)
+		err = scraper.RetryFailed(t.Context())
+		assert.NilError(t, err)
+		assert.DeepEqual(t, scraper.Summary(), main.RunSummary{
+			ArtistsTotal:     1,
+			ArtistsCompleted: 1,
+			Submissions:      1,
+		})
+	})
+}
@@ -0,0 +1,251 @@
+package main
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	// Name of the inbox state file in the output directory.
+	inboxFilename = "inbox.json"
+
+	// How many regex capture groups inboxNextRegexp should have.
+	inboxNextRegexpCaptures = 2
+
+	// The first page of the logged-in user's submission notifications.
+	inboxURL = "https://www.furaffinity.net/msg/submissions/"
+)
+
+var (
+	ErrInboxUnavailable = errors.New("submission inbox not available, are the cookies for a logged-in account?")
+
+	// Regex matching the paging links in the submission inbox.  These are a
+	// cursor, the ID of the first submission on the page, e.g.
+	// /msg/submissions/new~1234567890@72/
+	inboxNextRegexp = regexp.MustCompile(`^/msg/submissions/new~(\d+)@\d+/?$`)
+)
+
+// InboxState records when each artist was last known to be up to date, so
+// inbox mode knows which artists it can skip.  It is saved as inbox.json in
+// the output directory.
+type InboxState struct {
+	UpdatedAt   time.Time            `json:"updated_at"`
+	ArtistsSeen map[string]time.Time `json:"artists_seen"` // Last seen in the inbox, or crawled
+}
+
+// Due reports whether an artist should be crawled directly rather than
+// trusting the inbox to list their new submissions.  That's the case if they
+// haven't been seen in the inbox or crawled within maxAge.  Artists who
+// haven't posted in a while can drop out of the inbox, or may have
+// notifications turned off, so this catches anything the inbox missed.
+//
+// Parameters:
+//   - artistName: The artist's username
+//   - maxAge: How long an artist can go unseen
+//   - now: The current time
+//
+// Returns:
+//   - bool: true if the artist should be crawled
+func (s *InboxState) Due(artistName string, maxAge time.Duration, now time.Time) bool {
+	seen, ok := s.ArtistsSeen[strings.ToLower(artistName)]
+	return !ok || now.Sub(seen) >= maxAge
+}
+
+// Seen records that an artist is up to date.
+//
+// Parameters:
+//   - artistName: The artist's username
+//   - when: When they were seen in the inbox or crawled
+func (s *InboxState) Seen(artistName string, when time.Time) {
+	// Usernames in links are lowercase, but the command line might not be.
+	s.ArtistsSeen[strings.ToLower(artistName)] = when.UTC()
+}
+
+// Inbox crawls the logged-in user's submission notifications, the
+// /msg/submissions/ page.  This lists new uploads from every watched artist,
+// so one short crawl replaces checking each artist's gallery.  Like
+// Favorites, the submissions belong to other artists and saving them is left
+// to the caller.
+type Inbox struct {
+	logger    *slog.Logger
+	client    Client
+	outputDir string
+}
+
+// NewInbox creates a new Inbox instance.  The client must have the cookies
+// for a logged-in account.
+//
+// Parameters:
+//   - logger: Logger instance
+//   - client: HTTP client interface for making web requests
+//   - outputDir: The root of the output tree
+//
+// Returns:
+//   - *Inbox: A new Inbox instance ready for use
+func NewInbox(logger *slog.Logger, client Client, outputDir string) *Inbox {
+	return &Inbox{
+		logger:    logger,
+		client:    client,
+		outputDir: outputDir,
+	}
+}
+
+// URL returns the address of the first page of the inbox.
+//
+// Returns:
+//   - string: The inbox URL
+func (i *Inbox) URL() string {
+	return inboxURL
+}
+
+// Path returns where the inbox state is recorded.
+//
+// Returns:
+//   - string: The path of the inbox state file
+func (i *Inbox) Path() string {
+	return filepath.Join(i.outputDir, inboxFilename)
+}
+
+// Load reads the inbox state.  State which hasn't been recorded yet is
+// returned empty, so every artist is due.
+//
+// Returns:
+//   - *InboxState: The recorded state
+//   - error: Any error reading or parsing the file
+func (i *Inbox) Load() (*InboxState, error) {
+	state := &InboxState{}
+
+	_, err := readJSONFile(i.Path(), state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load inbox state: %w", err)
+	}
+
+	if state.ArtistsSeen == nil {
+		state.ArtistsSeen = make(map[string]time.Time)
+	}
+	return state, nil
+}
+
+// Save writes the inbox state.
+//
+// Parameters:
+//   - state: The state to save
+//
+// Returns:
+//   - error: Any error writing the file
+func (i *Inbox) Save(state *InboxState) error {
+	state.UpdatedAt = time.Now().UTC()
+	err := os.MkdirAll(i.outputDir, submissionDirPermissions)
+	if err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	err = writeJSONFileAtomic(i.Path(), state)
+	if err != nil {
+		return fmt.Errorf("failed to write inbox state: %w", err)
+	}
+	return nil
+}
+
+// Crawl pages through the inbox, newest first.  Notifications stay in the
+// inbox until the user clears them, so unless reCrawl is set it stops after
+// the first page where everything is already saved.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - isSaved: Reports whether a submission has already been saved
+//   - reCrawl: If true, crawl the whole inbox
+//
+// Returns:
+//   - []ListedSubmission: The submissions found, newest first
+//   - error: Any error fetching the pages, ErrInboxUnavailable if the client
+//     isn't logged in, or a *SiteLayoutError
+func (i *Inbox) Crawl(ctx context.Context, isSaved func(ListedSubmission) bool, reCrawl bool,
+) ([]ListedSubmission, error) {
+	i.logger.Debug("getting submission inbox", "reCrawl", reCrawl)
+
+	listing := &listingCrawl[ListedSubmission]{
+		name:     "inbox",
+		firstURL: i.URL(),
+		fetchPage: func(ctx context.Context, url string, _ int) ([]byte, error) {
+			return i.client.GetWithDelay(ctx, url)
+		},
+		nextPage: func(url string, body []byte, _ int) ([]ListedSubmission, string, error) {
+			entries, next, err := parseInboxPage(url, body)
+			if next != "" {
+				next = "https://www.furaffinity.net" + next
+			}
+			return entries, next, err
+		},
+		isKnown: isSaved,
+	}
+	return listing.crawl(ctx, i.logger, reCrawl)
+}
+
+// parseInboxPage extracts the submissions and the link to the next page from
+// a page of the submission inbox.
+//
+// Parameters:
+//   - url: The URL of the page, for error reporting
+//   - body: The HTML content of the page
+//
+// Returns:
+//   - []ListedSubmission: The submissions on this page
+//   - string: The path of the next page, or empty on the last page
+//   - error: ErrInboxUnavailable if the page isn't the inbox, which is what
+//     happens when we aren't logged in, or a *SiteLayoutError
+func parseInboxPage(url string, body []byte) ([]ListedSubmission, string, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		// goquery only fails if reading fails, which can't happen with an
+		// in-memory byte slice.
+		return nil, "", fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	if doc.Find("#messagecenter-submissions").Length() == 0 {
+		return nil, "", ErrInboxUnavailable
+	}
+
+	entries, err := parseSubmissionFigures(url, body, doc)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(entries) == 0 {
+		return nil, "", nil
+	}
+
+	// The previous and next links look the same.  The next page starts at
+	// an older submission than anything on this one, so it has a lower ID.
+	oldest := entries[0].ID
+	for _, entry := range entries {
+		oldest = min(oldest, entry.ID)
+	}
+	var next string
+	doc.Find("a[href]").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		href, _ := s.Attr("href")
+		matches := inboxNextRegexp.FindStringSubmatch(href)
+		if len(matches) != inboxNextRegexpCaptures {
+			return true
+		}
+		cursor, err := strconv.ParseUint(matches[1], 10, 64)
+		if err != nil || cursor >= oldest {
+			return true
+		}
+		next = href
+		return false
+	})
+
+	return entries, next, nil
+}
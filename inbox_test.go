@@ -0,0 +1,190 @@
+package main_test
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"errors"
+	main "furtrap"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+const (
+	inboxPage1 = "https://www.furaffinity.net/msg/submissions/"
+	inboxPage2 = "https://www.furaffinity.net/msg/submissions/new~101@72/"
+
+	// The section the inbox lists submissions in, and its paging links.  The
+	// previous and next links look the same.
+	inboxSection = "id='messagecenter-submissions'"
+	inboxNext    = "<a class='button standard more' href='/msg/submissions/new~101@72/'>page</a>"
+	inboxPrev    = "<a class='button standard more' href='/msg/submissions/new~104@72/'>page</a>"
+)
+
+// inboxPages are two pages of inbox: 104 and 102, then 101.
+var inboxPages = map[string][]byte{
+	inboxPage1: listingPage(inboxSection, inboxNext, 104, 102),
+	inboxPage2: listingPage(inboxSection, inboxPrev, 101),
+}
+
+func TestInbox_Crawl(t *testing.T) {
+	nothingSaved := func(main.ListedSubmission) bool { return false }
+
+	t.Run("follows next links to the end", func(t *testing.T) {
+		inbox := main.NewInbox(NewTestLogger(t), newPagesTestClient(inboxPages), t.TempDir())
+		assert.Equal(t, inbox.URL(), inboxPage1)
+
+		entries, err := inbox.Crawl(t.Context(), nothingSaved, false)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, entries, []main.ListedSubmission{
+			{ID: 104, Artist: listedArtist},
+			{ID: 102, Artist: listedArtist},
+			{ID: 101, Artist: listedArtist},
+		})
+	})
+
+	t.Run("stops at a page with nothing new", func(t *testing.T) {
+		inbox := main.NewInbox(NewTestLogger(t), newPagesTestClient(inboxPages), t.TempDir())
+		allSaved := func(main.ListedSubmission) bool { return true }
+
+		entries, err := inbox.Crawl(t.Context(), allSaved, false)
+		assert.NilError(t, err)
+		assert.Equal(t, len(entries), 2)
+
+		entries, err = inbox.Crawl(t.Context(), allSaved, true)
+		assert.NilError(t, err)
+		assert.Equal(t, len(entries), 3)
+	})
+
+	t.Run("not logged in", func(t *testing.T) {
+		client := NewTestClient()
+		client.SetResponse(inboxPage1, []byte("<html><body><form action='/login'></form></body></html>"), nil)
+		inbox := main.NewInbox(NewTestLogger(t), client, t.TempDir())
+
+		_, err := inbox.Crawl(t.Context(), nothingSaved, false)
+		assert.ErrorIs(t, err, main.ErrInboxUnavailable)
+	})
+
+	t.Run("layout error on non-numeric submission ID", func(t *testing.T) {
+		client := NewTestClient()
+		client.SetResponse(inboxPage1,
+			[]byte("<div id='messagecenter-submissions'><figure id='sid-x'></figure></div>"), nil)
+		inbox := main.NewInbox(NewTestLogger(t), client, t.TempDir())
+
+		_, err := inbox.Crawl(t.Context(), nothingSaved, false)
+		assert.ErrorIs(t, err, main.ErrSiteLayoutChanged)
+	})
+}
+
+func TestInboxState_Due(t *testing.T) {
+	now := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	state := main.InboxState{ArtistsSeen: map[string]time.Time{}}
+	assert.Assert(t, state.Due("Someone", time.Hour, now))
+
+	state.Seen("Someone", now.Add(-30*time.Minute))
+	assert.Assert(t, !state.Due("someone", time.Hour, now))
+	assert.Assert(t, state.Due("someone", 30*time.Minute, now))
+}
+
+func TestScraper_Inbox(t *testing.T) {
+	t.Run("artists in the inbox aren't crawled", func(t *testing.T) {
+		tempdir := t.TempDir()
+		client := NewTestClient()
+		client.SetResponse(inboxPage1, listingPage(inboxSection, "", 104, 102), nil)
+
+		scraper := main.NewScraper(NewTestLogger(t), client, "", []string{listedArtist}, false, false, tempdir)
+		scraper.SetInbox(true, time.Hour)
+		err := scraper.Run(t.Context())
+		assert.NilError(t, err)
+		assert.DeepEqual(t, scraper.Summary(), main.RunSummary{
+			ArtistsTotal:     1,
+			ArtistsCompleted: 1,
+			Submissions:      2,
+		})
+
+		// 104 is a scrap, routed to the scraps directory by its /view/ page.
+		matches, err := filepath.Glob(filepath.Join(tempdir, listedArtist, "scraps", "*.104.html"))
+		assert.NilError(t, err)
+		assert.Equal(t, len(matches), 1)
+		matches, err = filepath.Glob(filepath.Join(tempdir, listedArtist, "*.101.html"))
+		assert.NilError(t, err)
+		assert.Equal(t, len(matches), 0)
+
+		state := readJSON[main.InboxState](t, filepath.Join(tempdir, "inbox.json"))
+		assert.Assert(t, !state.Due(listedArtist, time.Hour, time.Now()))
+	})
+
+	t.Run("artists with a failed entry are still crawled", func(t *testing.T) {
+		tempdir := t.TempDir()
+		client := NewTestClient()
+		client.SetResponse(inboxPage1, listingPage(inboxSection, "", 104, 102), nil)
+		client.SetResponse("https://www.furaffinity.net/view/102", nil,
+			errors.New("network error")) //nolint:err113 // dynamic test error
+
+		scraper := main.NewScraper(NewTestLogger(t), client, "", []string{listedArtist}, false, false, tempdir)
+		scraper.SetInbox(true, time.Hour)
+		scraper.SetContinueOnError(true)
+		err := scraper.Run(t.Context())
+		assert.NilError(t, err)
+
+		// 101 isn't in the inbox, so it only comes from crawling the gallery.
+		matches, err := filepath.Glob(filepath.Join(tempdir, listedArtist, "*.101.html"))
+		assert.NilError(t, err)
+		assert.Equal(t, len(matches), 1)
+	})
+
+	t.Run("artists not seen are crawled, then skipped until the fallback", func(t *testing.T) {
+		tempdir := t.TempDir()
+		client := NewTestClient()
+		client.SetResponse(inboxPage1, listingPage(inboxSection, ""), nil)
+
+		scraper := main.NewScraper(NewTestLogger(t), client, "", []string{listedArtist}, false, false, tempdir)
+		scraper.SetInbox(true, time.Hour)
+		err := scraper.Run(t.Context())
+		assert.NilError(t, err)
+		assert.DeepEqual(t, scraper.Summary(), main.RunSummary{
+			ArtistsTotal:     1,
+			ArtistsCompleted: 1,
+			Submissions:      4,
+		})
+		state := readJSON[main.InboxState](t, filepath.Join(tempdir, "inbox.json"))
+		assert.Assert(t, !state.Due(listedArtist, time.Hour, time.Now()))
+
+		// Covered now, even though the inbox is empty
+		scraper = main.NewScraper(NewTestLogger(t), client, "", []string{listedArtist}, false, false, tempdir)
+		scraper.SetInbox(true, time.Hour)
+		err = scraper.Run(t.Context())
+		assert.NilError(t, err)
+		assert.DeepEqual(t, scraper.Summary(), main.RunSummary{ArtistsTotal: 1, ArtistsCompleted: 1})
+	})
+
+	t.Run("failed inbox falls back to crawling and is retried", func(t *testing.T) {
+		tempdir := t.TempDir()
+		client := NewTestClient()
+		client.SetResponse(inboxPage1, []byte("<html><body>Log in</body></html>"), nil)
+
+		scraper := main.NewScraper(NewTestLogger(t), client, "", []string{listedArtist}, false, false, tempdir)
+		scraper.SetInbox(true, time.Hour)
+		scraper.SetContinueOnError(true)
+		err := scraper.Run(t.Context())
+		assert.NilError(t, err)
+		assert.Equal(t, scraper.Summary().Submissions, 4)
+		assert.Equal(t, scraper.Summary().Failures, 1)
+
+		entries := readJSON[[]main.FailureEntry](t, filepath.Join(tempdir, "failures.json"))
+		assert.Equal(t, len(entries), 1)
+		assert.Equal(t, entries[0].Kind, "inbox")
+		assert.Equal(t, entries[0].URL, inboxPage1)
+
+		client = NewTestClient()
+		client.SetResponse(inboxPage1, listingPage(inboxSection, ""), nil)
+		scraper = main.NewScraper(NewTestLogger(t), client, "", nil, false, false, tempdir)
+		err = scraper.RetryFailed(t.Context())
+		assert.NilError(t, err)
+		_, err = os.Stat(filepath.Join(tempdir, "failures.json"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
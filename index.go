@@ -0,0 +1,421 @@
+package main
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// Name of the archive index file in the output directory.
+	archiveIndexFilename = "index.jsonl"
+
+	// Permissions for the archive index file.
+	archiveIndexPermissions = 0600
+
+	// Section names recorded in the archive index.
+	sectionGallery = "gallery"
+	sectionScraps  = "scraps"
+
+	// How many submissions to hash between progress messages while building
+	// the archive index.
+	archiveIndexProgressInterval = 1000
+)
+
+// ArchiveIndexEntry is a single record in the archive index, describing one
+// saved submission.
+type ArchiveIndexEntry struct {
+	ID      uint64    `json:"id"`
+	Artist  string    `json:"artist"`
+	Section string    `json:"section"`
+	Path    string    `json:"path"` // Relative to the output dir, slash separated
+	Size    int64     `json:"size"`
+	SHA256  string    `json:"sha256"`
+	SavedAt time.Time `json:"saved_at"`
+}
+
+// archiveIndexKey identifies a submission in a particular directory.  The same
+// ID may legitimately be saved in more than one place.
+type archiveIndexKey struct {
+	dir string // Relative to the output dir, slash separated
+	id  uint64
+}
+
+// ArchiveIndex is an append-only JSONL manifest of every submission saved in
+// the output directory.  It replaces per-submission directory globbing in
+// Submission.IsSaved with an in-memory lookup, and records what is in the
+// archive for other tools to consume.
+//
+// The index is authoritative once it exists.  If files are added or removed by
+// hand, run the rebuild-index subcommand to bring it back in sync.
+//
+// A submission's HTML marker is written before its index record, and the
+// record is only appended once the marker is on disk.  A crash between the two
+// leaves a marker the index doesn't know about, so the submission is
+// downloaded again and its files replaced, never an index record for files
+// which aren't there.  A crash partway through an append leaves a partial last
+// line, which is dropped the next time the index is opened.
+type ArchiveIndex struct {
+	logger    *slog.Logger
+	outputDir string
+	entries   map[archiveIndexKey]ArchiveIndexEntry
+}
+
+// OpenArchiveIndex loads the archive index from the output directory.  If no
+// index exists yet, one is built by scanning the output directory for saved
+// submissions, so existing archives are picked up automatically.  That hashes
+// every saved file, so it warns first.
+//
+// Parameters:
+//   - logger: Logger instance
+//   - outputDir: The root of the output tree
+//
+// Returns:
+//   - *ArchiveIndex: The loaded index
+//   - error: Any error encountered while reading or building the index
+func OpenArchiveIndex(logger *slog.Logger, outputDir string) (*ArchiveIndex, error) {
+	index := &ArchiveIndex{
+		logger:    logger,
+		outputDir: outputDir,
+		entries:   make(map[archiveIndexKey]ArchiveIndexEntry),
+	}
+
+	data, err := os.ReadFile(index.path())
+	switch {
+	case err == nil:
+		// continue
+	case errors.Is(err, fs.ErrNotExist):
+		// Hashing a large archive can take hours, so make it obvious why
+		// nothing is being downloaded yet.
+		logger.Warn("No archive index found, building one by hashing every saved submission before "+
+			"starting.  On a large archive this can take a long time.  It only happens once, and can be "+
+			"done ahead of time with the rebuild-index subcommand", "dir", outputDir)
+		return RebuildArchiveIndex(logger, outputDir)
+	default:
+		return nil, fmt.Errorf("failed to read archive index: %w", err)
+	}
+
+	// An append which was interrupted leaves a partial last line.  Drop it,
+	// or the next record would be appended onto the end of it and lost.
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		complete := bytes.LastIndexByte(data, '\n') + 1
+		logger.Warn("Removing partial last line from archive index", "bytes", len(data)-complete)
+		err = os.Truncate(index.path(), int64(complete))
+		if err != nil {
+			return nil, fmt.Errorf("failed to repair archive index: %w", err)
+		}
+		data = data[:complete]
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		var entry ArchiveIndexEntry
+		err := json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			// Most likely a partial line from an interrupted append.  The
+			// submission will just be downloaded again.
+			logger.Warn("Skipping invalid archive index line", "line", lineNum, "error", err)
+			continue
+		}
+		index.add(entry)
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse archive index: %w", err)
+	}
+
+	logger.Debug("Loaded archive index", "entries", len(index.entries))
+	return index, nil
+}
+
+// RebuildArchiveIndex scans the output directory for saved submissions and
+// writes a fresh archive index, replacing any existing one.
+//
+// Parameters:
+//   - logger: Logger instance
+//   - outputDir: The root of the output tree
+//
+// Returns:
+//   - *ArchiveIndex: The rebuilt index
+//   - error: Any error encountered while scanning or writing the index
+func RebuildArchiveIndex(logger *slog.Logger, outputDir string) (*ArchiveIndex, error) {
+	index := &ArchiveIndex{
+		logger:    logger,
+		outputDir: outputDir,
+		entries:   make(map[archiveIndexKey]ArchiveIndexEntry),
+	}
+
+	// A brand new output directory has nothing to index.
+	_, err := os.Stat(outputDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return index, nil
+	}
+
+	var buf bytes.Buffer
+	err = walkSavedSubmissions(outputDir, func(saved savedSubmission) error {
+		entry, err := index.newEntry(saved.dir, saved.filename, saved.id)
+		if err != nil {
+			return err
+		}
+
+		// The marker's mtime is the best guess we have for when it was saved.
+		info, err := os.Stat(saved.markerPath())
+		if err != nil {
+			return fmt.Errorf("failed to stat saved page: %w", err)
+		}
+		entry.SavedAt = info.ModTime().UTC()
+
+		index.add(entry)
+		if len(index.entries)%archiveIndexProgressInterval == 0 {
+			logger.Info("Building archive index", "entries", len(index.entries))
+		}
+		return appendJSONLine(&buf, entry)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan output directory: %w", err)
+	}
+
+	err = writeFileAtomic(index.path(), buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to write archive index: %w", err)
+	}
+
+	logger.Info("Built archive index", "dir", outputDir, "entries", len(index.entries))
+	return index, nil
+}
+
+// Contains reports whether a submission has been saved in the given
+// directory.
+//
+// Parameters:
+//   - dir: The submission directory
+//   - id: The FurAffinity submission ID
+//
+// Returns:
+//   - bool: true if the index has a record of the submission
+func (idx *ArchiveIndex) Contains(dir string, id uint64) bool {
+	relDir, err := idx.relativeDir(dir)
+	if err != nil {
+		idx.logger.Error("ArchiveIndex: submission outside output dir", "dir", dir, "error", err)
+		return false
+	}
+	_, ok := idx.entries[archiveIndexKey{dir: relDir, id: id}]
+	return ok
+}
+
+// Record adds a newly saved submission to the index.  The record is appended
+// and fsynced before returning.  This is called after the HTML marker is
+// written, so an interruption between the two only costs a re-download.  If
+// an earlier append failed partway, the partial line is ended first so this
+// record starts on a line of its own.
+//
+// Parameters:
+//   - dir: The submission directory
+//   - filename: The filename of the saved submission file
+//   - id: The FurAffinity submission ID
+//
+// Returns:
+//   - error: Any error encountered while hashing the file or appending the record
+func (idx *ArchiveIndex) Record(dir string, filename string, id uint64) error {
+	entry, err := idx.newEntry(dir, filename, id)
+	if err != nil {
+		return err
+	}
+	entry.SavedAt = time.Now().UTC()
+
+	var buf bytes.Buffer
+	err = appendJSONLine(&buf, entry)
+	if err != nil {
+		return err
+	}
+
+	//#nosec G304: path is built from the configured output dir
+	fh, err := os.OpenFile(idx.path(), os.O_RDWR|os.O_APPEND|os.O_CREATE, archiveIndexPermissions)
+	if err != nil {
+		return fmt.Errorf("failed to open archive index: %w", err)
+	}
+	defer func() { _ = fh.Close() }()
+
+	complete, err := endsWithNewline(fh)
+	if err != nil {
+		return err
+	}
+	line := buf.Bytes()
+	if !complete {
+		idx.logger.Warn("Archive index ends in a partial line, starting a new one")
+		line = append([]byte{'\n'}, line...)
+	}
+
+	_, err = fh.Write(line)
+	if err != nil {
+		return fmt.Errorf("failed to append to archive index: %w", err)
+	}
+	err = fh.Sync()
+	if err != nil {
+		return fmt.Errorf("failed to sync archive index: %w", err)
+	}
+
+	idx.add(entry)
+	return nil
+}
+
+// endsWithNewline checks that the index file ends with a complete line.
+//
+// Parameters:
+//   - fh: The open index file
+//
+// Returns:
+//   - bool: true if the file is empty or its last byte is a newline
+//   - error: Any error reading the file
+func endsWithNewline(fh *os.File) (bool, error) {
+	info, err := fh.Stat()
+	if err != nil {
+		return false, fmt.Errorf("failed to stat archive index: %w", err)
+	}
+	if info.Size() == 0 {
+		return true, nil
+	}
+	last := make([]byte, 1)
+	_, err = fh.ReadAt(last, info.Size()-1)
+	if err != nil {
+		return false, fmt.Errorf("failed to read archive index: %w", err)
+	}
+	return last[0] == '\n', nil
+}
+
+// path returns the path of the index file.
+//
+// Returns:
+//   - string: The path of the index file
+func (idx *ArchiveIndex) path() string {
+	return filepath.Join(idx.outputDir, archiveIndexFilename)
+}
+
+// add adds an entry to the in-memory index.  Later entries for the same
+// submission replace earlier ones.
+//
+// Parameters:
+//   - entry: The entry to add
+func (idx *ArchiveIndex) add(entry ArchiveIndexEntry) {
+	key := archiveIndexKey{dir: filepath.ToSlash(filepath.Dir(filepath.FromSlash(entry.Path))), id: entry.ID}
+	idx.entries[key] = entry
+}
+
+// relativeDir converts a submission directory into the slash separated form
+// used as an index key.
+//
+// Parameters:
+//   - dir: The submission directory
+//
+// Returns:
+//   - string: The directory relative to the output dir
+//   - error: An error if dir can't be expressed relative to the output dir
+func (idx *ArchiveIndex) relativeDir(dir string) (string, error) {
+	relDir, err := filepath.Rel(idx.outputDir, dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to find relative path: %w", err)
+	}
+	return filepath.ToSlash(relDir), nil
+}
+
+// newEntry builds an index entry for a saved submission, hashing the
+// submission file.  A missing submission file is logged and recorded with an
+// empty checksum, since the HTML marker says it was saved.
+//
+// Parameters:
+//   - dir: The submission directory
+//   - filename: The filename of the saved submission file
+//   - id: The FurAffinity submission ID
+//
+// Returns:
+//   - ArchiveIndexEntry: The new entry, without SavedAt
+//   - error: Any error encountered while hashing the file
+func (idx *ArchiveIndex) newEntry(dir string, filename string, id uint64) (ArchiveIndexEntry, error) {
+	relDir, err := idx.relativeDir(dir)
+	if err != nil {
+		return ArchiveIndexEntry{}, err
+	}
+
+	// The first path component is always the artist.  Scraps live in a
+	// "scraps" subdirectory.
+	parts := strings.Split(relDir, "/")
+	section := sectionGallery
+	if len(parts) > 1 && parts[1] == sectionScraps {
+		section = sectionScraps
+	}
+
+	entry := ArchiveIndexEntry{
+		ID:      id,
+		Artist:  parts[0],
+		Section: section,
+		Path:    relDir + "/" + filename,
+	}
+
+	size, checksum, err := hashFile(filepath.Join(dir, filename))
+	switch {
+	case err == nil:
+		entry.Size = size
+		entry.SHA256 = checksum
+	case errors.Is(err, fs.ErrNotExist):
+		idx.logger.Warn("Submission file missing, indexing without checksum", "id", id, "path", entry.Path)
+	default:
+		return ArchiveIndexEntry{}, err
+	}
+
+	return entry, nil
+}
+
+// hashFile returns the size and hex encoded SHA-256 checksum of a file.
+//
+// Parameters:
+//   - filePath: The file to hash
+//
+// Returns:
+//   - int64: The file size in bytes
+//   - string: The hex encoded SHA-256 checksum
+//   - error: Any error encountered while reading the file
+func hashFile(filePath string) (int64, string, error) {
+	//#nosec G304: path is built from the configured output dir
+	fh, err := os.Open(filePath)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to open file for hashing: %w", err)
+	}
+	defer func() { _ = fh.Close() }()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, fh)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to hash file: %w", err)
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// appendJSONLine encodes v as a single line of JSON and appends it to buf.
+//
+// Parameters:
+//   - buf: The buffer to append to
+//   - v: The value to encode
+//
+// Returns:
+//   - error: Any error encountered while encoding
+func appendJSONLine(buf *bytes.Buffer, v any) error {
+	// json.Encoder terminates each value with a newline.
+	err := json.NewEncoder(buf).Encode(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode JSON line: %w", err)
+	}
+	return nil
+}
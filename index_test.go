@@ -0,0 +1,162 @@
+package main_test
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"bufio"
+	"encoding/json"
+	main "furtrap"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// readArchiveIndex reads the raw entries from an archive index file, sorted by
+// path.
+func readArchiveIndex(t *testing.T, outputDir string) []main.ArchiveIndexEntry {
+	t.Helper()
+	//#nosec G304: filename is from test data
+	fh, err := os.Open(filepath.Join(outputDir, "index.jsonl"))
+	assert.NilError(t, err)
+	defer func() { _ = fh.Close() }()
+
+	var entries []main.ArchiveIndexEntry
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		var entry main.ArchiveIndexEntry
+		err := json.Unmarshal(scanner.Bytes(), &entry)
+		assert.NilError(t, err)
+		entries = append(entries, entry)
+	}
+	assert.NilError(t, scanner.Err())
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries
+}
+
+func TestArchiveIndex(t *testing.T) {
+	// SHA-256 of "one\n", the content of the sample submission 101 file.
+	const sha256One = "2c8b08da5ce60398e1f19af0e5dccc744df274b826abe585eaba68c525434806"
+
+	t.Run("Save records submissions in the index", func(t *testing.T) {
+		outputDir := t.TempDir()
+		index, err := main.OpenArchiveIndex(NewTestLogger(t), outputDir)
+		assert.NilError(t, err)
+
+		artistDir := filepath.Join(outputDir, "artist-with-two-submissions")
+		submission := main.NewSubmission(NewTestLogger(t), NewTestClient(), 101, artistDir)
+		submission.SetIndex(index)
+		err = submission.Save(t.Context())
+		assert.NilError(t, err)
+		assert.Assert(t, index.Contains(artistDir, 101))
+
+		entries := readArchiveIndex(t, outputDir)
+		assert.Equal(t, len(entries), 1)
+		assert.Equal(t, entries[0].ID, uint64(101))
+		assert.Equal(t, entries[0].Artist, "artist-with-two-submissions")
+		assert.Equal(t, entries[0].Section, "gallery")
+		assert.Equal(t, entries[0].Path,
+			"artist-with-two-submissions/1111111111.artist-with-two-submissions_test-image-1.jpg")
+		assert.Equal(t, entries[0].Size, int64(4))
+		assert.Equal(t, entries[0].SHA256, sha256One)
+		assert.Assert(t, !entries[0].SavedAt.IsZero())
+
+		// Reopening loads the same entries from disk
+		reopened, err := main.OpenArchiveIndex(NewTestLogger(t), outputDir)
+		assert.NilError(t, err)
+		assert.Assert(t, reopened.Contains(artistDir, 101))
+		assert.Assert(t, !reopened.Contains(filepath.Join(artistDir, "scraps"), 101))
+	})
+
+	t.Run("IsSaved consults the index instead of the directory", func(t *testing.T) {
+		outputDir := t.TempDir()
+		index, err := main.OpenArchiveIndex(NewTestLogger(t), outputDir)
+		assert.NilError(t, err)
+
+		// A marker created behind the index's back is not seen
+		artistDir := filepath.Join(outputDir, "artist")
+		copySampleViewPage(t, "101", artistDir, "randomname.png.12345.html")
+		submission := main.NewSubmission(NewTestLogger(t), NewTestClient(), 12345, artistDir)
+		submission.SetIndex(index)
+		assert.Equal(t, submission.IsSaved(), false)
+
+		// Until the index is rebuilt from disk
+		index, err = main.RebuildArchiveIndex(NewTestLogger(t), outputDir)
+		assert.NilError(t, err)
+		submission.SetIndex(index)
+		assert.Equal(t, submission.IsSaved(), true)
+	})
+
+	t.Run("missing index is built from disk", func(t *testing.T) {
+		outputDir := t.TempDir()
+		artistDir := filepath.Join(outputDir, "artist-with-two-submissions")
+		scrapsDir := filepath.Join(artistDir, "scraps")
+		copySampleViewPage(t, "101", artistDir, "image-1.jpg.101.html")
+		copySampleViewPage(t, "104", scrapsDir, "scrap-2.png.104.html")
+		err := os.WriteFile(filepath.Join(artistDir, "image-1.jpg"), []byte("one\n"), 0600)
+		assert.NilError(t, err)
+
+		index, err := main.OpenArchiveIndex(NewTestLogger(t), outputDir)
+		assert.NilError(t, err)
+		assert.Assert(t, index.Contains(artistDir, 101))
+		assert.Assert(t, index.Contains(scrapsDir, 104))
+
+		entries := readArchiveIndex(t, outputDir)
+		assert.Equal(t, len(entries), 2)
+		assert.Equal(t, entries[0].Path, "artist-with-two-submissions/image-1.jpg")
+		assert.Equal(t, entries[0].SHA256, sha256One)
+		// The scrap's file is missing, so it has no checksum
+		assert.Equal(t, entries[1].Path, "artist-with-two-submissions/scraps/scrap-2.png")
+		assert.Equal(t, entries[1].Section, "scraps")
+		assert.Equal(t, entries[1].SHA256, "")
+	})
+
+	t.Run("truncated lines are skipped", func(t *testing.T) {
+		outputDir := t.TempDir()
+		content := `{"id":1,"artist":"a","section":"gallery","path":"a/one.png"}` + "\n" +
+			`{"id":2,"artist":"a","sec`
+		err := os.WriteFile(filepath.Join(outputDir, "index.jsonl"), []byte(content), 0600)
+		assert.NilError(t, err)
+
+		index, err := main.OpenArchiveIndex(NewTestLogger(t), outputDir)
+		assert.NilError(t, err)
+		assert.Assert(t, index.Contains(filepath.Join(outputDir, "a"), 1))
+		assert.Assert(t, !index.Contains(filepath.Join(outputDir, "a"), 2))
+
+		// The partial line is removed, so the next record isn't lost
+		artistDir := filepath.Join(outputDir, "artist-with-two-submissions")
+		submission := main.NewSubmission(NewTestLogger(t), NewTestClient(), 101, artistDir)
+		submission.SetIndex(index)
+		err = submission.Save(t.Context())
+		assert.NilError(t, err)
+		assert.Equal(t, len(readArchiveIndex(t, outputDir)), 2)
+	})
+
+	t.Run("a partial line left during a run is ended before the next record", func(t *testing.T) {
+		outputDir := t.TempDir()
+		index, err := main.OpenArchiveIndex(NewTestLogger(t), outputDir)
+		assert.NilError(t, err)
+		err = os.WriteFile(filepath.Join(outputDir, "index.jsonl"), []byte(`{"id":2,"artist":"a","sec`), 0600)
+		assert.NilError(t, err)
+
+		artistDir := filepath.Join(outputDir, "artist-with-two-submissions")
+		submission := main.NewSubmission(NewTestLogger(t), NewTestClient(), 101, artistDir)
+		submission.SetIndex(index)
+		err = submission.Save(t.Context())
+		assert.NilError(t, err)
+
+		reopened, err := main.OpenArchiveIndex(NewTestLogger(t), outputDir)
+		assert.NilError(t, err)
+		assert.Assert(t, reopened.Contains(artistDir, 101))
+	})
+
+	t.Run("new output directory starts empty", func(t *testing.T) {
+		outputDir := filepath.Join(t.TempDir(), "new")
+		index, err := main.OpenArchiveIndex(NewTestLogger(t), outputDir)
+		assert.NilError(t, err)
+		assert.Assert(t, !index.Contains(filepath.Join(outputDir, "a"), 1))
+	})
+}
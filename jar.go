@@ -0,0 +1,243 @@
+package main
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// How often --save-cookies writes the cookies out during a run, if FA
+	// has changed any.
+	defaultCookieSaveInterval = 10 * time.Minute
+
+	// Permissions for saved cookies files.  They're as good as a password.
+	cookiesFilePermissions = 0600
+)
+
+// recordingJar is the client's cookie jar.  It wraps a cookiejar.Jar, which
+// only gives back cookies' names and values, and keeps a copy of every cookie
+// set in it with the rest of its attributes, so the cookies FA refreshes
+// during a run can be written back out in cookies.txt format.
+type recordingJar struct {
+	jar     *cookiejar.Jar
+	cookies map[string]*http.Cookie // Keyed by domain, path and name
+	changed bool                    // Whether a response has set cookies since the last save
+}
+
+// newRecordingJar creates an empty recordingJar.
+//
+// Returns:
+//   - *recordingJar: The new jar
+func newRecordingJar() *recordingJar {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		// There are no conditions where cookiejar.New returns an error, ever,
+		// as of Go 1.24.  Just in case that changes in the future, we'll handle
+		// it here.  Fatal because we have no idea what the future error
+		// conditions are.
+		fatalInvariant(fmt.Errorf("failed to create cookie jar: %w", err))
+	}
+	return &recordingJar{
+		jar:     jar,
+		cookies: make(map[string]*http.Cookie),
+	}
+}
+
+// SetCookies implements http.CookieJar.  The cookies are recorded, with
+// their expiry worked out now so Max-Age can be saved as a time.  Cookies
+// which are expired or deleted are forgotten.
+//
+// Parameters:
+//   - u: The URL the cookies came from
+//   - cookies: The cookies to set
+func (j *recordingJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.jar.SetCookies(u, cookies)
+
+	now := time.Now()
+	for _, c := range cookies {
+		// Without a Domain attribute, the cookie is only for the host which
+		// set it.  cookies.txt can say that by leaving off the leading dot.
+		recorded := *c
+		if recorded.Domain == "" {
+			recorded.Domain = u.Hostname()
+		}
+		if recorded.Path == "" {
+			recorded.Path = "/"
+		}
+		if c.MaxAge > 0 {
+			recorded.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+		}
+		key := recorded.Domain + "\t" + recorded.Path + "\t" + recorded.Name
+
+		expired := c.MaxAge < 0 || (!recorded.Expires.IsZero() && !recorded.Expires.After(now))
+		if expired {
+			delete(j.cookies, key)
+		} else {
+			j.cookies[key] = &recorded
+		}
+		j.changed = true
+	}
+}
+
+// Cookies implements http.CookieJar.
+//
+// Parameters:
+//   - u: The URL of the request
+//
+// Returns:
+//   - []*http.Cookie: The cookies to send with it
+func (j *recordingJar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+// cookiesTxt formats the recorded cookies as a Netscape cookies.txt file,
+// which LoadCookies can read back.  Cookies which have expired since they were
+// set are left out.
+//
+// Parameters:
+//   - now: The current time
+//
+// Returns:
+//   - []byte: The file contents
+func (j *recordingJar) cookiesTxt(now time.Time) []byte {
+	var b strings.Builder
+	b.WriteString("# Netscape HTTP Cookie File\n")
+	b.WriteString("# Saved by furtrap\n")
+	for _, key := range slices.Sorted(maps.Keys(j.cookies)) {
+		c := j.cookies[key]
+		if !c.Expires.IsZero() && !c.Expires.After(now) {
+			continue
+		}
+		var expiration int64 // 0 for a session cookie
+		if !c.Expires.IsZero() {
+			expiration = c.Expires.Unix()
+		}
+		fmt.Fprintf(&b, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			c.Domain, cookiesTxtBool(strings.HasPrefix(c.Domain, ".")), c.Path, cookiesTxtBool(c.Secure),
+			expiration, c.Name, c.Value)
+	}
+	return []byte(b.String())
+}
+
+// cookiesTxtBool formats a flag for cookies.txt.
+//
+// Parameters:
+//   - value: The flag
+//
+// Returns:
+//   - string: TRUE or FALSE
+func cookiesTxtBool(value bool) string {
+	if value {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// SetCookieSaving makes the client write its cookies out in cookies.txt
+// format, so the cookies FA refreshes during a run aren't lost.  They're
+// written every interval, if any have changed, and whenever SaveCookies is
+// called, e.g. at exit.  The file can be the one LoadCookies read.
+//
+// Parameters:
+//   - path: Where to write the cookies, empty to not save them
+//   - interval: How often to write them during a run, 0 for only on SaveCookies
+func (h *HTTPClient) SetCookieSaving(path string, interval time.Duration) {
+	if path != "" {
+		path = filepath.Clean(path)
+	}
+	h.cookieSavePath = path
+	h.cookieSaveInterval = interval
+	h.cookiesSavedAt = time.Now()
+}
+
+// SaveCookies writes the client's cookies to the file given to
+// SetCookieSaving, replacing it atomically.  The file is private to the user,
+// whatever the permissions of the file it replaces.
+//
+// Returns:
+//   - error: Any error writing the file
+func (h *HTTPClient) SaveCookies() error {
+	if h.cookieSavePath == "" {
+		return nil
+	}
+
+	now := time.Now()
+	tempfile := h.cookieSavePath + ".tmp"
+	err := writeCookiesFile(tempfile, h.jar.cookiesTxt(now))
+	if err != nil {
+		_ = os.Remove(tempfile)
+		return fmt.Errorf("failed to save cookies: %w", err)
+	}
+	err = os.Rename(tempfile, h.cookieSavePath)
+	if err != nil {
+		_ = os.Remove(tempfile)
+		return fmt.Errorf("failed to save cookies: %w", err)
+	}
+	h.jar.changed = false
+	h.cookiesSavedAt = now
+	h.logger.Debug("Saved cookies", "file", h.cookieSavePath)
+	return nil
+}
+
+// writeCookiesFile writes and fsyncs a new cookies file.  It's created private
+// from the start, so the cookies are never readable by anyone else, even
+// briefly.  A file left over from an interrupted save is replaced rather than
+// reused, since it may have been created with other permissions.
+//
+// Parameters:
+//   - filePath: The file to write
+//   - data: The cookies, in cookies.txt format
+//
+// Returns:
+//   - error: Any error writing the file
+func writeCookiesFile(filePath string, data []byte) error {
+	err := os.Remove(filePath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove old temp file: %w", err)
+	}
+
+	//#nosec G304: path is given by the user
+	fh, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, cookiesFilePermissions)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer func() { _ = fh.Close() }()
+
+	_, err = fh.Write(data)
+	if err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	err = fh.Sync()
+	if err != nil {
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+	return nil
+}
+
+// saveCookiesIfDue saves the cookies if FA has changed any and the save
+// interval has passed.  Failures are only logged, since the run can carry on
+// with the cookies in memory.
+func (h *HTTPClient) saveCookiesIfDue() {
+	if h.cookieSavePath == "" || h.cookieSaveInterval <= 0 || !h.jar.changed {
+		return
+	}
+	if time.Since(h.cookiesSavedAt) < h.cookieSaveInterval {
+		return
+	}
+	err := h.SaveCookies()
+	if err != nil {
+		h.logger.Warn("Failed to save cookies", "file", h.cookieSavePath, "error", err)
+	}
+}
@@ -0,0 +1,119 @@
+package main_test
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"fmt"
+	main "furtrap"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestHTTPClient_SaveCookies(t *testing.T) {
+	// FA refreshes the b cookie and clears a tracking cookie.
+	handler := func(w http.ResponseWriter, _ *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "b", Value: "refreshed_b", Path: "/", MaxAge: 86400})
+		http.SetCookie(w, &http.Cookie{Name: "tracking", Value: "", Path: "/", MaxAge: -1})
+		_, _ = w.Write([]byte("ok"))
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	assert.NilError(t, err)
+	host := serverURL.Hostname()
+
+	// Values of the cookies in a saved file, by name
+	readSaved := func(t *testing.T, path string) map[string]string {
+		t.Helper()
+		format, cookies, err := main.ReadCookiesFile(path)
+		assert.NilError(t, err)
+		assert.Equal(t, format, main.CookieFormatNetscape)
+		values := make(map[string]string)
+		for _, cookie := range cookies {
+			values[cookie.Name] = cookie.Value
+		}
+		return values
+	}
+
+	newClient := func(t *testing.T, savePath string, interval time.Duration) *main.HTTPClient {
+		t.Helper()
+		expires := time.Now().Add(30 * 24 * time.Hour).Unix()
+		format := "%[1]s\tTRUE\t/\tFALSE\t%[2]d\ta\tauth_a\n" +
+			"%[1]s\tTRUE\t/\tFALSE\t%[2]d\tb\tauth_b\n" +
+			"%[1]s\tTRUE\t/\tFALSE\t%[2]d\ttracking\tabc\n"
+		cookiesFile := filepath.Join(t.TempDir(), "cookies.txt")
+		err := os.WriteFile(cookiesFile, []byte(fmt.Sprintf(format, host, expires)), 0600)
+		assert.NilError(t, err)
+
+		client := main.NewHTTPClient(NewTestLogger(t))
+		err = client.LoadCookies(cookiesFile)
+		assert.NilError(t, err)
+		client.SetCookieSaving(savePath, interval)
+		return client
+	}
+
+	t.Run("saved on request", func(t *testing.T) {
+		savePath := filepath.Join(t.TempDir(), "saved.txt")
+		client := newClient(t, savePath, 0)
+		_, err := client.Get(t.Context(), server.URL)
+		assert.NilError(t, err)
+
+		// Not until asked
+		_, err = os.Stat(savePath)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+
+		err = client.SaveCookies()
+		assert.NilError(t, err)
+		assert.DeepEqual(t, readSaved(t, savePath), map[string]string{"a": "auth_a", "b": "refreshed_b"})
+		info, err := os.Stat(savePath)
+		assert.NilError(t, err)
+		assert.Equal(t, info.Mode().Perm(), os.FileMode(0600))
+
+		// And it can be loaded again
+		reloaded := main.NewHTTPClient(NewTestLogger(t))
+		err = reloaded.LoadCookies(savePath)
+		assert.NilError(t, err)
+	})
+
+	t.Run("saved periodically when changed", func(t *testing.T) {
+		savePath := filepath.Join(t.TempDir(), "saved.txt")
+		client := newClient(t, savePath, time.Nanosecond)
+		_, err := client.Get(t.Context(), server.URL)
+		assert.NilError(t, err)
+		assert.Equal(t, readSaved(t, savePath)["b"], "refreshed_b")
+	})
+
+	t.Run("saved privately to an untidy path", func(t *testing.T) {
+		dir := t.TempDir()
+		savePath := filepath.Join(dir, "saved.txt")
+
+		// A world-readable temp file left over from an earlier save
+		err := os.WriteFile(savePath+".tmp", []byte("stale"), 0600)
+		assert.NilError(t, err)
+		err = os.Chmod(savePath+".tmp", 0644)
+		assert.NilError(t, err)
+
+		client := newClient(t, dir+"/./saved.txt", 0)
+		err = client.SaveCookies()
+		assert.NilError(t, err)
+		assert.Equal(t, readSaved(t, savePath)["a"], "auth_a")
+		info, err := os.Stat(savePath)
+		assert.NilError(t, err)
+		assert.Equal(t, info.Mode().Perm(), os.FileMode(0600))
+		_, err = os.Stat(savePath + ".tmp")
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("not saved without a path", func(t *testing.T) {
+		client := newClient(t, "", 0)
+		err := client.SaveCookies()
+		assert.NilError(t, err)
+	})
+}
@@ -0,0 +1,204 @@
+package main
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	// Subdirectory of the artist directory where journals are saved.
+	journalsDirname = "journals"
+
+	// How many regex capture groups journalTitleRegexp should have.
+	journalTitleRegexpCaptures = 2
+)
+
+var (
+	ErrJournalMetadataNotFound = errors.New("failed to find journal metadata in HTML")
+
+	// Regex to strip the site name from the <title> of a /journal/ page.
+	journalTitleRegexp = regexp.MustCompile(`^(.*?) -- Fur Affinity`)
+)
+
+// JournalMetadata holds the structured information extracted from a
+// /journal/ page.  It is written as a JSON sidecar next to the saved HTML page,
+// so the text can be read without the site's markup.
+type JournalMetadata struct {
+	ID     uint64    `json:"id"`
+	Title  string    `json:"title"`
+	Artist string    `json:"artist"`
+	Posted time.Time `json:"posted,omitzero"`
+	Text   string    `json:"text"`
+}
+
+// Journal represents a single FurAffinity journal and provides methods for
+// saving it.  Journals are saved as "<id>.html" and "<id>.json" in the artist's
+// journals directory.  As with submissions, the HTML page is written last and
+// marks the journal as saved.
+type Journal struct {
+	logger     *slog.Logger
+	client     Client
+	id         uint64
+	journalDir string
+}
+
+// NewJournal creates a new Journal instance for the specified ID and output
+// directory.
+//
+// Parameters:
+//   - logger: Logger instance
+//   - client: HTTP client interface for making web requests
+//   - id: The FurAffinity journal ID
+//   - journalDir: Directory where the journal files will be saved
+//
+// Returns:
+//   - *Journal: A new Journal instance ready for use
+func NewJournal(logger *slog.Logger, client Client, id uint64, journalDir string) *Journal {
+	return &Journal{
+		logger:     logger,
+		client:     client,
+		id:         id,
+		journalDir: journalDir,
+	}
+}
+
+// ID returns the FurAffinity journal ID.
+//
+// Returns:
+//   - uint64: The numeric journal ID
+func (j *Journal) ID() uint64 {
+	return j.id
+}
+
+// Dir returns the directory this journal is saved in.
+//
+// Returns:
+//   - string: The journal directory
+func (j *Journal) Dir() string {
+	return j.journalDir
+}
+
+// URL returns the address of this journal's page.
+//
+// Returns:
+//   - string: The journal URL
+func (j *Journal) URL() string {
+	return fmt.Sprintf("https://www.furaffinity.net/journal/%d", j.id)
+}
+
+// IsSaved checks whether this journal has already been saved, by looking for
+// its HTML page.
+//
+// Returns:
+//   - bool: true if the journal has been saved
+func (j *Journal) IsSaved() bool {
+	_, err := os.Stat(j.htmlPath())
+	return err == nil
+}
+
+// Save fetches the journal page and saves it along with its metadata sidecar.
+// If the journal has already been saved, this returns early.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//
+// Returns:
+//   - error: Any error encountered fetching or saving the journal
+func (j *Journal) Save(ctx context.Context) error {
+	if j.IsSaved() {
+		j.logger.Debug("Journal already saved, skipping", "id", j.id)
+		return nil
+	}
+
+	pageContent, err := j.client.GetWithDelay(ctx, j.URL())
+	if err != nil {
+		return fmt.Errorf("failed to get journal page: %w", err)
+	}
+
+	err = os.MkdirAll(j.journalDir, submissionDirPermissions)
+	if err != nil {
+		return fmt.Errorf("failed to create target directory: %w", err)
+	}
+
+	// As with submissions, a page we can't extract metadata from is still
+	// worth keeping, so this only warns.
+	metadata, err := parseJournalMetadata(pageContent, j.id)
+	if err != nil {
+		j.logger.Warn("Failed to parse journal metadata, skipping sidecar", "id", j.id, "error", err)
+	} else {
+		jsonPath := filepath.Join(j.journalDir, fmt.Sprintf("%d.json", j.id))
+		err = writeJSONFileAtomic(jsonPath, metadata)
+		if err != nil {
+			return fmt.Errorf("failed to save journal metadata: %w", err)
+		}
+	}
+
+	// The HTML page goes last, so an interrupted save is retried.
+	err = writeFileAtomic(j.htmlPath(), pageContent)
+	if err != nil {
+		return fmt.Errorf("failed to save journal page: %w", err)
+	}
+
+	j.logger.Info("Saved journal", "id", j.id, "file", j.htmlPath())
+	return nil
+}
+
+// htmlPath returns where the journal's HTML page is saved.
+//
+// Returns:
+//   - string: The path of the HTML page
+func (j *Journal) htmlPath() string {
+	return filepath.Join(j.journalDir, fmt.Sprintf("%d.html", j.id))
+}
+
+// parseJournalMetadata extracts structured metadata from a /journal/ page.
+// Both the modern and "classic" templates are supported.  As with
+// parseSubmissionMetadata, the only hard requirement is a title.
+//
+// Parameters:
+//   - pageContent: Raw HTML content from the journal page
+//   - id: The FurAffinity journal ID the page belongs to
+//
+// Returns:
+//   - *JournalMetadata: The extracted metadata
+//   - error: ErrJournalMetadataNotFound if the page has no recognizable title
+func parseJournalMetadata(pageContent []byte, id uint64) (*JournalMetadata, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(pageContent))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	meta := &JournalMetadata{ID: id}
+
+	// Modern uses .journal-title and .journal-content, classic uses a
+	// table cell and .journal-body.
+	meta.Title = cleanText(doc.Find(".journal-title").First().Text())
+	meta.Text = multilineText(doc.Find(".journal-content, .journal-body").First())
+	meta.Posted = parsePopupDate(doc.Find(".popup_date").First())
+	meta.Artist = userFromLinks(doc.Find(`a[href^="/user/"]`))
+
+	if meta.Title == "" {
+		matches := journalTitleRegexp.FindStringSubmatch(strings.TrimSpace(doc.Find("title").First().Text()))
+		if len(matches) == journalTitleRegexpCaptures {
+			meta.Title = matches[1]
+		}
+	}
+
+	if meta.Title == "" {
+		return nil, ErrJournalMetadataNotFound
+	}
+
+	return meta, nil
+}
@@ -0,0 +1,161 @@
+package main_test
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"encoding/json"
+	"errors"
+	main "furtrap"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+const journalArtist = "artist-with-two-submissions"
+
+func TestJournal_Save(t *testing.T) {
+	t.Run("saves the page and a metadata sidecar", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "journals")
+		journal := main.NewJournal(NewTestLogger(t), NewTestClient(), 201, dir)
+		assert.Equal(t, journal.URL(), "https://www.furaffinity.net/journal/201")
+		assert.Assert(t, !journal.IsSaved())
+
+		err := journal.Save(t.Context())
+		assert.NilError(t, err)
+		assert.Assert(t, journal.IsSaved())
+
+		want, err := NewTestClient().Get(t.Context(), journal.URL())
+		assert.NilError(t, err)
+		//#nosec G304: path is from test data
+		have, err := os.ReadFile(filepath.Join(dir, "201.html"))
+		assert.NilError(t, err)
+		assert.DeepEqual(t, have, want)
+
+		//#nosec G304: path is from test data
+		data, err := os.ReadFile(filepath.Join(dir, "201.json"))
+		assert.NilError(t, err)
+		var meta main.JournalMetadata
+		err = json.Unmarshal(data, &meta)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, meta, main.JournalMetadata{
+			ID:     201,
+			Title:  "Commissions open",
+			Artist: journalArtist,
+			Posted: time.Date(2023, time.September, 4, 19, 41, 0, 0, time.UTC),
+			Text:   "Slots are open!\nPrices start at 10 dollars.",
+		})
+	})
+
+	t.Run("unrecognized page is saved without a sidecar", func(t *testing.T) {
+		dir := t.TempDir()
+		client := NewTestClient()
+		client.SetResponse("https://www.furaffinity.net/journal/202", []byte("<html><body></body></html>"), nil)
+		journal := main.NewJournal(NewTestLogger(t), client, 202, dir)
+
+		err := journal.Save(t.Context())
+		assert.NilError(t, err)
+		assert.Assert(t, journal.IsSaved())
+		_, err = os.Stat(filepath.Join(dir, "202.json"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("fetch errors are returned", func(t *testing.T) {
+		dir := t.TempDir()
+		journal := main.NewJournal(NewTestLogger(t), NewTestClient(), 999, dir)
+
+		err := journal.Save(t.Context())
+		assert.ErrorIs(t, err, main.ErrHTTPNotFound)
+		assert.Assert(t, !journal.IsSaved())
+	})
+}
+
+func TestArtist_Journals(t *testing.T) {
+	t.Run("links to the same journal are counted once", func(t *testing.T) {
+		artist := main.NewArtist(NewTestLogger(t), NewTestClient(), journalArtist, t.TempDir())
+		journals, err := artist.Journals(t.Context(), false)
+		assert.NilError(t, err)
+		assert.Equal(t, len(journals), 1)
+		assert.Equal(t, journals[0].ID(), uint64(201))
+		assert.Equal(t, journals[0].Dir(), filepath.Join(artist.Dir(), "journals"))
+	})
+
+	t.Run("stops at a saved journal unless re-crawling", func(t *testing.T) {
+		client := NewTestClient()
+		client.SetResponse("https://www.furaffinity.net/journals/"+journalArtist+"/1",
+			[]byte(`<a href="/journal/203/">c</a><a href="/journal/202/">b</a><a href="/journal/201/">a</a>`), nil)
+		client.SetResponse("https://www.furaffinity.net/journal/202", []byte("<title>b -- Fur Affinity</title>"), nil)
+		artist := main.NewArtist(NewTestLogger(t), client, journalArtist, t.TempDir())
+		err := main.NewJournal(NewTestLogger(t), client, 202, filepath.Join(artist.Dir(), "journals")).
+			Save(t.Context())
+		assert.NilError(t, err)
+
+		journals, err := artist.Journals(t.Context(), false)
+		assert.NilError(t, err)
+		assert.Equal(t, len(journals), 1)
+		assert.Equal(t, journals[0].ID(), uint64(203))
+
+		// Oldest first
+		journals, err = artist.Journals(t.Context(), true)
+		assert.NilError(t, err)
+		assert.Equal(t, len(journals), 3)
+		assert.Equal(t, journals[0].ID(), uint64(201))
+		assert.Equal(t, journals[2].ID(), uint64(203))
+	})
+
+	t.Run("layout error on non-numeric journal ID", func(t *testing.T) {
+		client := NewTestClient()
+		client.SetResponse("https://www.furaffinity.net/journals/"+journalArtist+"/1",
+			[]byte(`<a href="/journal/not-a-number/">x</a>`), nil)
+		artist := main.NewArtist(NewTestLogger(t), client, journalArtist, t.TempDir())
+
+		_, err := artist.Journals(t.Context(), false)
+		assert.ErrorIs(t, err, main.ErrSiteLayoutChanged)
+	})
+}
+
+func TestScraper_Journals(t *testing.T) {
+	t.Run("journals are off by default", func(t *testing.T) {
+		tempdir := t.TempDir()
+		scraper := main.NewScraper(NewTestLogger(t), NewTestClient(), "", []string{journalArtist}, false, false, tempdir)
+		err := scraper.Run(t.Context())
+		assert.NilError(t, err)
+		assert.DeepEqual(t, scraper.Summary(), main.RunSummary{
+			ArtistsTotal:     1,
+			ArtistsCompleted: 1,
+			Submissions:      4,
+		})
+		_, err = os.Stat(filepath.Join(tempdir, journalArtist, "journals"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("failed journal is recorded and retried", func(t *testing.T) {
+		tempdir := t.TempDir()
+		client := NewTestClient()
+		client.SetResponse("https://www.furaffinity.net/journal/201", nil,
+			errors.New("network error")) //nolint:err113 // dynamic test error
+
+		scraper := main.NewScraper(NewTestLogger(t), client, "", []string{journalArtist}, false, false, tempdir)
+		scraper.SetJournals(true)
+		scraper.SetContinueOnError(true)
+		err := scraper.Run(t.Context())
+		assert.NilError(t, err)
+		assert.Equal(t, scraper.Summary().Failures, 1)
+
+		entries := readJSON[[]main.FailureEntry](t, filepath.Join(tempdir, "failures.json"))
+		assert.Equal(t, len(entries), 1)
+		assert.Equal(t, entries[0].Kind, "journal")
+		assert.Equal(t, entries[0].ID, uint64(201))
+		assert.Equal(t, entries[0].Artist, journalArtist)
+		assert.Equal(t, entries[0].Dir, journalArtist+"/journals")
+
+		scraper = main.NewScraper(NewTestLogger(t), NewTestClient(), "", nil, false, false, tempdir)
+		err = scraper.RetryFailed(t.Context())
+		assert.NilError(t, err)
+		assert.DeepEqual(t, scraper.Summary(), main.RunSummary{Journals: 1})
+		_, err = os.Stat(filepath.Join(tempdir, journalArtist, "journals", "201.html"))
+		assert.NilError(t, err)
+	})
+}
@@ -0,0 +1,134 @@
+package main
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ListedSubmission is one submission found in a list of other artists' work,
+// like favorites, search results or the submission inbox.
+type ListedSubmission struct {
+	ID     uint64 `json:"id"`
+	Artist string `json:"artist"` // May be empty if the page didn't say
+}
+
+// SubmissionList is the part of a recorded list, like a favorites list or a
+// search record, which lists the submissions, newest first.
+type SubmissionList struct {
+	UpdatedAt   time.Time          `json:"updated_at"`
+	Submissions []ListedSubmission `json:"submissions"`
+}
+
+// known returns the IDs of the submissions in the list, so a crawl can stop
+// at the first page with nothing new.
+//
+// Returns:
+//   - map[uint64]bool: The IDs in the list
+func (l *SubmissionList) known() map[uint64]bool {
+	known := make(map[uint64]bool, len(l.Submissions))
+	for _, entry := range l.Submissions {
+		known[entry.ID] = true
+	}
+	return known
+}
+
+// recordListed merges newly crawled submissions into a recorded list, and
+// writes the record out.
+//
+// Parameters:
+//   - filePath: Where the record is saved
+//   - record: The whole record, as loaded, which is what gets written
+//   - list: The list within record
+//   - crawled: The submissions just crawled
+//   - complete: If true, crawled is the whole list and replaces the record
+//
+// Returns:
+//   - error: Any error writing the record
+func recordListed(filePath string, record any, list *SubmissionList, crawled []ListedSubmission,
+	complete bool,
+) error {
+	list.Submissions = mergeListed(crawled, list.Submissions, complete)
+	list.UpdatedAt = time.Now().UTC()
+
+	err := os.MkdirAll(filepath.Dir(filePath), submissionDirPermissions)
+	if err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	err = writeJSONFileAtomic(filePath, record)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", filePath, err)
+	}
+	return nil
+}
+
+// mergeListed merges newly crawled submissions into a recorded list.  The
+// crawled submissions come first, since they're the newest.
+//
+// Parameters:
+//   - crawled: The submissions just crawled
+//   - recorded: The submissions previously recorded
+//   - complete: If true, crawled is the whole list and replaces the record
+//
+// Returns:
+//   - []ListedSubmission: The merged list
+func mergeListed(crawled []ListedSubmission, recorded []ListedSubmission, complete bool) []ListedSubmission {
+	if complete {
+		return crawled
+	}
+
+	merged := crawled
+	seen := make(map[uint64]bool, len(crawled))
+	for _, entry := range crawled {
+		seen[entry.ID] = true
+	}
+	for _, entry := range recorded {
+		if !seen[entry.ID] {
+			merged = append(merged, entry)
+		}
+	}
+	return merged
+}
+
+// parseSubmissionFigures extracts the submissions from the thumbnail figures
+// on a page listing other artists' work, like favorites or the submission
+// inbox.  Each figure's caption links to the artist.
+//
+// Parameters:
+//   - url: The URL of the page, for error reporting
+//   - body: The HTML content of the page, for error reporting
+//   - doc: The parsed page
+//
+// Returns:
+//   - []ListedSubmission: The submissions on this page, in page order
+//   - error: A *SiteLayoutError if a figure isn't in the expected format
+func parseSubmissionFigures(url string, body []byte, doc *goquery.Document) ([]ListedSubmission, error) {
+	var entries []ListedSubmission
+	var layoutErr error
+	doc.Find("figure[id^='sid-']").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		sid, _ := s.Attr("id")
+		id, err := strconv.ParseUint(strings.TrimPrefix(sid, "sid-"), 10, 64)
+		if err != nil {
+			layoutErr = newSiteLayoutError(url, body, "non-numeric submission ID", sid)
+			return false
+		}
+		artist := userFromLinks(s.Find("figcaption a"))
+		if artist != "" && !filepath.IsLocal(artist) {
+			layoutErr = newSiteLayoutError(url, body, "invalid artist username", artist)
+			return false
+		}
+		entries = append(entries, ListedSubmission{ID: id, Artist: artist})
+		return true
+	})
+	if layoutErr != nil {
+		return nil, layoutErr
+	}
+	return entries, nil
+}
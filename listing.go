@@ -0,0 +1,104 @@
+package main
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+const (
+	// Maximum number of pages to crawl in a paginated listing, like a user's
+	// favorites.  Like maxGalleryPages, this is unreasonably high and only
+	// used to prevent infinite loops.
+	maxListingPages = 1000
+)
+
+// listingCrawl describes a paginated listing, like a user's favorites or an
+// artist's journals, newest first.  Crawling it fetches pages until the last
+// one, or, unless re-crawling, until it reaches what an earlier crawl found.
+type listingCrawl[T any] struct {
+	name     string // What is listed, for logs and errors, e.g. "favorites"
+	firstURL string // The address of the first page
+	logArgs  []any  // Added to log messages, e.g. the user whose listing it is
+
+	// fetchPage fetches a page of the listing.  pageNum starts from 1.
+	fetchPage func(ctx context.Context, url string, pageNum int) ([]byte, error)
+
+	// nextPage extracts the items on a page, and the address of the next
+	// page, which is empty on the last page.
+	nextPage func(url string, body []byte, pageNum int) ([]T, string, error)
+
+	// isKnown reports whether an item was found by an earlier crawl.
+	isKnown func(item T) bool
+
+	// If true, stop at the first known item, rather than after the first
+	// page with nothing new on it.
+	stopAtKnown bool
+}
+
+// crawl fetches the pages of the listing.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - logger: Logger instance
+//   - reCrawl: If true, crawl the whole listing
+//
+// Returns:
+//   - []T: The items found, newest first
+//   - error: Any error fetching or parsing the pages, or a *SiteLayoutError if
+//     there are too many
+func (l *listingCrawl[T]) crawl(ctx context.Context, logger *slog.Logger, reCrawl bool) ([]T, error) {
+	var items []T
+	url := l.firstURL
+	var body []byte
+	for pageNum := 1; ; pageNum++ {
+		// Sanity check to prevent infinite loops
+		if pageNum > maxListingPages {
+			logger.Error("maximum listing pages exceeded",
+				append([]any{"listing", l.name, "maxPages", maxListingPages}, l.logArgs...)...)
+			return nil, newSiteLayoutError(url, body,
+				fmt.Sprintf("maximum %s pages (%d) exceeded", l.name, maxListingPages), "")
+		}
+
+		var err error
+		body, err = l.fetchPage(ctx, url, pageNum)
+		if err != nil {
+			logger.Error("listing: page fetch error", "listing", l.name, "url", url, "error", err)
+			return nil, fmt.Errorf("failed to fetch %s page: %w", l.name, err)
+		}
+
+		pageItems, next, err := l.nextPage(url, body, pageNum)
+		if err != nil {
+			return nil, err
+		}
+
+		newItems := 0
+		reachedKnown := false
+		for _, item := range pageItems {
+			if !reCrawl && l.isKnown(item) {
+				reachedKnown = true
+				if l.stopAtKnown {
+					break
+				}
+				continue
+			}
+			newItems++
+		}
+		if l.stopAtKnown {
+			items = append(items, pageItems[:newItems]...)
+		} else {
+			items = append(items, pageItems...)
+		}
+		logger.Debug("listing "+l.name,
+			append([]any{"page", pageNum, "count", len(pageItems), "new", newItems}, l.logArgs...)...)
+
+		if next == "" || (!reCrawl && (newItems == 0 || (l.stopAtKnown && reachedKnown))) {
+			break
+		}
+		url = next
+	}
+
+	return items, nil
+}
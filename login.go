@@ -0,0 +1,75 @@
+package main
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	// The page fetched to see who we're logged in as.  Any page has the
+	// logged-in user in its header, but this one is small, and FA redirects
+	// it to the login form if we aren't logged in.
+	loginCheckURL = "https://www.furaffinity.net/controls/settings/"
+)
+
+var (
+	ErrNotLoggedIn  = errors.New("not logged in, are the cookies still valid?")
+	ErrWrongAccount = errors.New("logged in as the wrong account")
+)
+
+// VerifyLogin checks who FA thinks we're logged in as.  Cookies can look
+// valid but have been logged out on the server, e.g. by logging out in the
+// browser they came from.  A run with such cookies would carry on and
+// silently miss everything that needs a login, so this is checked before
+// starting and periodically during long runs.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - client: HTTP client with the cookies loaded
+//   - expected: The username we should be logged in as, or empty for any
+//
+// Returns:
+//   - string: The logged-in username
+//   - error: ErrNotLoggedIn, ErrWrongAccount, or any error fetching the page
+func VerifyLogin(ctx context.Context, client Client, expected string) (string, error) {
+	body, err := client.GetWithDelay(ctx, loginCheckURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to check login: %w", err)
+	}
+
+	username := parseLoggedInUser(body)
+	if username == "" {
+		return "", ErrNotLoggedIn
+	}
+	if expected != "" && !strings.EqualFold(username, expected) {
+		return username, fmt.Errorf("%w: cookies are for %s, not %s", ErrWrongAccount, username, expected)
+	}
+	return username, nil
+}
+
+// parseLoggedInUser finds the logged-in user in a page's header.  The classic
+// template links to their page as #my-username.  The modern template links to
+// it with their avatar.  Neither is there when logged out.
+//
+// Parameters:
+//   - body: The HTML content of any FA page
+//
+// Returns:
+//   - string: The logged-in username, or empty if not logged in
+func parseLoggedInUser(body []byte) string {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		// goquery only fails if reading fails, which can't happen with an
+		// in-memory byte slice.
+		fatalInvariant(err)
+	}
+	links := doc.Find("a#my-username").AddSelection(doc.Find("img.loggedin_user_avatar").Closest("a"))
+	return userFromLinks(links)
+}
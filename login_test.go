@@ -0,0 +1,131 @@
+package main_test
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"context"
+	main "furtrap"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+const loginCheckURL = "https://www.furaffinity.net/controls/settings/"
+
+var (
+	// The header of a page in the modern template, logged in as Some-User.
+	modernLoggedIn = []byte(`<html><body><nav id="ddmenu"><ul>
+		<li><a href="/user/some-user/"><img class="loggedin_user_avatar avatar" alt="Some-User"
+			src="//a.furaffinity.net/1/some-user.gif"></a></li>
+	</ul></nav></body></html>`)
+
+	// The header of a page in the classic template, logged in as Some-User.
+	classicLoggedIn = []byte(`<html><body><table><tr><td class="header_bkg">
+		<a id="my-username" href="/user/some-user/">~Some-User</a> | <a href="/logout/">Log Out</a>
+	</td></tr></table></body></html>`)
+
+	// Where FA sends us when we aren't logged in.
+	loggedOut = []byte(`<html><body><a href="/login">Log In</a><form action="/login/"></form></body></html>`)
+)
+
+// expiringSessionClient is a TestClient whose session is logged out after
+// the login has been checked a number of times.
+type expiringSessionClient struct {
+	*TestClient
+	checksLeft int
+}
+
+// GetWithDelay serves the login check page, logged in until checksLeft runs
+// out.  Other pages come from the TestClient.
+func (c *expiringSessionClient) GetWithDelay(ctx context.Context, uri string) ([]byte, error) {
+	if uri != loginCheckURL {
+		return c.TestClient.GetWithDelay(ctx, uri)
+	}
+	if c.checksLeft == 0 {
+		return loggedOut, nil
+	}
+	c.checksLeft--
+	return modernLoggedIn, nil
+}
+
+func TestVerifyLogin(t *testing.T) {
+	tests := []struct {
+		name     string
+		page     []byte
+		expected string
+		username string
+		err      error
+	}{
+		{
+			name:     "modern template",
+			page:     modernLoggedIn,
+			username: "some-user",
+		},
+		{
+			name:     "classic template",
+			page:     classicLoggedIn,
+			username: "some-user",
+		},
+		{
+			name:     "matching account",
+			page:     modernLoggedIn,
+			expected: "Some-User",
+			username: "some-user",
+		},
+		{
+			name:     "wrong account",
+			page:     modernLoggedIn,
+			expected: "someone-else",
+			username: "some-user",
+			err:      main.ErrWrongAccount,
+		},
+		{
+			name: "logged out",
+			page: loggedOut,
+			err:  main.ErrNotLoggedIn,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewTestClient()
+			client.SetResponse(loginCheckURL, tt.page, nil)
+
+			username, err := main.VerifyLogin(t.Context(), client, tt.expected)
+			assert.Equal(t, username, tt.username)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NilError(t, err)
+		})
+	}
+}
+
+func TestScraper_LoginCheck(t *testing.T) {
+	artists := []string{"artist-with-two-submissions"}
+
+	t.Run("logged out before starting", func(t *testing.T) {
+		client := NewTestClient()
+		client.SetResponse(loginCheckURL, loggedOut, nil)
+		scraper := main.NewScraper(NewTestLogger(t), client, "", artists, false, false, t.TempDir())
+		scraper.SetLoginCheck("", time.Hour)
+
+		err := scraper.Run(t.Context())
+		assert.ErrorIs(t, err, main.ErrNotLoggedIn)
+		assert.DeepEqual(t, scraper.Summary(), main.RunSummary{})
+	})
+
+	t.Run("logged out during the run", func(t *testing.T) {
+		client := &expiringSessionClient{TestClient: NewTestClient(), checksLeft: 2}
+		scraper := main.NewScraper(NewTestLogger(t), client, "", artists, false, false, t.TempDir())
+		scraper.SetLoginCheck("", time.Nanosecond)
+		scraper.SetSubmissions([]uint64{101})
+
+		// Checked at the start and before the artist, but not the submission.
+		err := scraper.Run(t.Context())
+		assert.ErrorIs(t, err, main.ErrNotLoggedIn)
+		assert.Equal(t, scraper.Summary().ArtistsCompleted, 1)
+	})
+}
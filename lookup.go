@@ -0,0 +1,187 @@
+package main
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	// How many regex capture groups submissionPathRegexp and
+	// downloadArtistRegexp should have.
+	submissionPathRegexpCaptures = 2
+	downloadArtistRegexpCaptures = 2
+)
+
+var (
+	ErrInvalidSubmissionRef = errors.New("not a submission ID or URL")
+	ErrArtistNotFound       = errors.New("could not find artist on submission page")
+
+	// Regex to pull the ID out of a /view/ or /full/ URL path.
+	submissionPathRegexp = regexp.MustCompile(`^/(?:view|full)/(\d+)/?$`)
+
+	// Regex to pull the artist's username out of a download URL, e.g.
+	// https://d.furaffinity.net/art/<artist>/1234567890/1234567890.artist_file.png
+	// Security: The capture group can't contain slashes, so the username
+	// can't be used for directory traversal.
+	downloadArtistRegexp = regexp.MustCompile(`^https://[^/]+/art/([^/]+)/`)
+)
+
+// ParseSubmissionRef parses a submission reference given on the command line.
+// This can be a numeric ID, or any FA /view/ or /full/ URL.
+//
+// Parameters:
+//   - ref: The reference, e.g. "12345" or "https://www.furaffinity.net/view/12345/"
+//
+// Returns:
+//   - uint64: The submission ID
+//   - error: ErrInvalidSubmissionRef if ref isn't recognized
+func ParseSubmissionRef(ref string) (uint64, error) {
+	ref = strings.TrimSpace(ref)
+
+	id, err := strconv.ParseUint(ref, 10, 64)
+	if err == nil {
+		return id, nil
+	}
+
+	parsed, err := url.Parse(ref)
+	if err != nil || !strings.HasSuffix(parsed.Hostname(), "furaffinity.net") {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidSubmissionRef, ref)
+	}
+
+	matches := submissionPathRegexp.FindStringSubmatch(parsed.Path)
+	if len(matches) != submissionPathRegexpCaptures {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidSubmissionRef, ref)
+	}
+
+	id, err = strconv.ParseUint(matches[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidSubmissionRef, ref)
+	}
+	return id, nil
+}
+
+// ReadSubmissionsFile reads submission references from a file, one per line.
+// Blank lines and lines starting with "#" are ignored.
+//
+// Parameters:
+//   - path: The file to read
+//
+// Returns:
+//   - []uint64: The submission IDs, in file order
+//   - error: Any error reading the file, or the first invalid reference
+func ReadSubmissionsFile(path string) ([]uint64, error) {
+	//#nosec G304: path is provided by the user
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read submissions file: %w", err)
+	}
+
+	var ids []uint64
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		id, err := ParseSubmissionRef(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, lineNum, err)
+		}
+		ids = append(ids, id)
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read submissions file: %w", err)
+	}
+	return ids, nil
+}
+
+// LookupSubmission fetches a submission's /view/ page to find out where it
+// belongs in the output tree: under the artist's directory, in scraps/ if
+// it's a scrap.  This lets a submission be downloaded on its own and land in
+// the same place a gallery crawl would put it.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - logger: Logger instance
+//   - client: HTTP client interface for making web requests
+//   - outputDir: The root of the output tree
+//   - id: The FurAffinity submission ID
+//
+// Returns:
+//   - *Submission: The submission, in the right directory
+//   - string: The artist's username
+//   - []byte: The /view/ page, for Submission.SaveFromViewPage
+//   - error: Any error fetching or parsing the page
+func LookupSubmission(
+	ctx context.Context, logger *slog.Logger, client Client, outputDir string, id uint64,
+) (*Submission, string, []byte, error) {
+	pageContent, err := client.GetWithDelay(ctx, viewPageURL(id))
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to get submission page: %w", err)
+	}
+
+	// The download link is the most reliable place to find the artist's
+	// username as it appears in URLs, rather than their display name.
+	downloadURL, _, err := parseURLAndFilenameFromViewPage(pageContent)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	matches := downloadArtistRegexp.FindStringSubmatch(downloadURL)
+	if len(matches) != downloadArtistRegexpCaptures || !filepath.IsLocal(matches[1]) {
+		return nil, "", nil, fmt.Errorf("%w: download URL %s", ErrArtistNotFound, downloadURL)
+	}
+	artist := matches[1]
+
+	scraps, err := isScrapsViewPage(pageContent, artist)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	submissionDir := filepath.Join(outputDir, artist)
+	if scraps {
+		submissionDir = filepath.Join(submissionDir, "scraps")
+	}
+	logger.Debug("Looked up submission", "id", id, "artist", artist, "scraps", scraps)
+	return NewSubmission(logger, client, id, submissionDir), artist, pageContent, nil
+}
+
+// isScrapsViewPage reports whether a /view/ page is for a scrap.  FA links
+// scraps back to the artist's scraps rather than their main gallery.
+//
+// Parameters:
+//   - pageContent: The submission's /view/ page
+//   - artist: The artist's username
+//
+// Returns:
+//   - bool: true if the submission is in the artist's scraps
+//   - error: Any error parsing the page
+func isScrapsViewPage(pageContent []byte, artist string) (bool, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(pageContent))
+	if err != nil {
+		return false, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	scrapsPath := "/scraps/" + artist
+	found := false
+	doc.Find("a[href^='/scraps/']").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		href, _ := s.Attr("href")
+		found = href == scrapsPath || strings.HasPrefix(href, scrapsPath+"/")
+		return !found
+	})
+	return found, nil
+}
@@ -0,0 +1,131 @@
+package main_test
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	main "furtrap"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParseSubmissionRef(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want uint64
+	}{
+		{"12345", 12345},
+		{" 12345\n", 12345},
+		{"https://www.furaffinity.net/view/12345/", 12345},
+		{"https://www.furaffinity.net/view/12345", 12345},
+		{"https://www.furaffinity.net/full/12345/", 12345},
+		{"http://furaffinity.net/view/12345/?upload-successful", 12345},
+		{"https://www.furaffinity.net/view/12345/#cid:678", 12345},
+	}
+	for _, tt := range tests {
+		have, err := main.ParseSubmissionRef(tt.ref)
+		assert.NilError(t, err, tt.ref)
+		assert.Equal(t, have, tt.want, tt.ref)
+	}
+
+	invalid := []string{
+		"",
+		"abc",
+		"-5",
+		"https://www.furaffinity.net/user/someone/",
+		"https://www.furaffinity.net/view/abc/",
+		"https://example.com/view/12345/",
+	}
+	for _, ref := range invalid {
+		_, err := main.ParseSubmissionRef(ref)
+		assert.ErrorIs(t, err, main.ErrInvalidSubmissionRef, ref)
+	}
+}
+
+func TestReadSubmissionsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "submissions.txt")
+
+	t.Run("valid file", func(t *testing.T) {
+		err := os.WriteFile(path, []byte("# favorites to grab\n101\n\nhttps://www.furaffinity.net/view/104/\n"), 0600)
+		assert.NilError(t, err)
+
+		have, err := main.ReadSubmissionsFile(path)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, have, []uint64{101, 104})
+	})
+
+	t.Run("invalid line", func(t *testing.T) {
+		err := os.WriteFile(path, []byte("101\nnonsense\n"), 0600)
+		assert.NilError(t, err)
+
+		_, err = main.ReadSubmissionsFile(path)
+		assert.ErrorIs(t, err, main.ErrInvalidSubmissionRef)
+		assert.ErrorContains(t, err, "line 2")
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := main.ReadSubmissionsFile(filepath.Join(t.TempDir(), "nonexistent"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
+
+func TestLookupSubmission(t *testing.T) {
+	client := NewTestClient()
+	outputDir := t.TempDir()
+
+	tests := []struct {
+		id      uint64
+		wantDir string
+	}{
+		{101, filepath.Join(outputDir, "artist-with-two-submissions")},
+		{102, filepath.Join(outputDir, "artist-with-two-submissions")},
+		{103, filepath.Join(outputDir, "artist-with-two-submissions", "scraps")},
+		{104, filepath.Join(outputDir, "artist-with-two-submissions", "scraps")},
+	}
+	for _, tt := range tests {
+		submission, artist, page, err := main.LookupSubmission(t.Context(), NewTestLogger(t), client, outputDir, tt.id)
+		assert.NilError(t, err)
+		assert.Equal(t, submission.ID(), tt.id)
+		assert.Equal(t, submission.Dir(), tt.wantDir)
+		assert.Equal(t, artist, "artist-with-two-submissions")
+		assert.Assert(t, len(page) > 0)
+	}
+
+	t.Run("missing submission", func(t *testing.T) {
+		_, _, _, err := main.LookupSubmission(t.Context(), NewTestLogger(t), client, outputDir, 99999)
+		assert.ErrorIs(t, err, main.ErrHTTPNotFound)
+	})
+}
+
+func TestScraper_SingleSubmissions(t *testing.T) {
+	tempdir := t.TempDir()
+	scraper := main.NewScraper(NewTestLogger(t), NewTestClient(), "", nil, false, false, tempdir)
+	scraper.SetSubmissions([]uint64{102, 103})
+	err := scraper.Run(t.Context())
+	assert.NilError(t, err)
+	assert.DeepEqual(t, scraper.Summary(), main.RunSummary{Submissions: 2})
+
+	for _, fn := range []string{
+		"artist-with-two-submissions/2222222222.artist-with-two-submissions_test-image-2.png.102.html",
+		"artist-with-two-submissions/scraps/3333333333.artist-with-two-submissions_scrap-image-1.png.103.html",
+	} {
+		_, err := os.Stat(filepath.Join(tempdir, fn))
+		assert.NilError(t, err, fn)
+	}
+	assert.Equal(t, len(readArchiveIndex(t, tempdir)), 2)
+
+	// A second run finds them already saved.  So does a gallery crawl, which
+	// stops at each of them as the newest saved submission.
+	scraper = main.NewScraper(NewTestLogger(t), NewTestClient(), "",
+		[]string{"artist-with-two-submissions"}, false, false, tempdir)
+	scraper.SetSubmissions([]uint64{102, 103})
+	err = scraper.Run(t.Context())
+	assert.NilError(t, err)
+	assert.DeepEqual(t, scraper.Summary(), main.RunSummary{
+		ArtistsTotal:     1,
+		ArtistsCompleted: 1,
+		Submissions:      1, // 101, which is older than 102
+	})
+}
@@ -7,15 +7,38 @@ package main
 // scraper and download tool.
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
 	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/spf13/pflag"
 )
 
+const (
+	// Process exit codes.  Interrupted follows the shell convention of
+	// 128+SIGINT so scripts can tell a clean shutdown apart from a failure.
+	exitCodeError       = 1
+	exitCodeInterrupted = 130
+
+	// Default for --inbox-fallback
+	defaultInboxFallback = 30 * 24 * time.Hour
+
+	// Default for --login-recheck
+	defaultLoginRecheck = time.Hour
+
+	// Default for refresh-comments --older-than
+	defaultCommentsRefreshAge = 7 * 24 * time.Hour
+)
+
 var (
 	// Build information, set via -ldflags at build time.
 	buildGitCommitHash = "unknown"
@@ -24,37 +47,78 @@ var (
 
 // Config holds the application configuration parsed from CLI flags.
 type Config struct {
-	Debug      bool     // Enable debug logging
-	ReCrawl    bool     // Re-crawl all the way through galleries
-	SkipScraps bool     // Skip downloading scraps
-	NoThrottle bool     // Disable wait time between requests
-	Username   string   // Username to scrape watchlist from
-	OutputDir  string   // Output directory for downloads
-	CookieFile string   // Path to cookies.txt file
-	Artists    []string // Artists to scrape submissions from
+	Debug           bool           // Enable debug logging
+	ReCrawl         bool           // Re-crawl all the way through galleries
+	SkipScraps      bool           // Skip downloading scraps
+	Journals        bool           // Download artists' journals
+	Profiles        bool           // Save snapshots of artists' profiles
+	RecordFolders   bool           // Record artists' gallery folder membership
+	NoThrottle      bool           // Disable wait time between requests
+	ContinueOnError bool           // Record failures in the ledger and keep going
+	Username        string         // Username to scrape watchlist from
+	OutputDir       string         // Output directory for downloads
+	CookieFile      string         // Path to cookies file
+	Artists         []string       // Artists to scrape submissions from
+	Submissions     []string       // Individual submission IDs or URLs to download
+	SubmissionsFile string         // File listing submission IDs or URLs to download
+	Favorites       []string       // Users whose favorites should be downloaded
+	Searches        []string       // Search queries whose results should be downloaded
+	SearchRatings   []string       // Ratings to include in searches, empty for all
+	SearchTypes     []string       // Submission types to include in searches, empty for all
+	Inbox           bool           // Find new submissions in the logged-in user's inbox
+	InboxFallback   time.Duration  // Crawl artists not seen in the inbox for this long
+	UnwatchedGrace  time.Duration  // Keep crawling artists removed from the watchlist for this long
+	MarkUnwatched   bool           // Mark the directories of artists removed from the watchlist
+	MassUnwatch     bool           // Accept a watchlist which has lost everyone, or most of the artists
+	LoginRecheck    time.Duration  // How often to verify the cookies are still logged in
+	LoginMatch      bool           // Require the cookies to be logged in as Username
+	CookieWarning   time.Duration  // Warn if the auth cookies expire within this long
+	SaveCookies     string         // Write the cookies back out to this file
+	Throttle        ThrottlePolicy // How long to wait between requests, depending on load
+	Window          string         // Time of day requests may be made, e.g. "01:00-07:00 America/Chicago"
 }
 
 func main() {
+	// Subcommands have their own flags.
+	if len(os.Args) > 1 {
+		subcommand, ok := subcommands[os.Args[1]]
+		if ok {
+			os.Exit(subcommand(os.Args[2:]))
+		}
+	}
+
 	config := ParseFlags()
 	logger := CreateLogger(os.Stderr, config.Debug)
-	client := NewHTTPClient(logger)
-	if config.NoThrottle {
-		// Even without load throttling, we still want some delay to avoid hammering the server
-		client.SetDelayFunc(func(int) { time.Sleep(defaultDelayTime) })
+	client, err := setupHTTPClient(logger, config.CookieFile, config.CookieWarning, config.Throttle, config.NoThrottle)
+	if err != nil {
+		logger.Error("Failed to load cookies", "file", config.CookieFile, "error", err)
+		os.Exit(exitCodeError)
 	}
-	if config.CookieFile != "" {
-		err := client.LoadCookies(config.CookieFile)
-		if err != nil {
-			logger.Error("Failed to load cookies", "file", config.CookieFile, "error", err)
-			os.Exit(1)
-		}
+	client.SetCookieSaving(config.SaveCookies, defaultCookieSaveInterval)
+	window, err := ParseOperatingWindow(config.Window)
+	if err != nil {
+		logger.Error("Invalid operating window", "error", err)
+		os.Exit(exitCodeError)
 	}
+	client.SetOperatingWindow(window)
 
 	logger.Info("Starting furtrap",
 		"commit", buildGitCommitHash,
 		"buildDate", buildTimestamp)
 	logger.Debug("Configuration", "config", fmt.Sprintf("%+v", config))
 
+	submissionIDs, err := SubmissionIDs(config)
+	if err != nil {
+		logger.Error("Invalid submission", "error", err)
+		os.Exit(exitCodeError)
+	}
+
+	searches, err := SearchQueries(config)
+	if err != nil {
+		logger.Error("Invalid search", "error", err)
+		os.Exit(exitCodeError)
+	}
+
 	scraper := NewScraper(
 		logger,
 		client,
@@ -63,14 +127,124 @@ func main() {
 		config.ReCrawl,
 		config.SkipScraps,
 		config.OutputDir)
+	scraper.SetJournals(config.Journals)
+	scraper.SetProfiles(config.Profiles)
+	scraper.SetRecordFolders(config.RecordFolders)
+	scraper.SetInbox(config.Inbox, config.InboxFallback)
+	scraper.SetUnwatched(config.UnwatchedGrace, config.MarkUnwatched)
+	scraper.SetAllowMassUnwatch(config.MassUnwatch)
+	scraper.SetContinueOnError(config.ContinueOnError)
+	if config.CookieFile != "" {
+		expected := ""
+		if config.LoginMatch {
+			expected = config.Username
+		}
+		scraper.SetLoginCheck(expected, config.LoginRecheck)
+	}
+	scraper.SetSubmissions(submissionIDs)
+	scraper.SetFavorites(config.Favorites)
+	scraper.SetSearches(searches)
 
-	err := scraper.Run()
-	if err != nil {
-		logger.Error("Application error", "error", err)
-		os.Exit(1)
+	os.Exit(runScraper(logger, client, scraper, scraper.Run))
+}
+
+// setupHTTPClient creates the HTTP client used to talk to FA.
+//
+// Parameters:
+//   - logger: Logger instance
+//   - cookieFile: Path to a cookies file, or empty for none
+//   - cookieWarning: Warn if the auth cookies expire within this long
+//   - throttle: How long to wait between requests, depending on load
+//   - noThrottle: Whether to disable load throttling
+//
+// Returns:
+//   - *HTTPClient: The configured client
+//   - error: Any error encountered loading cookies
+func setupHTTPClient(
+	logger *slog.Logger,
+	cookieFile string,
+	cookieWarning time.Duration,
+	throttle ThrottlePolicy,
+	noThrottle bool,
+) (*HTTPClient, error) {
+	client := NewHTTPClient(logger)
+	policy := DefaultCookiePolicy()
+	policy.WarnWithin = cookieWarning
+	client.SetCookiePolicy(policy)
+	if noThrottle {
+		// Even without load throttling, we still want some delay to avoid hammering the server
+		throttle.Threshold = 0
 	}
+	client.SetThrottlePolicy(throttle)
+	if cookieFile != "" {
+		err := client.LoadCookies(cookieFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return client, nil
+}
 
-	logger.Info("Done!")
+// runScraper runs a scraper method with signal handling, logs the summary,
+// and works out the exit code.  Cookies which are about to expire are warned
+// about again at the end, where they'll be noticed, and the cookies are saved
+// if the client was asked to.
+//
+// Parameters:
+//   - logger: Logger instance
+//   - client: The scraper's HTTP client, for its cookies
+//   - scraper: The scraper, for its summary
+//   - run: The method to run, e.g. scraper.Run
+//
+// Returns:
+//   - int: The process exit code
+func runScraper(logger *slog.Logger, client *HTTPClient, scraper *Scraper, run func(context.Context) error) int {
+	// SIGINT or SIGTERM cancels the context, which stops the run promptly:
+	// requests in flight and sleeps are aborted.  Once canceled, the default
+	// signal behavior is restored so a second ctrl-C kills us immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	err := run(ctx)
+
+	saveErr := client.SaveCookies()
+	if saveErr != nil {
+		logger.Warn("Failed to save cookies", "error", saveErr)
+	}
+
+	summary := scraper.Summary()
+	logger.Info("Summary",
+		"artists", fmt.Sprintf("%d/%d", summary.ArtistsCompleted, summary.ArtistsTotal),
+		"submissions", summary.Submissions,
+		"journals", summary.Journals,
+		"profiles", summary.Profiles,
+		"skipped", summary.ArtistsSkipped,
+		"unavailable", summary.ArtistsUnavailable,
+		"failures", summary.Failures)
+	for _, expiry := range client.ExpiringCookies(time.Now()) {
+		logger.Warn("Cookie expires soon, update your cookies file",
+			"cookie", expiry.Name, "expires", expiry.Expires)
+	}
+
+	switch {
+	case err == nil && (summary.Failures > 0 || summary.ArtistsSkipped > 0):
+		// Finished, but scripts should know it wasn't a complete success.
+		logger.Warn("Done, with failures")
+		return exitCodeError
+	case err == nil:
+		logger.Info("Done!")
+		return 0
+	case errors.Is(err, context.Canceled):
+		logger.Warn("Interrupted, exiting")
+		return exitCodeInterrupted
+	default:
+		logger.Error("Application error", "error", err)
+		return exitCodeError
+	}
 }
 
 // ParseFlags parses command line flags and returns a Config.
@@ -83,28 +257,193 @@ func ParseFlags() Config {
 	pflag.BoolVarP(&config.Debug, "debug", "d", false, "Enable debug logging")
 	pflag.BoolVarP(&config.ReCrawl, "recrawl", "r", false, "Re-crawl galleries looking for missed submissions")
 	pflag.BoolVarP(&config.SkipScraps, "skip-scraps", "s", false, "Don't download scraps")
+	pflag.BoolVarP(&config.Journals, "journals", "j", false, "Download artists' journals")
+	pflag.BoolVarP(&config.Profiles, "profiles", "p", false, "Save snapshots of artists' profiles")
+	pflag.BoolVar(&config.RecordFolders, "record-folders", false,
+		"Record which gallery folders each artist's submissions are in")
 	pflag.BoolVarP(&config.NoThrottle, "no-throttle", "n", false, "Disable wait time between requests")
+	addThrottleFlags(pflag.CommandLine, &config.Throttle)
+	pflag.StringVar(&config.Window, "window", "",
+		"Only make requests during this time of day, e.g. \"01:00-07:00 America/Chicago\", pausing outside it")
+	pflag.BoolVar(&config.ContinueOnError, "continue-on-error", false,
+		"Record failed artists and submissions in the failure ledger and keep going")
 	pflag.StringVarP(&config.Username, "username", "u", "", "Download all artists in this user's watchlist")
 	pflag.StringSliceVarP(&config.Artists, "artists", "a", nil,
-		"Download all submissions from comma-separated list of artists")
+		"Download all submissions from comma-separated list of artists.  "+
+			"Use artist/folder to download only one gallery folder")
+	pflag.StringSliceVar(&config.Submissions, "submission", nil,
+		"Download individual submissions, given as comma-separated IDs or /view/ URLs")
+	pflag.StringVar(&config.SubmissionsFile, "submissions-file", "",
+		"Download individual submissions listed in this file, one ID or URL per line")
+	pflag.StringSliceVar(&config.Favorites, "favorites", nil,
+		"Download the favorites of comma-separated list of users")
+	pflag.StringArrayVar(&config.Searches, "search", nil,
+		"Download the results of this search.  May be repeated")
+	pflag.StringSliceVar(&config.SearchRatings, "search-ratings", nil,
+		"Only include these ratings in searches: general, mature, adult (default all)")
+	pflag.StringSliceVar(&config.SearchTypes, "search-types", nil,
+		"Only include these types in searches: art, music, flash, story, photo, poetry (default all)")
+	pflag.BoolVar(&config.Inbox, "inbox", false,
+		"Find new submissions in the logged-in user's submission inbox instead of crawling every gallery (requires -c)")
+	pflag.DurationVar(&config.InboxFallback, "inbox-fallback", defaultInboxFallback,
+		"With --inbox, still crawl artists who haven't been seen in the inbox for this long")
+	pflag.DurationVar(&config.UnwatchedGrace, "unwatched-grace", 0,
+		"Keep crawling artists removed from the watchlist for this long")
+	pflag.BoolVar(&config.MarkUnwatched, "mark-unwatched", false,
+		"Write unwatched.json in the directories of artists removed from the watchlist")
+	pflag.BoolVar(&config.MassUnwatch, "allow-mass-unwatch", false,
+		"Accept a watchlist which has lost everyone, or more than half of the artists, since the last run")
+	addLoginFlags(pflag.CommandLine, &config.LoginRecheck, &config.LoginMatch)
 	pflag.StringVarP(&config.OutputDir, "output", "o", "dl", "Output directory for downloads")
-	pflag.StringVarP(&config.CookieFile, "cookies", "c", "", "Path to cookies.txt file")
+	addCookieFlags(pflag.CommandLine, &config.CookieFile, &config.CookieWarning)
+	pflag.StringVar(&config.SaveCookies, "save-cookies", "",
+		"Write the cookies back to this file in cookies.txt format, at exit and as FA refreshes them.  "+
+			"May be the -c file")
 
 	pflag.Parse()
 
 	// Check for unexpected positional arguments
-	if pflag.NArg() > 0 || (config.Username == "" && config.Artists == nil) {
+	noTargets := config.Username == "" && config.Artists == nil &&
+		config.Submissions == nil && config.SubmissionsFile == "" && config.Favorites == nil &&
+		!config.Inbox && config.Searches == nil
+	if pflag.NArg() > 0 || noTargets {
 		fmt.Fprintf(os.Stderr,
-			"usage: %s [-drsn] (-u <username> | -a <artist1>[,artist2,...]) [-o <output_dir>] [-c <cookies_file>]\n\n",
+			"usage: %s [-drsjpn] [--continue-on-error] [--record-folders] (-u <username> | -a <artist1>[/folder][,artist2,...] | "+
+				"--submission <id_or_url>[,...] | --submissions-file <file> | --favorites <user1>[,user2,...] | --inbox | --search <query>) "+
+				"[--search-ratings <ratings>] [--search-types <types>] [--inbox-fallback <duration>] "+
+				"[--unwatched-grace <duration>] [--mark-unwatched] [--login-recheck <duration>] [--login-match] "+
+				"[--throttle-threshold <users>] [--throttle-delay <duration>] [--throttle-high-delay <duration>] "+
+				"[--throttle-scale-from <users>] [--throttle-budget <duration>] [--window <window>] "+
+				"[-o <output_dir>] [-c <cookies_file>] [--cookie-warning <duration>] [--save-cookies <file>]\n\n",
 			os.Args[0])
 		pflag.PrintDefaults()
-		fmt.Fprintln(os.Stderr, "\nEither --username or --artists must be specified")
-		os.Exit(1)
+		fmt.Fprintln(os.Stderr, "\nAt least one of --username, --artists, --submission, --submissions-file, --favorites, --inbox or --search must be specified")
+		fmt.Fprintf(os.Stderr, "\nSubcommands: %s\n",
+			strings.Join(slices.Sorted(maps.Keys(subcommands)), ", "))
+		os.Exit(exitCodeError)
+	}
+
+	// The inbox belongs to whoever the cookies are for.
+	if config.Inbox && config.CookieFile == "" {
+		fmt.Fprintln(os.Stderr, "--inbox requires a cookies file, given with -c")
+		os.Exit(exitCodeError)
+	}
+
+	err := config.Throttle.Validate()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitCodeError)
+	}
+
+	if config.SaveCookies != "" && config.CookieFile == "" {
+		fmt.Fprintln(os.Stderr, "--save-cookies requires a cookies file, given with -c")
+		os.Exit(exitCodeError)
+	}
+
+	if config.LoginMatch && (config.CookieFile == "" || config.Username == "") {
+		fmt.Fprintln(os.Stderr, "--login-match requires a cookies file, given with -c, and --username")
+		os.Exit(exitCodeError)
 	}
 
 	return config
 }
 
+// addThrottleFlags adds the flags which configure the throttle policy, with
+// the default policy as their defaults.
+//
+// Parameters:
+//   - flags: The flag set to add them to
+//   - policy: Where to store the parsed policy
+func addThrottleFlags(flags *pflag.FlagSet, policy *ThrottlePolicy) {
+	defaults := DefaultThrottlePolicy()
+	flags.IntVar(&policy.Threshold, "throttle-threshold", defaults.Threshold,
+		"Wait --throttle-high-delay after each page when more registered users than this are online, 0 to never")
+	flags.DurationVar(&policy.MinDelay, "throttle-delay", defaults.MinDelay,
+		"Wait at least this long after each page")
+	flags.DurationVar(&policy.HighDelay, "throttle-high-delay", defaults.HighDelay,
+		"Wait this long after each page when FA is over --throttle-threshold")
+	flags.IntVar(&policy.ScaleFrom, "throttle-scale-from", defaults.ScaleFrom,
+		"Scale the delay up from --throttle-delay when more registered users than this are online, 0 to not scale")
+	flags.DurationVar(&policy.Budget, "throttle-budget", defaults.Budget,
+		"Stop once the run has spent this long waiting on load, 0 for no limit")
+}
+
+// addCookieFlags adds the flags which load the cookies file.
+//
+// Parameters:
+//   - flags: The flag set to add them to
+//   - cookieFile: Where to store the path of the cookies file
+//   - warning: Where to store how early to warn of the auth cookies expiring
+func addCookieFlags(flags *pflag.FlagSet, cookieFile *string, warning *time.Duration) {
+	flags.StringVarP(cookieFile, "cookies", "c", "", "Path to cookies file: cookies.txt, JSON, or a Cookie header")
+	flags.DurationVar(warning, "cookie-warning", defaultCookieWarning,
+		"Warn if the auth cookies in the cookies file expire within this long")
+}
+
+// addLoginFlags adds the flags which configure checking the cookies are
+// logged in.
+//
+// Parameters:
+//   - flags: The flag set to add them to
+//   - recheck: Where to store how often to check again during the run
+//   - match: Where to store whether the login must match --username
+func addLoginFlags(flags *pflag.FlagSet, recheck *time.Duration, match *bool) {
+	flags.DurationVar(recheck, "login-recheck", defaultLoginRecheck,
+		"With -c, check the cookies are still logged in this often during the run, 0 for only at the start")
+	flags.BoolVar(match, "login-match", false,
+		"With -c, abort unless the cookies are logged in as the --username user")
+}
+
+// SubmissionIDs collects the individual submissions requested with
+// --submission and --submissions-file.
+//
+// Parameters:
+//   - config: The parsed configuration
+//
+// Returns:
+//   - []uint64: The submission IDs, command line first, then the file
+//   - error: The first reference which isn't a valid ID or URL, or an error reading the file
+func SubmissionIDs(config Config) ([]uint64, error) {
+	var ids []uint64
+	for _, ref := range config.Submissions {
+		id, err := ParseSubmissionRef(ref)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if config.SubmissionsFile != "" {
+		fileIDs, err := ReadSubmissionsFile(config.SubmissionsFile)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, fileIDs...)
+	}
+	return ids, nil
+}
+
+// SearchQueries builds the searches requested with --search, each with the
+// --search-ratings and --search-types filters.
+//
+// Parameters:
+//   - config: The parsed configuration
+//
+// Returns:
+//   - []SearchQuery: The searches, in command line order
+//   - error: ErrInvalidSearch if a query is empty or a filter is unknown
+func SearchQueries(config Config) ([]SearchQuery, error) {
+	var searches []SearchQuery
+	for _, query := range config.Searches {
+		search, err := NewSearchQuery(query, config.SearchRatings, config.SearchTypes)
+		if err != nil {
+			return nil, err
+		}
+		searches = append(searches, search)
+	}
+	return searches, nil
+}
+
 // CreateLogger creates a new slog.Logger instance with the specified output
 // writer and log level based on the debug flag.
 //
@@ -6,71 +6,159 @@ import (
 	main "furtrap"
 	"io"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/spf13/pflag"
 	"gotest.tools/v3/assert"
 )
 
+// defaultConfig returns the configuration ParseFlags gives with no flags,
+// for each test case to modify.
+func defaultConfig() main.Config {
+	return main.Config{
+		OutputDir:     "dl",
+		InboxFallback: 30 * 24 * time.Hour,
+		LoginRecheck:  time.Hour,
+		CookieWarning: 7 * 24 * time.Hour,
+		Throttle:      main.DefaultThrottlePolicy(),
+	}
+}
+
 func TestParseFlags(t *testing.T) {
 	tests := []struct {
-		name     string
-		args     []string
-		expected main.Config
+		name   string
+		args   []string
+		modify func(config *main.Config) // Changes from defaultConfig
 	}{
 		{
-			name: "only username provided",
-			args: []string{"-u", "testuser"},
-			expected: main.Config{Debug: false, ReCrawl: false, SkipScraps: false, NoThrottle: false,
-				Username: "testuser", OutputDir: "dl", CookieFile: ""},
+			name:   "only username provided",
+			args:   []string{"-u", "testuser"},
+			modify: func(c *main.Config) { c.Username = "testuser" },
+		},
+		{
+			name:   "debug flag with username",
+			args:   []string{"-d", "-u", "testuser"},
+			modify: func(c *main.Config) { c.Username, c.Debug = "testuser", true },
 		},
 		{
-			name: "debug flag with username",
-			args: []string{"-d", "-u", "testuser"},
-			expected: main.Config{Debug: true, ReCrawl: false, SkipScraps: false, NoThrottle: false,
-				Username: "testuser", OutputDir: "dl", CookieFile: ""},
+			name:   "reget flag with username",
+			args:   []string{"-r", "-u", "testuser"},
+			modify: func(c *main.Config) { c.Username, c.ReCrawl = "testuser", true },
 		},
 		{
-			name: "reget flag with username",
-			args: []string{"-r", "-u", "testuser"},
-			expected: main.Config{Debug: false, ReCrawl: true, SkipScraps: false, NoThrottle: false,
-				Username: "testuser", OutputDir: "dl", CookieFile: ""},
+			name:   "scraps flag with username",
+			args:   []string{"-s", "-u", "testuser"},
+			modify: func(c *main.Config) { c.Username, c.SkipScraps = "testuser", true },
 		},
 		{
-			name: "scraps flag with username",
-			args: []string{"-s", "-u", "testuser"},
-			expected: main.Config{Debug: false, ReCrawl: false, SkipScraps: true, NoThrottle: false,
-				Username: "testuser", OutputDir: "dl", CookieFile: ""},
+			name:   "skip journals flag with username",
+			args:   []string{"-j", "-u", "testuser"},
+			modify: func(c *main.Config) { c.Username, c.Journals = "testuser", true },
 		},
 		{
-			name: "no throttle flag with username",
-			args: []string{"-n", "-u", "testuser"},
-			expected: main.Config{Debug: false, ReCrawl: false, SkipScraps: false, NoThrottle: true,
-				Username: "testuser", OutputDir: "dl", CookieFile: ""},
+			name:   "skip profiles flag with username",
+			args:   []string{"-p", "-u", "testuser"},
+			modify: func(c *main.Config) { c.Username, c.Profiles = "testuser", true },
+		},
+		{
+			name:   "no throttle flag with username",
+			args:   []string{"-n", "-u", "testuser"},
+			modify: func(c *main.Config) { c.Username, c.NoThrottle = "testuser", true },
 		},
 		{
 			name: "all flags with username",
 			args: []string{"-d", "-r", "-s", "-n", "-u", "testuser"},
-			expected: main.Config{Debug: true, ReCrawl: true, SkipScraps: true, NoThrottle: true,
-				Username: "testuser", OutputDir: "dl", CookieFile: ""},
+			modify: func(c *main.Config) {
+				c.Username = "testuser"
+				c.Debug, c.ReCrawl, c.SkipScraps, c.NoThrottle = true, true, true, true
+			},
 		},
 		{
 			name: "mixed flags with username",
 			args: []string{"-d", "-s", "-u", "testuser"},
-			expected: main.Config{Debug: true, ReCrawl: false, SkipScraps: true, NoThrottle: false,
-				Username: "testuser", OutputDir: "dl", CookieFile: ""},
+			modify: func(c *main.Config) {
+				c.Username = "testuser"
+				c.Debug, c.SkipScraps = true, true
+			},
+		},
+		{
+			name:   "custom output directory",
+			args:   []string{"-u", "testuser", "-o", "custom_output"},
+			modify: func(c *main.Config) { c.Username, c.OutputDir = "testuser", "custom_output" },
+		},
+		{
+			name:   "continue on error",
+			args:   []string{"-u", "testuser", "--continue-on-error"},
+			modify: func(c *main.Config) { c.Username, c.ContinueOnError = "testuser", true },
+		},
+		{
+			name: "submissions only",
+			args: []string{"--submission", "101,https://www.furaffinity.net/view/102/", "--submission", "103"},
+			modify: func(c *main.Config) {
+				c.Submissions = []string{"101", "https://www.furaffinity.net/view/102/", "103"}
+			},
+		},
+		{
+			name:   "submissions file only",
+			args:   []string{"--submissions-file", "list.txt"},
+			modify: func(c *main.Config) { c.SubmissionsFile = "list.txt" },
+		},
+		{
+			name:   "favorites only",
+			args:   []string{"--favorites", "user1,user2"},
+			modify: func(c *main.Config) { c.Favorites = []string{"user1", "user2"} },
 		},
 		{
-			name: "custom output directory",
-			args: []string{"-u", "testuser", "-o", "custom_output"},
-			expected: main.Config{Debug: false, ReCrawl: false, SkipScraps: false, NoThrottle: false,
-				Username: "testuser", OutputDir: "custom_output", CookieFile: ""},
+			name: "inbox",
+			args: []string{"--inbox", "-c", "cookies.txt", "--inbox-fallback", "48h"},
+			modify: func(c *main.Config) {
+				c.CookieFile = "cookies.txt"
+				c.Inbox, c.InboxFallback = true, 48*time.Hour
+			},
 		},
 		{
-			name: "cookie file provided",
-			args: []string{"-u", "testuser", "-c", "cookies.txt"},
-			expected: main.Config{Debug: false, ReCrawl: false, SkipScraps: false, NoThrottle: false,
-				Username: "testuser", OutputDir: "dl", CookieFile: "cookies.txt"},
+			name: "searches",
+			args: []string{"--search", "red fox, wolf", "--search", "otter", "--search-ratings", "general,mature"},
+			modify: func(c *main.Config) {
+				c.Searches = []string{"red fox, wolf", "otter"}
+				c.SearchRatings = []string{"general", "mature"}
+			},
+		},
+		{
+			name: "unwatched artists",
+			args: []string{"-u", "testuser", "--unwatched-grace", "168h", "--mark-unwatched", "--allow-mass-unwatch"},
+			modify: func(c *main.Config) {
+				c.Username = "testuser"
+				c.UnwatchedGrace, c.MarkUnwatched, c.MassUnwatch = 168*time.Hour, true, true
+			},
+		},
+		{
+			name: "login check",
+			args: []string{"-u", "testuser", "-c", "cookies.txt", "--login-match", "--login-recheck", "30m"},
+			modify: func(c *main.Config) {
+				c.Username, c.CookieFile = "testuser", "cookies.txt"
+				c.LoginMatch, c.LoginRecheck = true, 30*time.Minute
+			},
+		},
+		{
+			name: "throttle policy",
+			args: []string{"-u", "testuser", "--throttle-scale-from", "8000", "--throttle-budget", "2h"},
+			modify: func(c *main.Config) {
+				c.Username = "testuser"
+				c.Throttle.ScaleFrom, c.Throttle.Budget = 8000, 2*time.Hour
+			},
+		},
+		{
+			name:   "operating window",
+			args:   []string{"-u", "testuser", "--window", "01:00-07:00 America/Chicago"},
+			modify: func(c *main.Config) { c.Username, c.Window = "testuser", "01:00-07:00 America/Chicago" },
+		},
+		{
+			name:   "cookie file provided",
+			args:   []string{"-u", "testuser", "-c", "cookies.txt"},
+			modify: func(c *main.Config) { c.Username, c.CookieFile = "testuser", "cookies.txt" },
 		},
 	}
 
@@ -86,11 +174,44 @@ func TestParseFlags(t *testing.T) {
 
 			config := main.ParseFlags()
 
-			assert.DeepEqual(t, config, tt.expected)
+			expected := defaultConfig()
+			tt.modify(&expected)
+			assert.DeepEqual(t, config, expected)
 		})
 	}
 }
 
+func TestSubmissionIDs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "list.txt")
+	err := os.WriteFile(path, []byte("104\n"), 0600)
+	assert.NilError(t, err)
+
+	have, err := main.SubmissionIDs(main.Config{
+		Submissions:     []string{"101", "https://www.furaffinity.net/full/102/"},
+		SubmissionsFile: path,
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, have, []uint64{101, 102, 104})
+
+	_, err = main.SubmissionIDs(main.Config{Submissions: []string{"bogus"}})
+	assert.ErrorIs(t, err, main.ErrInvalidSubmissionRef)
+}
+
+func TestSearchQueries(t *testing.T) {
+	have, err := main.SearchQueries(main.Config{
+		Searches:    []string{"red fox", "otter"},
+		SearchTypes: []string{"Story", "art"},
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, have, []main.SearchQuery{
+		{Query: "red fox", Types: []string{"art", "story"}},
+		{Query: "otter", Types: []string{"art", "story"}},
+	})
+
+	_, err = main.SearchQueries(main.Config{Searches: []string{"otter"}, SearchRatings: []string{"spicy"}})
+	assert.ErrorIs(t, err, main.ErrInvalidSearch)
+}
+
 func TestSetupLogging(t *testing.T) {
 	tests := []struct {
 		name  string
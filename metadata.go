@@ -0,0 +1,309 @@
+package main
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	// Layout of the absolute dates FA shows in .popup_date elements, after
+	// ordinal suffixes have been stripped.  e.g. "Sep 4, 2023 07:41 PM".
+	faDateLayout = "Jan 2, 2006 03:04 PM"
+
+	// How many regex capture groups pageTitleRegexp should have.
+	pageTitleRegexpCaptures = 3
+
+	// Stand-in for <br> elements while extracting multi-line text.  This is
+	// the ASCII record separator, which never appears in FA's HTML.
+	lineBreakPlaceholder = "\x1e"
+)
+
+var (
+	ErrSubmissionMetadataNotFound = errors.New("failed to find submission metadata in HTML")
+
+	// Regex to strip ordinal suffixes ("3rd", "21st") from FA dates so they
+	// can be parsed with time.Parse.
+	dateOrdinalRegexp = regexp.MustCompile(`(\d+)(st|nd|rd|th),`)
+
+	// Regex to split the <title> of a /view/ page into title and artist.  This
+	// is the same in both templates, so it serves as the fallback when the
+	// template-specific markup is missing.
+	pageTitleRegexp = regexp.MustCompile(`^(.*) by (.*?) -- Fur Affinity`)
+
+	// Regex to pull the username out of a /user/<name>/ link.
+	userLinkRegexp = regexp.MustCompile(`^/user/([^/]+)/?$`)
+)
+
+// SubmissionMetadata holds the structured information extracted from a
+// submission's /view/ page.  It is written as a JSON sidecar next to the saved
+// HTML page so it can be consumed without re-parsing the HTML.
+type SubmissionMetadata struct {
+	ID          uint64    `json:"id"`
+	Title       string    `json:"title"`
+	Artist      string    `json:"artist"`
+	Description string    `json:"description"`
+	Tags        []string  `json:"tags"`
+	Category    string    `json:"category"`
+	Type        string    `json:"type"`
+	Species     string    `json:"species"`
+	Gender      string    `json:"gender"`
+	Rating      string    `json:"rating"`
+	Posted      time.Time `json:"posted,omitzero"`
+	Views       int       `json:"views"`
+	Favorites   int       `json:"favorites"`
+	Comments    int       `json:"comments"`
+}
+
+// parseSubmissionMetadata extracts structured metadata from a FurAffinity
+// submission /view/ page.  Both the modern and "classic" templates are
+// supported.  Missing optional fields are left empty; the only hard
+// requirement is that a title can be found, which distinguishes a submission
+// page from an error page or something else entirely.
+//
+// Parameters:
+//   - pageContent: Raw HTML content from the submission view page
+//   - id: The FurAffinity submission ID the page belongs to
+//
+// Returns:
+//   - *SubmissionMetadata: The extracted metadata
+//   - error: ErrSubmissionMetadataNotFound if the page has no recognizable title
+func parseSubmissionMetadata(pageContent []byte, id uint64) (*SubmissionMetadata, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(pageContent))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	meta := &SubmissionMetadata{ID: id, Tags: []string{}}
+
+	// The modern template has a .submission-id-container; anything else is
+	// treated as classic.
+	if doc.Find(".submission-id-container").Length() > 0 {
+		parseModernMetadata(doc, meta)
+	} else {
+		parseClassicMetadata(doc, meta)
+	}
+
+	// Fall back to the <title> element for anything the template-specific
+	// parsing missed.
+	matches := pageTitleRegexp.FindStringSubmatch(strings.TrimSpace(doc.Find("title").First().Text()))
+	if len(matches) == pageTitleRegexpCaptures {
+		if meta.Title == "" {
+			meta.Title = matches[1]
+		}
+		if meta.Artist == "" {
+			meta.Artist = strings.ToLower(matches[2])
+		}
+	}
+
+	if meta.Title == "" {
+		return nil, ErrSubmissionMetadataNotFound
+	}
+
+	return meta, nil
+}
+
+// parseModernMetadata fills in metadata from the modern FA template.
+//
+// Parameters:
+//   - doc: The parsed /view/ page
+//   - meta: The metadata struct to populate
+func parseModernMetadata(doc *goquery.Document, meta *SubmissionMetadata) {
+	header := doc.Find(".submission-id-sub-container").First()
+	meta.Title = cleanText(header.Find(".submission-title").First().Text())
+	meta.Artist = userFromLinks(header.Find(`a[href^="/user/"]`))
+	meta.Posted = parsePopupDate(header.Find(".popup_date").First())
+	meta.Description = multilineText(doc.Find(".submission-description").First())
+
+	stats := doc.Find(".stats-container").First()
+	meta.Views = parseCount(stats.Find(".views .font-large").First().Text())
+	meta.Comments = parseCount(stats.Find(".comments .font-large").First().Text())
+	meta.Favorites = parseCount(stats.Find(".favorites .font-large").First().Text())
+	meta.Rating = cleanText(stats.Find(".rating-box").First().Text())
+
+	info := doc.Find("section.info").First()
+	meta.Category = cleanText(info.Find(".category-name").First().Text())
+	meta.Type = cleanText(info.Find(".type-name").First().Text())
+	info.Find("strong.highlight").Each(func(_ int, s *goquery.Selection) {
+		value := cleanText(s.NextAllFiltered("span").First().Text())
+		switch cleanText(s.Text()) {
+		case "Species":
+			meta.Species = value
+		case "Gender":
+			meta.Gender = value
+		}
+	})
+
+	doc.Find(".tags-row .tags a").Each(func(_ int, s *goquery.Selection) {
+		meta.Tags = append(meta.Tags, cleanText(s.Text()))
+	})
+}
+
+// parseClassicMetadata fills in metadata from the "classic" FA template, which
+// lays the submission information out as bold labels followed by bare text.
+//
+// Parameters:
+//   - doc: The parsed /view/ page
+//   - meta: The metadata struct to populate
+func parseClassicMetadata(doc *goquery.Document, meta *SubmissionMetadata) {
+	header := doc.Find(".classic-submission-title").First()
+	meta.Title = cleanText(header.Find("h2").First().Text())
+	meta.Artist = userFromLinks(header.Find(`a[href^="/user/"]`))
+	meta.Description = multilineText(doc.Find(`td.alt1[width="70%"]`).First())
+
+	stats := doc.Find(".stats-container").First()
+	stats.Find("b").Each(func(_ int, s *goquery.Selection) {
+		label := strings.TrimSuffix(cleanText(s.Text()), ":")
+		if label == "Posted" {
+			meta.Posted = parsePopupDate(s.NextAllFiltered(".popup_date").First())
+			return
+		}
+
+		value := classicLabelValue(s)
+		switch label {
+		case "Category":
+			meta.Category = value
+		case "Theme":
+			meta.Type = value
+		case "Species":
+			meta.Species = value
+		case "Gender":
+			meta.Gender = value
+		case "Favorites":
+			meta.Favorites = parseCount(value)
+		case "Comments":
+			meta.Comments = parseCount(value)
+		case "Views":
+			meta.Views = parseCount(value)
+		}
+	})
+
+	// Classic shows the rating as an image, e.g. alt="Adult rating".
+	rating, _ := stats.Find(`img[alt$=" rating"]`).First().Attr("alt")
+	meta.Rating = strings.TrimSuffix(rating, " rating")
+
+	doc.Find("#keywords a").Each(func(_ int, s *goquery.Selection) {
+		meta.Tags = append(meta.Tags, cleanText(s.Text()))
+	})
+}
+
+// classicLabelValue returns the bare text following a classic template label,
+// up to the next <br>.
+//
+// Parameters:
+//   - label: The <b> element holding the label
+//
+// Returns:
+//   - string: The text value following the label
+func classicLabelValue(label *goquery.Selection) string {
+	var sb strings.Builder
+	for node := label.Nodes[0].NextSibling; node != nil; node = node.NextSibling {
+		sibling := goquery.NewDocumentFromNode(node).Selection
+		name := goquery.NodeName(sibling)
+		if name == "br" || name == "b" {
+			break
+		}
+		sb.WriteString(sibling.Text())
+	}
+	return cleanText(sb.String())
+}
+
+// userFromLinks returns the username from the first /user/<name>/ link in the
+// selection, or an empty string if there is none.
+//
+// Parameters:
+//   - links: A selection of <a> elements
+//
+// Returns:
+//   - string: The username
+func userFromLinks(links *goquery.Selection) string {
+	var username string
+	links.EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		href, _ := s.Attr("href")
+		matches := userLinkRegexp.FindStringSubmatch(href)
+		if matches != nil {
+			username = matches[1]
+			return false // stop iterating
+		}
+		return true // continue iterating
+	})
+	return username
+}
+
+// parsePopupDate parses an FA .popup_date element.  Depending on the user's
+// settings, the absolute date is either the element text or its title
+// attribute, with the relative date ("3 weeks ago") in the other, so both are
+// tried.
+//
+// Parameters:
+//   - sel: The .popup_date element
+//
+// Returns:
+//   - time.Time: The parsed date, or the zero time if it could not be parsed
+func parsePopupDate(sel *goquery.Selection) time.Time {
+	title, _ := sel.Attr("title")
+	for _, candidate := range []string{title, sel.Text()} {
+		candidate = dateOrdinalRegexp.ReplaceAllString(cleanText(candidate), "$1,")
+		posted, err := time.Parse(faDateLayout, candidate)
+		if err == nil {
+			return posted
+		}
+	}
+	return time.Time{}
+}
+
+// parseCount parses a count such as "1,234", returning 0 if it isn't numeric.
+//
+// Parameters:
+//   - text: The text to parse
+//
+// Returns:
+//   - int: The parsed count
+func parseCount(text string) int {
+	count, err := strconv.Atoi(strings.ReplaceAll(cleanText(text), ",", ""))
+	if err != nil {
+		return 0
+	}
+	return count
+}
+
+// multilineText returns the text of a selection with <br> elements converted
+// to newlines and surrounding whitespace trimmed from every line.
+//
+// Parameters:
+//   - sel: The selection to extract text from
+//
+// Returns:
+//   - string: The cleaned up text
+func multilineText(sel *goquery.Selection) string {
+	// Newlines in the HTML source are just whitespace, so mark the <br>s with
+	// a placeholder before collapsing whitespace.
+	sel = sel.Clone()
+	sel.Find("br").ReplaceWithHtml(lineBreakPlaceholder)
+
+	lines := strings.Split(sel.Text(), lineBreakPlaceholder)
+	for i, line := range lines {
+		lines[i] = cleanText(line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// cleanText collapses runs of whitespace into single spaces and trims the
+// result.
+//
+// Parameters:
+//   - text: The text to clean
+//
+// Returns:
+//   - string: The cleaned text
+func cleanText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
@@ -0,0 +1,105 @@
+package main_test
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	main "furtrap"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestSubmission_Metadata(t *testing.T) {
+	client := NewTestClient()
+
+	t.Run("modern template", func(t *testing.T) {
+		submissionDir := t.TempDir()
+		submission := main.NewSubmission(NewTestLogger(t), client, 102, submissionDir)
+		err := submission.Save(t.Context())
+		assert.NilError(t, err)
+
+		have := readJSON[main.SubmissionMetadata](t, filepath.Join(submissionDir,
+			"2222222222.artist-with-two-submissions_test-image-2.png.102.json"))
+		want := main.SubmissionMetadata{
+			ID:          102,
+			Title:       "Test Submission 102",
+			Artist:      "artist-with-two-submissions",
+			Description: "A test description.\nSecond line with a link.",
+			Tags:        []string{"fox", "test"},
+			Category:    "Artwork (Digital)",
+			Type:        "General Furry Art",
+			Species:     "Red Fox",
+			Gender:      "Female",
+			Rating:      "Mature",
+			Posted:      time.Date(2025, 11, 3, 19, 41, 0, 0, time.UTC),
+			Views:       1234,
+			Favorites:   67,
+			Comments:    5,
+		}
+		assert.DeepEqual(t, have, want)
+	})
+
+	t.Run("classic template", func(t *testing.T) {
+		submissionDir := t.TempDir()
+		submission := main.NewSubmission(NewTestLogger(t), client, 104, submissionDir)
+		err := submission.Save(t.Context())
+		assert.NilError(t, err)
+
+		have := readJSON[main.SubmissionMetadata](t, filepath.Join(submissionDir,
+			"4444444444.artist-with-two-submissions_scrap-image-2.png.104.json"))
+		want := main.SubmissionMetadata{
+			ID:          104,
+			Title:       "Scrap Submission 104",
+			Artist:      "artist-with-two-submissions",
+			Description: "Classic description.\nAnother line.",
+			Tags:        []string{"scrap", "doodle"},
+			Category:    "Artwork (Traditional)",
+			Type:        "Doodle",
+			Species:     "Unspecified / Any",
+			Gender:      "Any",
+			Rating:      "Adult",
+			Posted:      time.Date(2025, 11, 4, 8, 15, 0, 0, time.UTC),
+			Views:       42,
+			Favorites:   3,
+			Comments:    0,
+		}
+		assert.DeepEqual(t, have, want)
+	})
+
+	t.Run("falls back to the page title", func(t *testing.T) {
+		submissionDir := t.TempDir()
+		submission := main.NewSubmission(NewTestLogger(t), client, 101, submissionDir)
+		err := submission.Save(t.Context())
+		assert.NilError(t, err)
+
+		have := readJSON[main.SubmissionMetadata](t, filepath.Join(submissionDir,
+			"1111111111.artist-with-two-submissions_test-image-1.jpg.101.json"))
+		assert.Equal(t, have.Title, "Test Submission 101")
+		assert.Equal(t, have.Artist, "artist-with-two-submissions")
+		assert.DeepEqual(t, have.Tags, []string{})
+		assert.Assert(t, have.Posted.IsZero())
+	})
+
+	t.Run("no sidecar when metadata can't be found", func(t *testing.T) {
+		client.SetResponse(
+			"https://www.furaffinity.net/view/12345",
+			[]byte(`<html><body><a href="//d.furaffinity.net/art/artist/file.jpg">Download</a></body></html>`),
+			nil,
+		)
+		client.SetResponse("https://d.furaffinity.net/art/artist/file.jpg", []byte("data"), nil)
+
+		submissionDir := t.TempDir()
+		submission := main.NewSubmission(NewTestLogger(t), client, 12345, submissionDir)
+		err := submission.Save(t.Context())
+		assert.NilError(t, err)
+
+		// The submission itself is still saved
+		_, err = os.Stat(filepath.Join(submissionDir, "file.jpg.12345.html"))
+		assert.NilError(t, err)
+		_, err = os.Stat(filepath.Join(submissionDir, "file.jpg.12345.json"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
@@ -0,0 +1,342 @@
+package main
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	// Subdirectory of the artist directory where profile snapshots are saved.
+	profileDirname = "profile"
+
+	// Layout of profile snapshot directory names.  These sort by time.
+	profileSnapshotLayout = "20060102T150405.000Z"
+
+	// Files in each profile snapshot directory.  The avatar and banner keep
+	// the extension from their URL.
+	profileHTMLFilename   = "profile.html"
+	profileJSONFilename   = "profile.json"
+	profileAvatarBasename = "avatar"
+	profileBannerBasename = "banner"
+
+	// How many regex capture groups profileTitleRegexp should have.
+	profileTitleRegexpCaptures = 2
+)
+
+var (
+	ErrProfileNotFound = errors.New("failed to find profile in HTML")
+
+	// Regex to pull the display name out of the <title> of a /user/ page.
+	profileTitleRegexp = regexp.MustCompile(`^Userpage of (.*?) -- Fur Affinity`)
+
+	// Regex matching profile snapshot directory names.
+	profileSnapshotRegexp = regexp.MustCompile(`^\d{8}T\d{6}\.\d{3}Z$`)
+
+	// Regex matching image extensions we're willing to use in a filename.
+	profileImageExtRegexp = regexp.MustCompile(`^\.[A-Za-z0-9]{1,5}$`)
+)
+
+// ArtistProfile holds the structured information extracted from an artist's
+// /user/ page.  A new snapshot is only saved when this changes.
+type ArtistProfile struct {
+	Username    string            `json:"username"`
+	DisplayName string            `json:"display_name"`
+	UserTitle   string            `json:"user_title"`
+	MemberSince time.Time         `json:"member_since,omitzero"`
+	Description string            `json:"description"`
+	Commissions string            `json:"commissions"` // e.g. "Yes", from "Accepting Commissions"
+	Fields      map[string]string `json:"fields"`      // Other profile info, by label
+	AvatarURL   string            `json:"avatar_url"`
+	BannerURL   string            `json:"banner_url"`
+}
+
+// ProfileSnapshot is the profile.json saved in each snapshot directory.
+type ProfileSnapshot struct {
+	ArtistProfile
+
+	SnapshotAt time.Time `json:"snapshot_at"`
+	AvatarFile string    `json:"avatar_file,omitempty"` // Empty if there was no avatar, or it 404ed
+	BannerFile string    `json:"banner_file,omitempty"`
+}
+
+// ProfileURL returns the address of this artist's /user/ page.
+//
+// Returns:
+//   - string: The profile URL
+func (a *Artist) ProfileURL() string {
+	return fmt.Sprintf("https://www.furaffinity.net/user/%s/", a.username)
+}
+
+// ProfileDir returns the directory this artist's profile snapshots are saved
+// in.
+//
+// Returns:
+//   - string: The profile directory
+func (a *Artist) ProfileDir() string {
+	return filepath.Join(a.artistDir, profileDirname)
+}
+
+// SnapshotProfile fetches the artist's profile and saves a dated snapshot of
+// it, with the avatar and banner images, if anything has changed since the
+// last snapshot.  The images are only downloaded for a new snapshot, and
+// their URLs change when they're replaced, so an unchanged profile costs a
+// single request.
+//
+// Each snapshot is written to a temporary directory and renamed into place,
+// so an interrupted snapshot never looks like a complete one.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//
+// Returns:
+//   - bool: true if a new snapshot was saved
+//   - error: Any error fetching or saving the profile, an
+//     *AccountUnavailableError if FA shows a system message instead, or
+//     ErrProfileNotFound if the page isn't a profile for some other reason
+func (a *Artist) SnapshotProfile(ctx context.Context) (bool, error) {
+	pageContent, err := a.client.GetWithDelay(ctx, a.ProfileURL())
+	if err != nil {
+		return false, fmt.Errorf("failed to get profile page: %w", err)
+	}
+	err = checkAccountStatus(a.username, a.ProfileURL(), pageContent)
+	if err != nil {
+		return false, err
+	}
+
+	profile, err := parseArtistProfile(pageContent, a.username)
+	if err != nil {
+		return false, err
+	}
+
+	latest, err := a.LatestProfile()
+	if err != nil {
+		return false, err
+	}
+	if latest != nil && sameProfile(&latest.ArtistProfile, profile) {
+		a.logger.Debug("Profile unchanged", "user", a.username, "snapshot", latest.SnapshotAt)
+		return false, nil
+	}
+
+	snapshot := &ProfileSnapshot{
+		ArtistProfile: *profile,
+		SnapshotAt:    time.Now().UTC().Truncate(time.Millisecond),
+	}
+	name := snapshot.SnapshotAt.Format(profileSnapshotLayout)
+	tempDir := filepath.Join(a.ProfileDir(), "."+name+".partial")
+	err = os.MkdirAll(tempDir, submissionDirPermissions)
+	if err != nil {
+		return false, fmt.Errorf("failed to create profile directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	snapshot.AvatarFile, err = a.downloadProfileImage(ctx, profile.AvatarURL, tempDir, profileAvatarBasename)
+	if err != nil {
+		return false, err
+	}
+	snapshot.BannerFile, err = a.downloadProfileImage(ctx, profile.BannerURL, tempDir, profileBannerBasename)
+	if err != nil {
+		return false, err
+	}
+
+	err = writeFileAtomic(filepath.Join(tempDir, profileHTMLFilename), pageContent)
+	if err != nil {
+		return false, fmt.Errorf("failed to save profile page: %w", err)
+	}
+	err = writeJSONFileAtomic(filepath.Join(tempDir, profileJSONFilename), snapshot)
+	if err != nil {
+		return false, fmt.Errorf("failed to save profile metadata: %w", err)
+	}
+
+	snapshotDir := filepath.Join(a.ProfileDir(), name)
+	err = os.Rename(tempDir, snapshotDir)
+	if err != nil {
+		return false, fmt.Errorf("failed to save profile snapshot: %w", err)
+	}
+
+	a.logger.Info("Saved profile snapshot", "user", a.username, "dir", snapshotDir)
+	return true, nil
+}
+
+// LatestProfile loads the most recent profile snapshot.
+//
+// Returns:
+//   - *ProfileSnapshot: The latest snapshot, or nil if there are none
+//   - error: Any error reading the snapshots
+func (a *Artist) LatestProfile() (*ProfileSnapshot, error) {
+	entries, err := os.ReadDir(a.ProfileDir())
+	switch {
+	case err == nil:
+		// continue
+	case errors.Is(err, fs.ErrNotExist):
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("failed to read profile directory: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() && profileSnapshotRegexp.MatchString(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	slices.Sort(names)
+
+	snapshot := &ProfileSnapshot{}
+	found, err := readJSONFile(filepath.Join(a.ProfileDir(), names[len(names)-1], profileJSONFilename), snapshot)
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("failed to load profile snapshot: %w", err)
+	case !found:
+		return nil, fmt.Errorf("failed to load profile snapshot: %w", fs.ErrNotExist)
+	}
+	return snapshot, nil
+}
+
+// downloadProfileImage downloads an avatar or banner into a snapshot
+// directory.  Like submission files, an image which 404s is skipped.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - imageURL: The image URL, or empty if there isn't one
+//   - dir: The snapshot directory
+//   - basename: The filename to save as, without extension
+//
+// Returns:
+//   - string: The filename saved, or empty if there was nothing to save
+//   - error: Any error downloading the image
+func (a *Artist) downloadProfileImage(ctx context.Context, imageURL string, dir string, basename string) (string, error) {
+	if imageURL == "" {
+		return "", nil
+	}
+
+	// Security: Only the extension comes from the URL, and only if it looks
+	// like one.
+	filename := basename
+	urlPath, _, _ := strings.Cut(imageURL, "?")
+	ext := path.Ext(urlPath)
+	if profileImageExtRegexp.MatchString(ext) {
+		filename += ext
+	}
+
+	err := a.client.Download(ctx, imageURL, filepath.Join(dir, filename))
+	switch {
+	case err == nil:
+		return filename, nil
+	case errors.Is(err, ErrHTTPNotFound):
+		a.logger.Warn("Profile image 404s, skipping", "user", a.username, "url", imageURL)
+		return "", nil
+	default:
+		return "", fmt.Errorf("failed to download %s: %w", basename, err)
+	}
+}
+
+// sameProfile reports whether two profiles have the same content.
+//
+// Parameters:
+//   - a, b: The profiles to compare
+//
+// Returns:
+//   - bool: true if they're the same
+func sameProfile(a *ArtistProfile, b *ArtistProfile) bool {
+	// Comparing the JSON sidesteps differences that don't survive a round
+	// trip through profile.json, like nil vs empty maps and time zones.
+	aJSON, aErr := json.Marshal(a)
+	bJSON, bErr := json.Marshal(b)
+	return aErr == nil && bErr == nil && bytes.Equal(aJSON, bJSON)
+}
+
+// parseArtistProfile extracts structured information from an artist's /user/
+// page.
+//
+// Parameters:
+//   - pageContent: Raw HTML content from the /user/ page
+//   - username: The artist's username
+//
+// Returns:
+//   - *ArtistProfile: The extracted profile
+//   - error: ErrProfileNotFound if the page isn't a profile
+func parseArtistProfile(pageContent []byte, username string) (*ArtistProfile, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(pageContent))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	matches := profileTitleRegexp.FindStringSubmatch(strings.TrimSpace(doc.Find("title").First().Text()))
+	if len(matches) != profileTitleRegexpCaptures {
+		return nil, fmt.Errorf("%w: %s", ErrProfileNotFound, username)
+	}
+
+	profile := &ArtistProfile{
+		Username:    username,
+		DisplayName: matches[1],
+		Fields:      map[string]string{},
+	}
+
+	header := doc.Find(".userpage-nav-user-details").First()
+	profile.UserTitle = cleanText(header.Find(".user-title").First().Text())
+	profile.MemberSince = parsePopupDate(header.Find(".popup_date").First())
+	profile.Description = multilineText(doc.Find(".userpage-profile").First())
+
+	doc.Find(".userpage-profile-info .highlight").Each(func(_ int, s *goquery.Selection) {
+		label := strings.TrimSuffix(cleanText(s.Text()), ":")
+		value := cleanText(s.Next().Text())
+		if label == "" {
+			return
+		}
+		if label == "Accepting Commissions" {
+			profile.Commissions = value
+			return
+		}
+		profile.Fields[label] = value
+	})
+
+	// Other avatars are on the page too: the logged-in user's in the site
+	// header, and those of watchers and shouts.  Only the one in the artist's
+	// own header is theirs.
+	avatar := doc.Find(".userpage-nav-avatar img[src]").Not(".loggedin_user_avatar").First()
+	if src, ok := avatar.Attr("src"); ok {
+		profile.AvatarURL = absoluteImageURL(src)
+	}
+
+	if src, ok := doc.Find(".userpage-banner img[src]").First().Attr("src"); ok {
+		profile.BannerURL = absoluteImageURL(src)
+	}
+
+	return profile, nil
+}
+
+// absoluteImageURL resolves an image's src attribute on an FA page, which is
+// usually protocol-relative, to an absolute URL.
+//
+// Parameters:
+//   - src: The src attribute
+//
+// Returns:
+//   - string: The absolute URL
+func absoluteImageURL(src string) string {
+	switch {
+	case strings.HasPrefix(src, "//"):
+		return "https:" + src
+	case strings.HasPrefix(src, "/"):
+		return "https://www.furaffinity.net" + src
+	}
+	return src
+}
@@ -0,0 +1,195 @@
+package main_test
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"errors"
+	main "furtrap"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+const (
+	profileArtist = "artist-with-two-submissions"
+	profileURL    = "https://www.furaffinity.net/user/artist-with-two-submissions/"
+)
+
+// profileSnapshotDirs lists the snapshot directories for an artist.
+func profileSnapshotDirs(t *testing.T, artist *main.Artist) []string {
+	t.Helper()
+	entries, err := os.ReadDir(artist.ProfileDir())
+	assert.NilError(t, err)
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestArtist_SnapshotProfile(t *testing.T) {
+	t.Run("saves the profile, avatar and banner", func(t *testing.T) {
+		client := NewTestClient()
+		artist := main.NewArtist(NewTestLogger(t), client, profileArtist, t.TempDir())
+		assert.Equal(t, artist.ProfileURL(), profileURL)
+
+		changed, err := artist.SnapshotProfile(t.Context())
+		assert.NilError(t, err)
+		assert.Assert(t, changed)
+
+		snapshot, err := artist.LatestProfile()
+		assert.NilError(t, err)
+		assert.Assert(t, !snapshot.SnapshotAt.IsZero())
+		assert.DeepEqual(t, snapshot.ArtistProfile, main.ArtistProfile{
+			Username:    profileArtist,
+			DisplayName: "Artist-With-Two-Submissions",
+			UserTitle:   "Test Artist | Member Since: 2 years ago",
+			MemberSince: time.Date(2023, time.September, 4, 19, 41, 0, 0, time.UTC),
+			Description: "Hi, I draw things.\nCommissions info below.",
+			Commissions: "Yes",
+			Fields:      map[string]string{"Accepting Trades": "No", "Favorite Animal": "Otter"},
+			AvatarURL:   "https://a.furaffinity.net/1700000000/artist-with-two-submissions.gif",
+			BannerURL:   "https://d.furaffinity.net/art/artist-with-two-submissions/profilebanner/1700000000.jpg",
+		})
+		assert.Equal(t, snapshot.AvatarFile, "avatar.gif")
+		assert.Equal(t, snapshot.BannerFile, "banner.jpg")
+
+		dirs := profileSnapshotDirs(t, artist)
+		assert.Equal(t, len(dirs), 1)
+		for filename, uri := range map[string]string{
+			"profile.html": profileURL,
+			"avatar.gif":   snapshot.AvatarURL,
+			"banner.jpg":   snapshot.BannerURL,
+		} {
+			want, err := client.Get(t.Context(), uri)
+			assert.NilError(t, err)
+			//#nosec G304: path is from test data
+			have, err := os.ReadFile(filepath.Join(artist.ProfileDir(), dirs[0], filename))
+			assert.NilError(t, err)
+			assert.DeepEqual(t, have, want)
+		}
+	})
+
+	t.Run("only changes are snapshotted", func(t *testing.T) {
+		client := NewTestClient()
+		artist := main.NewArtist(NewTestLogger(t), client, profileArtist, t.TempDir())
+		_, err := artist.SnapshotProfile(t.Context())
+		assert.NilError(t, err)
+
+		// The same profile again
+		changed, err := artist.SnapshotProfile(t.Context())
+		assert.NilError(t, err)
+		assert.Assert(t, !changed)
+		assert.Equal(t, len(profileSnapshotDirs(t, artist)), 1)
+
+		// A new description
+		page, err := client.Get(t.Context(), profileURL)
+		assert.NilError(t, err)
+		client.SetResponse(profileURL,
+			[]byte(strings.ReplaceAll(string(page), "Hi, I draw things.", "Closed for now.")), nil)
+		changed, err = artist.SnapshotProfile(t.Context())
+		assert.NilError(t, err)
+		assert.Assert(t, changed)
+		assert.Equal(t, len(profileSnapshotDirs(t, artist)), 2)
+
+		snapshot, err := artist.LatestProfile()
+		assert.NilError(t, err)
+		assert.Equal(t, snapshot.Description, "Closed for now.\nCommissions info below.")
+	})
+
+	t.Run("missing images are skipped", func(t *testing.T) {
+		client := NewTestClient()
+		client.SetResponse("https://www.furaffinity.net/user/someone/",
+			[]byte(`<title>Userpage of Someone -- Fur Affinity [dot] net</title>`+
+				`<div class="userpage-nav-avatar"><img src="//a.furaffinity.net/1/someone.png"></div>`), nil)
+		artist := main.NewArtist(NewTestLogger(t), client, "someone", t.TempDir())
+
+		changed, err := artist.SnapshotProfile(t.Context())
+		assert.NilError(t, err)
+		assert.Assert(t, changed)
+		snapshot, err := artist.LatestProfile()
+		assert.NilError(t, err)
+		assert.Equal(t, snapshot.AvatarFile, "")
+		assert.Equal(t, snapshot.BannerFile, "")
+	})
+
+	t.Run("only the artist's own avatar is taken", func(t *testing.T) {
+		// The page has the logged-in user's avatar in the site header, and a
+		// watcher's and a shouter's further down.
+		artist := main.NewArtist(NewTestLogger(t), NewTestClient(), "artist-seen-logged-in", t.TempDir())
+
+		_, err := artist.SnapshotProfile(t.Context())
+		assert.NilError(t, err)
+		snapshot, err := artist.LatestProfile()
+		assert.NilError(t, err)
+		assert.Equal(t, snapshot.AvatarURL, "https://a.furaffinity.net/1700000000/artist-seen-logged-in.gif")
+	})
+
+	t.Run("a page which isn't a profile is an error", func(t *testing.T) {
+		client := NewTestClient()
+		client.SetResponse(profileURL, []byte(`<title>System Error</title>`), nil)
+		artist := main.NewArtist(NewTestLogger(t), client, profileArtist, t.TempDir())
+
+		_, err := artist.SnapshotProfile(t.Context())
+		assert.ErrorIs(t, err, main.ErrProfileNotFound)
+		_, err = os.Stat(artist.ProfileDir())
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("failed downloads leave no snapshot", func(t *testing.T) {
+		client := NewTestClient()
+		client.SetResponse("https://a.furaffinity.net/1700000000/artist-with-two-submissions.gif", nil,
+			errors.New("network error")) //nolint:err113 // dynamic test error
+		artist := main.NewArtist(NewTestLogger(t), client, profileArtist, t.TempDir())
+
+		_, err := artist.SnapshotProfile(t.Context())
+		assert.ErrorContains(t, err, "network error")
+		assert.Equal(t, len(profileSnapshotDirs(t, artist)), 0)
+		snapshot, err := artist.LatestProfile()
+		assert.NilError(t, err)
+		assert.Assert(t, snapshot == nil)
+	})
+}
+
+func TestScraper_Profiles(t *testing.T) {
+	t.Run("profiles are off by default", func(t *testing.T) {
+		tempdir := t.TempDir()
+		scraper := main.NewScraper(NewTestLogger(t), NewTestClient(), "", []string{profileArtist}, false, false, tempdir)
+		err := scraper.Run(t.Context())
+		assert.NilError(t, err)
+		assert.Equal(t, scraper.Summary().Profiles, 0)
+		_, err = os.Stat(filepath.Join(tempdir, profileArtist, "profile"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("failed profile is recorded and retried", func(t *testing.T) {
+		tempdir := t.TempDir()
+		client := NewTestClient()
+		client.SetResponse(profileURL, nil, errors.New("network error")) //nolint:err113 // dynamic test error
+
+		scraper := main.NewScraper(NewTestLogger(t), client, "", []string{profileArtist}, false, false, tempdir)
+		scraper.SetProfiles(true)
+		scraper.SetContinueOnError(true)
+		err := scraper.Run(t.Context())
+		assert.NilError(t, err)
+		assert.Equal(t, scraper.Summary().Failures, 1)
+
+		entries := readJSON[[]main.FailureEntry](t, filepath.Join(tempdir, "failures.json"))
+		assert.Equal(t, len(entries), 1)
+		assert.Equal(t, entries[0].Kind, "profile")
+		assert.Equal(t, entries[0].Artist, profileArtist)
+		assert.Equal(t, entries[0].URL, profileURL)
+
+		scraper = main.NewScraper(NewTestLogger(t), NewTestClient(), "", nil, false, false, tempdir)
+		err = scraper.RetryFailed(t.Context())
+		assert.NilError(t, err)
+		assert.DeepEqual(t, scraper.Summary(), main.RunSummary{Profiles: 1})
+		_, err = os.Stat(filepath.Join(tempdir, "failures.json"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
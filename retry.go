@@ -0,0 +1,208 @@
+package main
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Default retry policy.  Five attempts with a 5 second base delay waits
+	// 5+10+20+40 seconds in total, which rides out most of FA's hiccups.
+	defaultRetryAttempts  = 5
+	defaultRetryBaseDelay = 5 * time.Second
+	defaultRetryMaxDelay  = 5 * time.Minute
+	defaultRetryJitter    = 0.2
+)
+
+// RetryPolicy controls how HTTPClient retries failed requests.  Only failures
+// which might succeed on a later attempt are retried: server errors, rate
+// limiting, timeouts and network errors.  Permanent failures such as 404 and
+// 403 fail immediately.
+type RetryPolicy struct {
+	// Total number of attempts, including the first.
+	MaxAttempts int
+	// Delay before the first retry.  It doubles with each further retry.
+	BaseDelay time.Duration
+	// Cap on the backoff delay, and on any Retry-After the server sends.
+	MaxDelay time.Duration
+	// Fraction of each delay to randomize, from 0 to 1.  This keeps retries
+	// from lining up with whatever caused the failure.
+	Jitter float64
+}
+
+// DefaultRetryPolicy returns the retry policy used in prod.
+//
+// Returns:
+//   - RetryPolicy: The default policy
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: defaultRetryAttempts,
+		BaseDelay:   defaultRetryBaseDelay,
+		MaxDelay:    defaultRetryMaxDelay,
+		Jitter:      defaultRetryJitter,
+	}
+}
+
+// Backoff returns how long to wait before the given retry, without jitter.
+//
+// Parameters:
+//   - retry: Zero for the first retry, one for the second, and so on
+//
+// Returns:
+//   - time.Duration: BaseDelay doubled once per previous retry, capped at MaxDelay
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	delay := p.BaseDelay
+	for range retry {
+		if delay >= p.MaxDelay/2 {
+			return p.MaxDelay
+		}
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// delay returns how long to wait before the given retry after err, honoring
+// any Retry-After the server sent and applying jitter to the backoff.
+//
+// Parameters:
+//   - retry: Zero for the first retry, one for the second, and so on
+//   - err: The error from the failed attempt
+//
+// Returns:
+//   - time.Duration: How long to wait
+func (p RetryPolicy) delay(retry int, err error) time.Duration {
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) && statusErr.HasRetryAfter {
+		return min(statusErr.RetryAfter, p.MaxDelay)
+	}
+
+	delay := p.Backoff(retry)
+	if p.Jitter > 0 {
+		// Jitter doesn't need a cryptographic random source.
+		//#nosec G404
+		delay += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(delay))
+	}
+	return delay
+}
+
+// HTTPStatusError is returned when a server responds with an unexpected
+// status.  It wraps ErrHTTPNotFound for 404s and ErrHTTPStatusNotOK for
+// everything else, so callers can use errors.Is for the common cases.
+type HTTPStatusError struct {
+	StatusCode int
+	Status     string
+	// How long the server asked us to wait, from a Retry-After header on a
+	// 429 or 503.  Only meaningful if HasRetryAfter is set, since zero is a
+	// valid request to retry immediately.
+	RetryAfter    time.Duration
+	HasRetryAfter bool
+}
+
+// newHTTPStatusError builds an HTTPStatusError from a response.
+//
+// Parameters:
+//   - response: The response with the unexpected status
+//
+// Returns:
+//   - *HTTPStatusError: The error
+func newHTTPStatusError(response *http.Response) *HTTPStatusError {
+	err := &HTTPStatusError{
+		StatusCode: response.StatusCode,
+		Status:     response.Status,
+	}
+	if response.StatusCode == http.StatusTooManyRequests || response.StatusCode == http.StatusServiceUnavailable {
+		err.RetryAfter, err.HasRetryAfter = parseRetryAfter(response.Header.Get("Retry-After"), time.Now())
+	}
+	return err
+}
+
+// Error implements the error interface.
+//
+// Returns:
+//   - string: The error message
+func (e *HTTPStatusError) Error() string {
+	if e.StatusCode == http.StatusNotFound {
+		return "resource not found: " + ErrHTTPNotFound.Error()
+	}
+	return fmt.Sprintf("%s: %s", ErrHTTPStatusNotOK, e.Status)
+}
+
+// Unwrap returns the sentinel error for this status.
+//
+// Returns:
+//   - error: ErrHTTPNotFound for 404, ErrHTTPStatusNotOK otherwise
+func (e *HTTPStatusError) Unwrap() error {
+	if e.StatusCode == http.StatusNotFound {
+		return ErrHTTPNotFound
+	}
+	return ErrHTTPStatusNotOK
+}
+
+// isRetryable decides whether a failed request is worth trying again.
+//
+// Parameters:
+//   - err: The error from the failed attempt
+//
+// Returns:
+//   - bool: false for permanent failures
+func isRetryable(err error) bool {
+	// Local disk errors won't fix themselves, and neither will a redirect.
+	if errors.Is(err, ErrDownloadWrite) || errors.Is(err, ErrArtistRenamed) || errors.Is(err, ErrTooManyRedirects) {
+		return false
+	}
+
+	var statusErr *HTTPStatusError
+	if !errors.As(err, &statusErr) {
+		// Timeouts, network errors, truncated bodies, etc.
+		return true
+	}
+
+	switch {
+	case statusErr.StatusCode == http.StatusTooManyRequests,
+		statusErr.StatusCode == http.StatusRequestTimeout,
+		statusErr.StatusCode >= http.StatusInternalServerError:
+		return true
+	case statusErr.StatusCode >= http.StatusBadRequest:
+		// 404, 403, 401, 410 and friends.  Asking again won't help.
+		return false
+	default:
+		// Some other unexpected status.  Give it another chance.
+		return true
+	}
+}
+
+// parseRetryAfter parses a Retry-After header, which may be either a number
+// of seconds or an HTTP date.
+//
+// Parameters:
+//   - header: The header value
+//   - now: The current time, for converting dates to durations
+//
+// Returns:
+//   - time.Duration: How long to wait, never negative
+//   - bool: false if the header is missing or invalid
+func parseRetryAfter(header string, now time.Time) (time.Duration, bool) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0, false
+	}
+
+	seconds, err := strconv.Atoi(header)
+	if err == nil {
+		return max(time.Duration(seconds)*time.Second, 0), true
+	}
+
+	date, err := http.ParseTime(header)
+	if err == nil {
+		return max(date.Sub(now), 0), true
+	}
+
+	return 0, false
+}
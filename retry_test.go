@@ -0,0 +1,120 @@
+package main_test
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"errors"
+	main "furtrap"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+// StatusHandler responds with a fixed status a number of times, then serves
+// sample data.  It counts the requests it receives.
+type StatusHandler struct {
+	status            int
+	retryAfter        string
+	failuresRemaining int
+	requests          int
+}
+
+func (h *StatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.requests++
+	if h.failuresRemaining > 0 {
+		h.failuresRemaining--
+		if h.retryAfter != "" {
+			w.Header().Set("Retry-After", h.retryAfter)
+		}
+		http.Error(w, http.StatusText(h.status), h.status)
+		return
+	}
+	SampleDataHandler(w, r)
+}
+
+func TestHTTPClient_RetryPolicy(t *testing.T) {
+	// Any test which actually waits for the backoff will time out.
+	slowPolicy := main.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour}
+
+	t.Run("permanent errors are not retried", func(t *testing.T) {
+		for _, status := range []int{http.StatusNotFound, http.StatusForbidden, http.StatusUnauthorized} {
+			handler := &StatusHandler{status: status, failuresRemaining: 3}
+			server := httptest.NewServer(handler)
+			defer server.Close()
+
+			client := main.NewHTTPClient(NewTestLogger(t))
+			client.SetRetryPolicy(slowPolicy)
+			_, err := client.Get(t.Context(), server.URL+"/view/101")
+			var statusErr *main.HTTPStatusError
+			assert.Assert(t, errors.As(err, &statusErr), "status %d", status)
+			assert.Equal(t, statusErr.StatusCode, status)
+			assert.Equal(t, handler.requests, 1, "status %d", status)
+		}
+	})
+
+	t.Run("404 still reports ErrHTTPNotFound", func(t *testing.T) {
+		handler := &StatusHandler{status: http.StatusNotFound, failuresRemaining: 1}
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		client := main.NewHTTPClient(NewTestLogger(t))
+		client.SetRetryPolicy(slowPolicy)
+		_, err := client.Get(t.Context(), server.URL+"/view/101")
+		assert.ErrorIs(t, err, main.ErrHTTPNotFound)
+
+		var statusErr *main.HTTPStatusError
+		assert.Assert(t, errors.As(err, &statusErr))
+		assert.Equal(t, statusErr.StatusCode, http.StatusNotFound)
+	})
+
+	t.Run("Retry-After overrides the backoff", func(t *testing.T) {
+		for _, status := range []int{http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+			handler := &StatusHandler{status: status, retryAfter: "0", failuresRemaining: 2}
+			server := httptest.NewServer(handler)
+			defer server.Close()
+
+			client := main.NewHTTPClient(NewTestLogger(t))
+			client.SetRetryPolicy(slowPolicy)
+			_, err := client.Get(t.Context(), server.URL+"/view/101")
+			assert.NilError(t, err, "status %d", status)
+			assert.Equal(t, handler.requests, 3, "status %d", status)
+		}
+	})
+
+	t.Run("server errors are retried", func(t *testing.T) {
+		handler := &StatusHandler{status: http.StatusInternalServerError, failuresRemaining: 4}
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		client := main.NewHTTPClient(NewTestLogger(t))
+		client.SetRetryPolicy(main.RetryPolicy{MaxAttempts: 5})
+		_, err := client.Get(t.Context(), server.URL+"/view/101")
+		assert.NilError(t, err)
+		assert.Equal(t, handler.requests, 5)
+	})
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := main.RetryPolicy{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	tests := []struct {
+		retry int
+		want  time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{3, 8 * time.Second},
+		{4, 10 * time.Second},
+		{100, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, policy.Backoff(tt.retry), tt.want, "retry %d", tt.retry)
+	}
+
+	def := main.DefaultRetryPolicy()
+	assert.Equal(t, def.Backoff(0), def.BaseDelay)
+	assert.Equal(t, def.Backoff(1000), def.MaxDelay)
+}
@@ -3,21 +3,66 @@ package main
 // SPDX-License-Identifier: GPL-3.0-only
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"path/filepath"
+	"time"
+)
+
+const (
+	// How many artists in a row may have unrecognized pages before the run
+	// stops.  One is probably a quirk of that artist's page, but several in a
+	// row means FA has changed something site wide.
+	maxConsecutiveLayoutErrors = 3
 )
 
 // Scraper manages the overall scraping process, coordinating the retrieval of
 // watchlist data and downloading of submissions from multiple artists.
 type Scraper struct {
-	logger     *slog.Logger
-	client     Client
-	watcher    string
-	artists    []string
-	reCrawl    bool
-	skipScraps bool
-	outputDir  string
+	logger          *slog.Logger
+	client          Client
+	watcher         string
+	artists         []string
+	submissionIDs   []uint64
+	favorites       []string
+	searches        []SearchQuery
+	reCrawl         bool
+	skipScraps      bool
+	journals        bool
+	profiles        bool
+	recordFolders   bool
+	inbox           bool
+	inboxFallback   time.Duration
+	inboxState      *InboxState // Loaded when the inbox is crawled
+	unwatchedGrace  time.Duration
+	markUnwatched   bool
+	massUnwatch     bool
+	loginCheck      bool          // Whether to verify the cookies are logged in
+	loginUser       string        // Who they must be logged in as, empty for anyone
+	loginRecheck    time.Duration // How often to verify again during the run
+	loginCheckedAt  time.Time     // When the login was last verified
+	outputDir       string
+	continueOnError bool
+	index           *ArchiveIndex
+	ledger          *FailureLedger
+	aliases         *ArtistAliases
+	layoutErrors    int // Consecutive artists with unrecognized pages
+	summary         RunSummary
+}
+
+// RunSummary records how far a Scraper.Run got.  It is reported at exit
+// whether the run finished, failed, or was interrupted.
+type RunSummary struct {
+	ArtistsTotal       int // Artists queued for this run
+	ArtistsCompleted   int // Artists whose submissions were all processed
+	Submissions        int // Submissions successfully processed
+	Journals           int // Journals successfully saved
+	Profiles           int // Profile snapshots saved because something changed
+	ArtistsSkipped     int // Artists skipped because their pages weren't recognized
+	ArtistsUnavailable int // Artists whose accounts are disabled, deleted or otherwise unavailable
+	Failures           int // Artists and submissions recorded in the failure ledger
 }
 
 // NewScraper creates a new Scraper instance with the specified logger,
@@ -55,33 +100,213 @@ func NewScraper(
 	}
 }
 
+// SetContinueOnError controls what happens when an artist or submission
+// fails.  By default the run stops at the first error.  With continueOnError
+// set, the failure is recorded in the failure ledger and the run moves on to
+// the next one.  Canceling the run always stops it.
+//
+// Parameters:
+//   - continueOnError: Whether to record failures and keep going
+func (s *Scraper) SetContinueOnError(continueOnError bool) {
+	s.continueOnError = continueOnError
+}
+
+// SetJournals controls whether artists' journals are downloaded along with
+// their submissions.  This crawls the journal listing of every artist, so
+// it's off by default.
+//
+// Parameters:
+//   - journals: Whether to download journals
+func (s *Scraper) SetJournals(journals bool) {
+	s.journals = journals
+}
+
+// SetProfiles controls whether artists' profiles are snapshotted along with
+// their submissions.  This fetches every artist's user page, so it's off by
+// default.
+//
+// Parameters:
+//   - profiles: Whether to save profile snapshots
+func (s *Scraper) SetProfiles(profiles bool) {
+	s.profiles = profiles
+}
+
+// SetRecordFolders controls whether artists' gallery folder membership is
+// recorded along with their submissions.  This crawls every folder, so it's
+// off by default.  Artists limited to particular folders always have those
+// folders recorded.
+//
+// Parameters:
+//   - recordFolders: Whether to record folder membership
+func (s *Scraper) SetRecordFolders(recordFolders bool) {
+	s.recordFolders = recordFolders
+}
+
+// SetSearches adds searches whose results should be downloaded, after any
+// artists, submissions and favorites.
+//
+// Parameters:
+//   - searches: The searches, as returned by NewSearchQuery
+func (s *Scraper) SetSearches(searches []SearchQuery) {
+	s.searches = searches
+}
+
+// SetInbox switches to inbox mode.  New submissions are found in the
+// logged-in user's submission inbox instead of by crawling each artist's
+// gallery.  Artists who haven't been seen in the inbox for the fallback
+// period are still crawled, in case the inbox is missing them.
+//
+// Parameters:
+//   - inbox: Whether to use the inbox
+//   - fallback: How long an artist can go unseen before being crawled
+func (s *Scraper) SetInbox(inbox bool, fallback time.Duration) {
+	s.inbox = inbox
+	s.inboxFallback = fallback
+}
+
+// SetUnwatched controls what happens to artists who have been removed from
+// the watchlist.  By default they're no longer crawled.  They can be crawled
+// for a grace period after they're removed, e.g. to catch the last of an
+// artist who is leaving, and their directories can be marked with
+// unwatched.json so it's clear why they're no longer updated.
+//
+// Parameters:
+//   - grace: How long removed artists are still crawled, 0 for not at all
+//   - mark: Whether to mark removed artists' directories
+func (s *Scraper) SetUnwatched(grace time.Duration, mark bool) {
+	s.unwatchedGrace = grace
+	s.markUnwatched = mark
+}
+
+// SetAllowMassUnwatch allows the watchlist to lose everyone, or most of the
+// artists, in one run.  By default that stops the run without recording
+// anything, since it's more likely FA served a broken watchlist.
+//
+// Parameters:
+//   - allow: Whether to accept such a watchlist
+func (s *Scraper) SetAllowMassUnwatch(allow bool) {
+	s.massUnwatch = allow
+}
+
+// SetLoginCheck verifies the cookies are logged in before the run starts,
+// and again every interval during it, so a session which has been logged out
+// stops the run rather than silently missing everything that needs a login.
+//
+// Parameters:
+//   - expected: The username the cookies must be for, or empty for any
+//   - interval: How often to check again during the run, 0 for only at the start
+func (s *Scraper) SetLoginCheck(expected string, interval time.Duration) {
+	s.loginCheck = true
+	s.loginUser = expected
+	s.loginRecheck = interval
+}
+
+// SetSubmissions adds individual submissions to download, after any artists.
+// Each one is saved in its artist's directory, as if it had been found by
+// crawling their gallery or scraps.
+//
+// Parameters:
+//   - ids: FurAffinity submission IDs
+func (s *Scraper) SetSubmissions(ids []uint64) {
+	s.submissionIDs = ids
+}
+
+// SetFavorites adds users whose favorites should be downloaded, after any
+// artists and individual submissions.  Each favorited submission is saved in
+// its own artist's directory, and the list of favorites is recorded in the
+// favorites directory.
+//
+// Parameters:
+//   - users: FurAffinity usernames
+func (s *Scraper) SetFavorites(users []string) {
+	s.favorites = users
+}
+
 // Run executes the complete scraping process by retrieving the watchlist for
 // the specified user, then downloading submissions from each artist on the
-// list.
+// list, then any individual submissions and favorites.
+//
+// Parameters:
+//   - ctx: Context for cancellation.  Canceling it stops the run promptly.
 //
 // Returns:
 //   - error: Any error encountered during the scraping process, nil on success
-func (s *Scraper) Run() error {
+func (s *Scraper) Run(ctx context.Context) error {
 	s.logger.Debug("Scraper.Run called")
 	s.logger.Info("Scraper running with config",
-		"watcher", s.watcher, "artists", s.artists, "reCrawl", s.reCrawl, "skipScraps", s.skipScraps)
+		"watcher", s.watcher, "artists", s.artists, "reCrawl", s.reCrawl, "skipScraps", s.skipScraps,
+		"journals", s.journals, "profiles", s.profiles, "recordFolders", s.recordFolders,
+		"inbox", s.inbox, "inboxFallback", s.inboxFallback,
+		"unwatchedGrace", s.unwatchedGrace, "markUnwatched", s.markUnwatched)
+
+	err := s.open()
+	if err != nil {
+		return err
+	}
+	err = s.checkLogin(ctx)
+	if err != nil {
+		return err
+	}
 
 	var artists []*Artist
 
 	// If a username is provided, get artists from their watchlist
 	if s.watcher != "" {
-		watchlist, err := GetArtistsFromWatchlist(s.logger, s.client, s.watcher, s.outputDir)
+		watchlist, err := GetArtistsFromWatchlist(ctx, s.logger, s.client, s.watcher, s.outputDir)
+		var layoutErr *SiteLayoutError
+		if errors.As(err, &layoutErr) {
+			s.saveDiagnostics(layoutErr)
+		}
 		if err != nil {
 			return err
 		}
 		artists = append(artists, watchlist...)
+
+		unwatched, err := s.trackWatchlist(watchlist)
+		if err != nil {
+			return err
+		}
+		artists = append(artists, unwatched...)
 	}
 
-	// If an artist is provided, add them directly
-	for _, artist := range s.artists {
-		artistDir := filepath.Join(s.outputDir, artist)
-		artistObj := NewArtist(s.logger, s.client, artist, artistDir)
-		artists = append(artists, artistObj)
+	// If an artist is provided, add them directly.  An artist may be given
+	// more than once with different folders.
+	byName := make(map[string]*Artist)
+	for _, arg := range s.artists {
+		username, folder := ParseArtistArg(arg)
+		if current := s.aliases.Resolve(username); current != username {
+			s.logger.Info("Artist has been renamed", "old", username, "new", current)
+			username = current
+		}
+		artistObj, ok := byName[username]
+		if !ok {
+			artistDir := filepath.Join(s.outputDir, username)
+			artistObj = NewArtist(s.logger, s.client, username, artistDir)
+			artistObj.SetFolderFilter([]string{})
+			byName[username] = artistObj
+			artists = append(artists, artistObj)
+		}
+
+		// The whole gallery wins over any folders.
+		filter := artistObj.FolderFilter()
+		if folder == "" || filter == nil {
+			artistObj.SetFolderFilter(nil)
+			continue
+		}
+		artistObj.SetFolderFilter(append(filter, folder))
+	}
+
+	for _, artist := range artists {
+		artist.SetIndex(s.index)
+	}
+	s.summary.ArtistsTotal = len(artists)
+
+	// The inbox covers most artists, so only the rest need crawling.
+	if s.inbox {
+		artists, err = s.crawlInbox(ctx, artists)
+		if err != nil {
+			return err
+		}
 	}
 
 	// The main loop.  Get submissions from each artist and save them.  This is
@@ -89,21 +314,875 @@ func (s *Scraper) Run() error {
 	// the FA servers.  This is already fast enough that we add delays between
 	// requests.  Concurrency would just make things worse.
 	for i, artist := range artists {
-		submissions, err := artist.Submissions(s.reCrawl, s.skipScraps)
+		err := ctx.Err()
+		if err != nil {
+			return fmt.Errorf("run interrupted: %w", err)
+		}
+		err = s.checkLogin(ctx)
 		if err != nil {
 			return err
 		}
 
-		// Display progress messages
 		progress := fmt.Sprintf("%d/%d", i+1, len(artists))
-		s.logger.Info(artist.Username(), "progress", progress, "new", len(submissions))
+		err = s.crawlArtist(ctx, artist, progress)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, id := range s.submissionIDs {
+		err := ctx.Err()
+		if err != nil {
+			return fmt.Errorf("run interrupted: %w", err)
+		}
+		err = s.checkLogin(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = s.saveSingleSubmission(ctx, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, user := range s.favorites {
+		err := ctx.Err()
+		if err != nil {
+			return fmt.Errorf("run interrupted: %w", err)
+		}
+		err = s.checkLogin(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = s.crawlFavorites(ctx, NewFavorites(s.logger, s.client, user, s.outputDir))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, query := range s.searches {
+		err := ctx.Err()
+		if err != nil {
+			return fmt.Errorf("run interrupted: %w", err)
+		}
+		err = s.checkLogin(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = s.crawlSearch(ctx, NewSearch(s.logger, s.client, query, s.outputDir))
+		if err != nil {
+			return err
+		}
+	}
+	s.logFailures()
+	return nil
+}
+
+// trackWatchlist records the watchlist just fetched and logs who has been
+// added and removed since the last run.  Removed artists are marked, and those
+// still in their grace period are returned to be crawled, if so configured.
+//
+// Parameters:
+//   - watchlist: The artists on the watchlist
+//
+// Returns:
+//   - []*Artist: Removed artists who should still be crawled
+//   - error: ErrMassUnwatch if too many artists have gone at once, or any
+//     error updating the watchlist record or markers
+func (s *Scraper) trackWatchlist(watchlist []*Artist) ([]*Artist, error) {
+	names := make([]string, len(watchlist))
+	for i, artist := range watchlist {
+		names[i] = artist.Username()
+	}
+
+	now := time.Now()
+	tracker := NewWatchlist(s.watcher, s.outputDir)
+	tracker.SetAllowMassRemoval(s.massUnwatch)
+	record, change, err := tracker.Update(names, s.unwatchedGrace, now)
+	if err != nil {
+		return nil, err
+	}
+	if len(change.Added) > 0 || len(change.Removed) > 0 {
+		s.logger.Info("Watchlist changed", "watcher", s.watcher, "added", change.Added, "removed", change.Removed)
+	}
+
+	for _, name := range change.Added {
+		err = clearUnwatched(filepath.Join(s.outputDir, name))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if s.markUnwatched {
+		for name, since := range record.Unwatched {
+			err = markUnwatched(filepath.Join(s.outputDir, name), UnwatchedMarker{Watcher: s.watcher, Since: since})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var artists []*Artist
+	for _, name := range record.InGracePeriod(s.unwatchedGrace, now) {
+		s.logger.Info("Still crawling unwatched artist", "artist", name, "since", record.Unwatched[name])
+		artists = append(artists, NewArtist(s.logger, s.client, name, filepath.Join(s.outputDir, name)))
+	}
+	return artists, nil
+}
+
+// RetryFailed re-attempts everything in the failure ledger.  Entries which
+// succeed are removed from the ledger, and entries which fail again have
+// their attempt count updated.  This always continues past errors, since the
+// ledger is a list of things that are expected to fail.
+//
+// Parameters:
+//   - ctx: Context for cancellation.  Canceling it stops the run promptly.
+//
+// Returns:
+//   - error: Any error which stopped the retry, nil if every entry was attempted
+func (s *Scraper) RetryFailed(ctx context.Context) error {
+	s.continueOnError = true
+	err := s.open()
+	if err != nil {
+		return err
+	}
+	err = s.checkLogin(ctx)
+	if err != nil {
+		return err
+	}
+
+	entries := s.ledger.Entries()
+	s.logger.Info("Retrying failures", "ledger", s.ledger.Path(), "entries", len(entries))
+	for _, entry := range entries {
+		if entry.Kind == failureKindArtist {
+			s.summary.ArtistsTotal++
+		}
+	}
+
+	for i, entry := range entries {
+		err := ctx.Err()
+		if err != nil {
+			return fmt.Errorf("retry interrupted: %w", err)
+		}
+		err = s.checkLogin(ctx)
+		if err != nil {
+			return err
+		}
+
+		dir, err := s.ledger.LocalDir(entry)
+		if err != nil {
+			s.logger.Warn("Skipping failure ledger entry", "entry", i, "error", err)
+			continue
+		}
+
+		switch entry.Kind {
+		case failureKindArtist:
+			artist := NewArtist(s.logger, s.client, entry.Artist, dir)
+			artist.SetIndex(s.index)
+			artist.SetFolderFilter(entry.Folders)
+			err = s.crawlArtist(ctx, artist, fmt.Sprintf("%d/%d", i+1, len(entries)))
+		case failureKindSubmission:
+			if entry.Artist == "" {
+				// A single submission which failed before we found its artist
+				err = s.saveSingleSubmission(ctx, entry.ID)
+				break
+			}
+			submission := NewSubmission(s.logger, s.client, entry.ID, dir)
+			submission.SetIndex(s.index)
+			err = s.saveSubmission(ctx, entry.Artist, submission)
+		case failureKindProfile:
+			artist := NewArtist(s.logger, s.client, entry.Artist, dir)
+			err = s.snapshotProfile(ctx, artist)
+		case failureKindJournal:
+			err = s.saveJournal(ctx, entry.Artist, NewJournal(s.logger, s.client, entry.ID, dir))
+		case failureKindFavorites:
+			err = s.crawlFavorites(ctx, NewFavorites(s.logger, s.client, entry.Artist, s.outputDir))
+		case failureKindInbox:
+			_, err = s.crawlInbox(ctx, nil)
+		case failureKindSearch:
+			if entry.Search == nil {
+				s.logger.Warn("Skipping failure ledger entry", "entry", i, "error",
+					fmt.Errorf("%w: search without a query", ErrFailureLedgerInvalid))
+				continue
+			}
+			err = s.crawlSearch(ctx, NewSearch(s.logger, s.client, *entry.Search, s.outputDir))
+		default:
+			s.logger.Warn("Skipping failure ledger entry", "entry", i, "error",
+				fmt.Errorf("%w: kind %q", ErrFailureLedgerInvalid, entry.Kind))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	s.logFailures()
+	return nil
+}
+
+// checkLogin verifies the cookies are still logged in, if SetLoginCheck
+// asked for that and it hasn't been checked recently.  It's always checked the
+// first time.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//
+// Returns:
+//   - error: ErrNotLoggedIn or ErrWrongAccount, which should stop the run, or
+//     any error fetching the page
+func (s *Scraper) checkLogin(ctx context.Context) error {
+	if !s.loginCheck {
+		return nil
+	}
+	if !s.loginCheckedAt.IsZero() && (s.loginRecheck <= 0 || time.Since(s.loginCheckedAt) < s.loginRecheck) {
+		return nil
+	}
+
+	username, err := VerifyLogin(ctx, s.client, s.loginUser)
+	if err != nil {
+		return err
+	}
+	if s.loginCheckedAt.IsZero() {
+		s.logger.Info("Logged in", "username", username)
+	} else {
+		s.logger.Debug("Still logged in", "username", username)
+	}
+	s.loginCheckedAt = time.Now()
+	return nil
+}
+
+// open loads the archive index, failure ledger and artist aliases for the
+// output directory.
+//
+// Returns:
+//   - error: Any error encountered while loading them
+func (s *Scraper) open() error {
+	var err error
+	s.index, err = OpenArchiveIndex(s.logger, s.outputDir)
+	if err != nil {
+		return err
+	}
+	s.ledger, err = OpenFailureLedger(s.logger, s.outputDir)
+	if err != nil {
+		return err
+	}
+	s.aliases, err = OpenArtistAliases(s.outputDir)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// crawlArtist finds an artist's new submissions and journals and saves them,
+// then snapshots their profile.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - artist: The artist to crawl
+//   - progress: Progress through the run, for the log
+//
+// Returns:
+//   - error: Any error which should stop the run
+func (s *Scraper) crawlArtist(ctx context.Context, artist *Artist, progress string) error {
+	if artist.FolderFilter() != nil {
+		return s.crawlArtistFolders(ctx, artist, progress)
+	}
+
+	submissions, err := artist.Submissions(ctx, s.reCrawl, s.skipScraps)
+	var layoutErr *SiteLayoutError
+	var accountErr *AccountUnavailableError
+	var renamedErr *ArtistRenamedError
+	switch {
+	case errors.As(err, &renamedErr):
+		return s.handleRenamed(ctx, artist, renamedErr, progress)
+	case errors.As(err, &layoutErr):
+		return s.handleLayoutError(artistFailure(artist), layoutErr)
+	case errors.As(err, &accountErr):
+		return s.handleUnavailable(artist, accountErr)
+	case err != nil:
+		return s.handleFailure(ctx, artistFailure(artist), err)
+	}
+	s.layoutErrors = 0
+
+	// Display progress messages
+	s.logger.Info(artist.Username(), "progress", progress, "new", len(submissions))
+
+	for _, submission := range submissions {
+		err := s.saveSubmission(ctx, artist.Username(), submission)
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.journals {
+		journals, err := artist.Journals(ctx, s.reCrawl)
+		switch {
+		case errors.As(err, &layoutErr):
+			return s.handleLayoutError(artistFailure(artist), layoutErr)
+		case err != nil:
+			return s.handleFailure(ctx, artistFailure(artist), err)
+		}
+		if len(journals) > 0 {
+			s.logger.Info(artist.Username(), "progress", progress, "newJournals", len(journals))
+		}
 
-		for _, submission := range submissions {
-			err := submission.Save()
+		for _, journal := range journals {
+			err := s.saveJournal(ctx, artist.Username(), journal)
 			if err != nil {
 				return err
 			}
 		}
 	}
+
+	if s.recordFolders {
+		// The whole gallery has been saved already.
+		folders, _, err := artist.CrawlFolders(ctx, s.reCrawl)
+		if err == nil {
+			err = artist.RecordFolders(folders)
+		}
+		switch {
+		case errors.As(err, &layoutErr):
+			return s.handleLayoutError(artistFailure(artist), layoutErr)
+		case err != nil:
+			return s.handleFailure(ctx, artistFailure(artist), err)
+		}
+	}
+
+	if s.profiles {
+		err := s.snapshotProfile(ctx, artist)
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.inboxState != nil {
+		s.inboxState.Seen(artist.Username(), time.Now())
+		err := NewInbox(s.logger, s.client, s.outputDir).Save(s.inboxState)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = artist.RecordStatus(AccountActive, "", time.Now())
+	if err != nil {
+		return err
+	}
+	s.summary.ArtistsCompleted++
+	return s.ledger.Resolve(artistFailure(artist))
+}
+
+// crawlArtistFolders is crawlArtist for an artist limited to some of their
+// gallery folders.  Only submissions in those folders are saved, and the
+// artist's journals and profile are left alone.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - artist: The artist to crawl, with a folder filter
+//   - progress: Progress through the run, for the log
+//
+// Returns:
+//   - error: Any error which should stop the run
+func (s *Scraper) crawlArtistFolders(ctx context.Context, artist *Artist, progress string) error {
+	folders, ids, err := artist.CrawlFolders(ctx, s.reCrawl)
+	var layoutErr *SiteLayoutError
+	var accountErr *AccountUnavailableError
+	var renamedErr *ArtistRenamedError
+	switch {
+	case errors.As(err, &renamedErr):
+		return s.handleRenamed(ctx, artist, renamedErr, progress)
+	case errors.As(err, &layoutErr):
+		return s.handleLayoutError(artistFailure(artist), layoutErr)
+	case errors.As(err, &accountErr):
+		return s.handleUnavailable(artist, accountErr)
+	case err != nil:
+		return s.handleFailure(ctx, artistFailure(artist), err)
+	}
+	s.layoutErrors = 0
+
+	// A submission can be in more than one folder, and may already have
+	// been saved from the whole gallery.
+	seen := make(map[uint64]bool, len(ids))
+	var newIDs []uint64
+	for _, id := range ids {
+		if seen[id] || s.isArchived(artist.Username(), id) {
+			continue
+		}
+		seen[id] = true
+		newIDs = append(newIDs, id)
+	}
+	s.logger.Info(artist.Username(), "progress", progress, "folders", artist.FolderFilter(), "new", len(newIDs))
+
+	// Oldest first, like the gallery
+	for i := len(newIDs) - 1; i >= 0; i-- {
+		err := ctx.Err()
+		if err != nil {
+			return fmt.Errorf("run interrupted: %w", err)
+		}
+
+		err = s.saveSingleSubmission(ctx, newIDs[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	// Only now that they're saved, so an interrupted run finds them again.
+	err = artist.RecordFolders(folders)
+	if err != nil {
+		return err
+	}
+
+	err = artist.RecordStatus(AccountActive, "", time.Now())
+	if err != nil {
+		return err
+	}
+	s.summary.ArtistsCompleted++
+	return s.ledger.Resolve(artistFailure(artist))
+}
+
+// isArchived reports whether the archive index already has a submission in
+// either of the places an artist's submissions are saved.
+//
+// Parameters:
+//   - artistName: The artist the submission belongs to
+//   - id: The FurAffinity submission ID
+//
+// Returns:
+//   - bool: true if the submission is already saved
+func (s *Scraper) isArchived(artistName string, id uint64) bool {
+	artistDir := filepath.Join(s.outputDir, artistName)
+	return s.index.Contains(artistDir, id) ||
+		s.index.Contains(filepath.Join(artistDir, "scraps"), id)
+}
+
+// saveSubmission saves a single submission.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - artistName: The artist the submission belongs to, for the failure ledger
+//   - submission: The submission to save
+//
+// Returns:
+//   - error: Any error which should stop the run
+func (s *Scraper) saveSubmission(ctx context.Context, artistName string, submission *Submission) error {
+	err := submission.Save(ctx)
+	if err != nil {
+		return s.handleFailure(ctx, submissionFailure(artistName, submission), err)
+	}
+	s.summary.Submissions++
+	return s.ledger.Resolve(submissionFailure(artistName, submission))
+}
+
+// snapshotProfile saves a new snapshot of an artist's profile if it has
+// changed.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - artist: The artist
+//
+// Returns:
+//   - error: Any error which should stop the run
+func (s *Scraper) snapshotProfile(ctx context.Context, artist *Artist) error {
+	changed, err := artist.SnapshotProfile(ctx)
+	if err != nil {
+		return s.handleFailure(ctx, profileFailure(artist), err)
+	}
+	if changed {
+		s.summary.Profiles++
+	}
+	return s.ledger.Resolve(profileFailure(artist))
+}
+
+// saveJournal saves a single journal.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - artistName: The artist the journal belongs to, for the failure ledger
+//   - journal: The journal to save
+//
+// Returns:
+//   - error: Any error which should stop the run
+func (s *Scraper) saveJournal(ctx context.Context, artistName string, journal *Journal) error {
+	err := journal.Save(ctx)
+	if err != nil {
+		return s.handleFailure(ctx, journalFailure(artistName, journal), err)
+	}
+	s.summary.Journals++
+	return s.ledger.Resolve(journalFailure(artistName, journal))
+}
+
+// crawlFavorites finds a user's favorites and saves each favorited
+// submission, then records the list.  Submissions the archive index already
+// has are skipped without fetching anything.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - favorites: The favorites to crawl
+//
+// Returns:
+//   - error: Any error which should stop the run
+func (s *Scraper) crawlFavorites(ctx context.Context, favorites *Favorites) error {
+	entries, err := favorites.Crawl(ctx, s.reCrawl)
+	var layoutErr *SiteLayoutError
+	if errors.As(err, &layoutErr) {
+		s.saveDiagnostics(layoutErr)
+	}
+	if err != nil {
+		return s.handleFailure(ctx, favoritesFailure(favorites), err)
+	}
+
+	newEntries, err := s.saveListed(ctx, entries)
+	if err != nil {
+		return err
+	}
+	s.logger.Info("Favorites", "user", favorites.Username(), "listed", len(entries), "new", newEntries)
+
+	err = favorites.Record(entries, s.reCrawl)
+	if err != nil {
+		return err
+	}
+	return s.ledger.Resolve(favoritesFailure(favorites))
+}
+
+// crawlSearch finds a search's results and saves each submission, then
+// records the results, the same way crawlFavorites does for favorites.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - search: The search to crawl
+//
+// Returns:
+//   - error: Any error which should stop the run
+func (s *Scraper) crawlSearch(ctx context.Context, search *Search) error {
+	entries, err := search.Crawl(ctx, s.reCrawl)
+	var layoutErr *SiteLayoutError
+	if errors.As(err, &layoutErr) {
+		s.saveDiagnostics(layoutErr)
+	}
+	if err != nil {
+		return s.handleFailure(ctx, searchFailure(search), err)
+	}
+
+	newEntries, err := s.saveListed(ctx, entries)
+	if err != nil {
+		return err
+	}
+	s.logger.Info("Search", "query", search.Query().Query, "listed", len(entries), "new", newEntries)
+
+	err = search.Record(entries, s.reCrawl)
+	if err != nil {
+		return err
+	}
+	return s.ledger.Resolve(searchFailure(search))
+}
+
+// saveListed saves the submissions found in a list of other artists' work,
+// like favorites or search results.  Submissions the archive index already
+// has are skipped without fetching anything.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - entries: The submissions listed
+//
+// Returns:
+//   - int: How many submissions weren't already saved
+//   - error: Any error which should stop the run
+func (s *Scraper) saveListed(ctx context.Context, entries []ListedSubmission) (int, error) {
+	newEntries := 0
+	for _, entry := range entries {
+		err := ctx.Err()
+		if err != nil {
+			return newEntries, fmt.Errorf("run interrupted: %w", err)
+		}
+
+		// The list says who the artist is, so we can check both places the
+		// submission might be saved before fetching anything.
+		if entry.Artist != "" && s.isArchived(entry.Artist, entry.ID) {
+			continue
+		}
+
+		newEntries++
+		err = s.saveSingleSubmission(ctx, entry.ID)
+		if err != nil {
+			return newEntries, err
+		}
+	}
+	return newEntries, nil
+}
+
+// crawlInbox saves the new submissions in the logged-in user's submission
+// inbox, then works out which artists still need their galleries crawled.
+// Artists seen in the inbox recently are counted as complete.  If the inbox
+// can't be read and the run continues anyway, every artist is crawled.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - artists: The artists queued for this run
+//
+// Returns:
+//   - []*Artist: The artists which still need crawling
+//   - error: Any error which should stop the run
+func (s *Scraper) crawlInbox(ctx context.Context, artists []*Artist) ([]*Artist, error) {
+	inbox := NewInbox(s.logger, s.client, s.outputDir)
+	state, err := inbox.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := inbox.Crawl(ctx, func(entry ListedSubmission) bool {
+		return entry.Artist != "" && s.isArchived(entry.Artist, entry.ID)
+	}, s.reCrawl)
+	var layoutErr *SiteLayoutError
+	if errors.As(err, &layoutErr) {
+		s.saveDiagnostics(layoutErr)
+	}
+	if err != nil {
+		err = s.handleFailure(ctx, inboxFailure(inbox), err)
+		if err != nil {
+			return nil, err
+		}
+		s.logger.Warn("Submission inbox failed, crawling every artist instead")
+		return artists, nil
+	}
+	s.inboxState = state
+
+	// Oldest first, like galleries
+	now := time.Now()
+	newEntries := 0
+	unsaved := make(map[string]bool) // Artists with an entry which failed
+	for i := len(entries) - 1; i >= 0; i-- {
+		err := ctx.Err()
+		if err != nil {
+			return nil, fmt.Errorf("run interrupted: %w", err)
+		}
+
+		entry := entries[i]
+		if entry.Artist != "" && s.isArchived(entry.Artist, entry.ID) {
+			continue
+		}
+
+		newEntries++
+		err = s.saveSingleSubmission(ctx, entry.ID)
+		if err != nil {
+			return nil, err
+		}
+		if entry.Artist != "" && !s.isArchived(entry.Artist, entry.ID) {
+			unsaved[entry.Artist] = true
+		}
+	}
+
+	// An artist only counts as seen once everything of theirs in the inbox is
+	// saved.  Otherwise a failure skipped with --continue-on-error would also
+	// skip their gallery until the fallback comes round.
+	for _, entry := range entries {
+		if entry.Artist != "" && !unsaved[entry.Artist] {
+			state.Seen(entry.Artist, now)
+		}
+	}
+
+	err = inbox.Save(state)
+	if err != nil {
+		return nil, err
+	}
+	err = s.ledger.Resolve(inboxFailure(inbox))
+	if err != nil {
+		return nil, err
+	}
+
+	// Artists limited to some folders aren't covered by the inbox.
+	var due []*Artist
+	for _, artist := range artists {
+		if artist.FolderFilter() != nil || state.Due(artist.Username(), s.inboxFallback, now) {
+			due = append(due, artist)
+			continue
+		}
+		s.summary.ArtistsCompleted++
+	}
+	s.logger.Info("Submission inbox", "listed", len(entries), "new", newEntries,
+		"artistsCovered", len(artists)-len(due), "artistsToCrawl", len(due))
+	return due, nil
+}
+
+// saveSingleSubmission saves a submission given only its ID.  The /view/
+// page is fetched first to find which artist it belongs to.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - id: The FurAffinity submission ID
+//
+// Returns:
+//   - error: Any error which should stop the run
+func (s *Scraper) saveSingleSubmission(ctx context.Context, id uint64) error {
+	// Until the lookup succeeds, all we know is the ID.
+	unresolved := submissionFailure("", NewSubmission(s.logger, s.client, id, s.outputDir))
+
+	submission, artistName, pageContent, err := LookupSubmission(ctx, s.logger, s.client, s.outputDir, id)
+	if err != nil {
+		return s.handleFailure(ctx, unresolved, err)
+	}
+	submission.SetIndex(s.index)
+	entry := submissionFailure(artistName, submission)
+
+	if submission.IsSaved() {
+		s.logger.Info("Submission already saved", "id", id, "artist", artistName)
+	} else {
+		err = submission.SaveFromViewPage(ctx, pageContent)
+		if err != nil {
+			return s.handleFailure(ctx, entry, err)
+		}
+		s.summary.Submissions++
+	}
+
+	err = s.ledger.Resolve(unresolved)
+	if err != nil {
+		return err
+	}
+	return s.ledger.Resolve(entry)
+}
+
+// handleFailure decides whether a failed artist or submission stops the run.
+// In continue-on-error mode it is recorded in the failure ledger instead.
+// Cancellation is never recorded, since nothing actually went wrong, and
+// running out of throttle budget always stops the run, since everything after
+// it would fail too.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - entry: Identifies what failed
+//   - cause: The error
+//
+// Returns:
+//   - error: cause if the run should stop, or an error writing the ledger
+func (s *Scraper) handleFailure(ctx context.Context, entry FailureEntry, cause error) error {
+	if !s.continueOnError || ctx.Err() != nil || errors.Is(cause, ErrThrottleBudgetExceeded) {
+		return cause
+	}
+
+	s.logger.Warn("Failed, continuing", "kind", entry.Kind, "artist", entry.Artist, "id", entry.ID,
+		"url", entry.URL, "error", cause)
+	s.summary.Failures++
+	return s.ledger.Record(entry, cause)
+}
+
+// handleRenamed deals with an artist whose pages FA redirects to another
+// username, which means they've been renamed.  The alias is recorded, so
+// later runs go straight to the new name, and the artist is crawled under
+// their new name.  Their old directory is left alone until it's merged with
+// the merge-aliases subcommand.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - artist: The artist, under their old name
+//   - renamedErr: The error describing the redirect
+//   - progress: Progress through the run, for the log
+//
+// Returns:
+//   - error: Any error which should stop the run
+func (s *Scraper) handleRenamed(
+	ctx context.Context, artist *Artist, renamedErr *ArtistRenamedError, progress string,
+) error {
+	s.logger.Warn("Artist has been renamed, crawling the new name", "old", artist.Username(),
+		"new", renamedErr.NewName, "url", renamedErr.URL)
+	err := s.aliases.Record(artist.Username(), ArtistAlias{
+		NewName:    renamedErr.NewName,
+		DetectedAt: time.Now().UTC(),
+		URL:        renamedErr.URL,
+	})
+	if err != nil {
+		// A loop of renames.  Crawling the new name would redirect back.
+		return s.handleFailure(ctx, artistFailure(artist), err)
+	}
+	err = s.ledger.Resolve(artistFailure(artist))
+	if err != nil {
+		return err
+	}
+
+	renamed := NewArtist(s.logger, s.client, renamedErr.NewName, filepath.Join(s.outputDir, renamedErr.NewName))
+	renamed.SetIndex(s.index)
+	renamed.SetFolderFilter(artist.FolderFilter())
+	return s.crawlArtist(ctx, renamed, progress)
+}
+
+// handleUnavailable deals with an artist whose account FA says is disabled,
+// deleted or otherwise unavailable.  That isn't a failure, and retrying won't
+// help, so the artist is skipped and the status is recorded in their status
+// file rather than the failure ledger.
+//
+// Parameters:
+//   - artist: The artist
+//   - accountErr: The error describing the account's status
+//
+// Returns:
+//   - error: Any error writing the status file or ledger
+func (s *Scraper) handleUnavailable(artist *Artist, accountErr *AccountUnavailableError) error {
+	s.layoutErrors = 0
+	s.logger.Warn("Artist account unavailable, skipping", "artist", artist.Username(),
+		"status", accountErr.Status, "message", accountErr.Message)
+	s.summary.ArtistsUnavailable++
+
+	err := artist.RecordStatus(accountErr.Status, accountErr.Message, time.Now())
+	if err != nil {
+		return err
+	}
+	return s.ledger.Resolve(artistFailure(artist))
+}
+
+// handleLayoutError deals with an artist whose pages weren't recognized.  The
+// page is saved to the diagnostics directory and the artist is skipped, since
+// FA may have changed just that one page.  If several artists in a row fail
+// this way, the change is probably site wide and the run stops.  In
+// continue-on-error mode, skipped artists are also recorded in the failure
+// ledger.
+//
+// Parameters:
+//   - entry: Identifies the artist
+//   - layoutErr: The error
+//
+// Returns:
+//   - error: An error if the run should stop, nil to skip the artist
+func (s *Scraper) handleLayoutError(entry FailureEntry, layoutErr *SiteLayoutError) error {
+	s.saveDiagnostics(layoutErr)
+
+	s.layoutErrors++
+	if s.layoutErrors >= maxConsecutiveLayoutErrors {
+		return fmt.Errorf("%d artists in a row had unrecognized pages, stopping: %w", s.layoutErrors, layoutErr)
+	}
+
+	s.logger.Warn("Skipping artist with unrecognized pages", "artist", entry.Artist, "error", layoutErr)
+	s.summary.ArtistsSkipped++
+	if s.continueOnError {
+		s.summary.Failures++
+		return s.ledger.Record(entry, layoutErr)
+	}
 	return nil
 }
+
+// saveDiagnostics saves an unrecognized page for debugging.  Failing to save
+// it is only logged, since the layout error is what matters.
+//
+// Parameters:
+//   - layoutErr: The error holding the page
+func (s *Scraper) saveDiagnostics(layoutErr *SiteLayoutError) {
+	path, err := SaveDiagnosticPage(s.outputDir, layoutErr)
+	if err != nil {
+		s.logger.Warn("Failed to save unrecognized page", "url", layoutErr.URL, "error", err)
+		return
+	}
+	s.logger.Warn("Saved unrecognized page for debugging", "url", layoutErr.URL, "path", path)
+}
+
+// logFailures reminds the user about the failure ledger at the end of a run.
+func (s *Scraper) logFailures() {
+	if s.summary.Failures > 0 {
+		s.logger.Warn("Some downloads failed, run retry-failed to try them again",
+			"failures", s.summary.Failures, "ledger", s.ledger.Path())
+	}
+}
+
+// Summary returns how far the most recent Run got.
+//
+// Returns:
+//   - RunSummary: Counts of artists and submissions processed
+func (s *Scraper) Summary() RunSummary {
+	return s.summary
+}
@@ -3,6 +3,7 @@ package main_test
 // SPDX-License-Identifier: GPL-3.0-only
 
 import (
+	"context"
 	main "furtrap"
 	"os"
 	"path/filepath"
@@ -41,7 +42,7 @@ func TestScraperRun(t *testing.T) {
 
 				// Perform the test run
 				scraper := main.NewScraper(NewTestLogger(t), client, tt.watcher, tt.artists, false, false, tempdir)
-				err := scraper.Run()
+				err := scraper.Run(t.Context())
 				assert.NilError(t, err)
 
 				// Then verify that all expected files were downloaded
@@ -88,7 +89,7 @@ func TestScraperRun(t *testing.T) {
 				}
 				for _, file := range files {
 					// Get the expected content from the test server
-					want, err := client.Get(file.wanturi)
+					want, err := client.Get(t.Context(), file.wanturi)
 					assert.NilError(t, err)
 
 					// Confirm the file was downloaded correctly
@@ -99,7 +100,32 @@ func TestScraperRun(t *testing.T) {
 
 					assert.DeepEqual(t, have, want)
 				}
+
+				// Every submission should be in the archive index
+				entries := readArchiveIndex(t, tempdir)
+				assert.Equal(t, len(entries), 4)
+
+				assert.DeepEqual(t, scraper.Summary(), main.RunSummary{
+					ArtistsTotal:     1,
+					ArtistsCompleted: 1,
+					Submissions:      4,
+				})
 			})
 		}
 	})
+
+	t.Run("canceled context stops the run", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+
+		tempdir := t.TempDir()
+		scraper := main.NewScraper(NewTestLogger(t), NewTestClient(), "",
+			[]string{"artist-with-two-submissions"}, false, false, tempdir)
+		err := scraper.Run(ctx)
+		assert.ErrorIs(t, err, context.Canceled)
+
+		assert.DeepEqual(t, scraper.Summary(), main.RunSummary{ArtistsTotal: 1})
+		_, err = os.Stat(filepath.Join(tempdir, "artist-with-two-submissions"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
 }
@@ -0,0 +1,355 @@
+package main
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	// Directory under the output dir where search results are recorded.
+	searchesDirname = "searches"
+
+	// FA's search endpoint.  Every page of results is a POST of the search
+	// form to this address.
+	searchURL = "https://www.furaffinity.net/search/"
+
+	// Results per page.  72 is the most FA allows.
+	searchPerPage = "72"
+
+	// Longest the readable part of a search's filename may be.
+	maxSearchSlugLength = 40
+
+	// Length of the hash which makes search filenames unique.
+	searchHashLength = 8
+)
+
+var (
+	ErrInvalidSearch = errors.New("invalid search")
+
+	// The rating and type filters FA's search form offers.
+	searchRatings = []string{"general", "mature", "adult"}
+	searchTypes   = []string{"art", "music", "flash", "story", "photo", "poetry"}
+
+	// Regex matching the runs of characters replaced in search filenames.
+	searchSlugRegexp = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// SearchQuery is a search to download: the query string, and which ratings
+// and types of submission to include.
+type SearchQuery struct {
+	Query   string   `json:"query"`
+	Ratings []string `json:"ratings,omitempty"` // Empty for every rating
+	Types   []string `json:"types,omitempty"`   // Empty for every type
+}
+
+// SearchRecord is the record of a search's results saved in the searches
+// directory, newest first.  It's what makes repeated runs of the same search
+// incremental.
+type SearchRecord struct {
+	Search SearchQuery `json:"search"`
+	SubmissionList
+}
+
+// NewSearchQuery validates and normalizes a search, so the same search
+// always gets the same record however its filters were written.
+//
+// Parameters:
+//   - query: The search terms, in FA's search syntax
+//   - ratings: Ratings to include: general, mature or adult.  Empty for all.
+//   - types: Types to include: art, music, flash, story, photo or poetry.
+//     Empty for all.
+//
+// Returns:
+//   - SearchQuery: The normalized search
+//   - error: ErrInvalidSearch if the query is empty or a filter is unknown
+func NewSearchQuery(query string, ratings []string, types []string) (SearchQuery, error) {
+	search := SearchQuery{Query: strings.TrimSpace(query)}
+	if search.Query == "" {
+		return SearchQuery{}, fmt.Errorf("%w: empty query", ErrInvalidSearch)
+	}
+
+	var err error
+	search.Ratings, err = normalizeSearchFilter("rating", ratings, searchRatings)
+	if err != nil {
+		return SearchQuery{}, err
+	}
+	search.Types, err = normalizeSearchFilter("type", types, searchTypes)
+	if err != nil {
+		return SearchQuery{}, err
+	}
+	return search, nil
+}
+
+// Name returns a filename for the search: a readable version of the query,
+// and a hash of the whole search so different filters get different files.
+//
+// Returns:
+//   - string: The name, e.g. "red-fox.1a2b3c4d"
+func (q SearchQuery) Name() string {
+	slug := strings.Trim(searchSlugRegexp.ReplaceAllString(strings.ToLower(q.Query), "-"), "-")
+	if len(slug) > maxSearchSlugLength {
+		slug = strings.TrimRight(slug[:maxSearchSlugLength], "-")
+	}
+	if slug == "" {
+		slug = "search"
+	}
+
+	key, err := json.Marshal(q)
+	if err != nil {
+		// A struct of strings always marshals.
+		fatalInvariant(err)
+	}
+	sum := sha256.Sum256(key)
+	return slug + "." + hex.EncodeToString(sum[:])[:searchHashLength]
+}
+
+// form builds the search form for a page of results.  Results are ordered
+// newest first, which is what lets a repeated search stop early.
+//
+// Parameters:
+//   - page: The page number, starting from 1
+//
+// Returns:
+//   - url.Values: The form fields
+func (q SearchQuery) form(page int) url.Values {
+	form := url.Values{
+		"q":               {q.Query},
+		"page":            {strconv.Itoa(page)},
+		"perpage":         {searchPerPage},
+		"order-by":        {"date"},
+		"order-direction": {"desc"},
+		"range":           {"all"},
+		"mode":            {"extended"},
+	}
+	if page > 1 {
+		form.Set("next_page", "Next")
+	} else {
+		form.Set("do_search", "Search")
+	}
+
+	ratings := q.Ratings
+	if len(ratings) == 0 {
+		ratings = searchRatings
+	}
+	for _, rating := range ratings {
+		form.Set("rating-"+rating, "1")
+	}
+	types := q.Types
+	if len(types) == 0 {
+		types = searchTypes
+	}
+	for _, typ := range types {
+		form.Set("type-"+typ, "1")
+	}
+	return form
+}
+
+// normalizeSearchFilter checks a rating or type filter, and puts it in a
+// standard form: lowercase, sorted, and empty if everything is selected.
+//
+// Parameters:
+//   - kind: "rating" or "type", for error messages
+//   - values: The filter as given
+//   - allowed: Every valid value
+//
+// Returns:
+//   - []string: The normalized filter
+//   - error: ErrInvalidSearch if a value isn't allowed
+func normalizeSearchFilter(kind string, values []string, allowed []string) ([]string, error) {
+	var filter []string
+	for _, value := range values {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if !slices.Contains(allowed, value) {
+			return nil, fmt.Errorf("%w: unknown %s %q, expected one of %s",
+				ErrInvalidSearch, kind, value, strings.Join(allowed, ", "))
+		}
+		if !slices.Contains(filter, value) {
+			filter = append(filter, value)
+		}
+	}
+	if len(filter) == len(allowed) {
+		return nil, nil
+	}
+	slices.Sort(filter)
+	return filter, nil
+}
+
+// Search crawls the results of an FA search.  Like Favorites, the results
+// belong to other artists, so saving them is left to the caller.  This only
+// finds them and keeps the record of what the search has found.
+type Search struct {
+	logger    *slog.Logger
+	client    Client
+	query     SearchQuery
+	outputDir string
+}
+
+// NewSearch creates a new Search instance for the specified search.
+//
+// Parameters:
+//   - logger: Logger instance
+//   - client: HTTP client interface for making web requests
+//   - query: The search, as returned by NewSearchQuery
+//   - outputDir: The root of the output tree
+//
+// Returns:
+//   - *Search: A new Search instance ready for use
+func NewSearch(logger *slog.Logger, client Client, query SearchQuery, outputDir string) *Search {
+	return &Search{
+		logger:    logger,
+		client:    client,
+		query:     query,
+		outputDir: outputDir,
+	}
+}
+
+// Query returns the search being crawled.
+//
+// Returns:
+//   - SearchQuery: The search
+func (s *Search) Query() SearchQuery {
+	return s.query
+}
+
+// URL returns the address the search form is posted to.
+//
+// Returns:
+//   - string: The search URL
+func (s *Search) URL() string {
+	return searchURL
+}
+
+// Path returns where the search's results are recorded.
+//
+// Returns:
+//   - string: The path of the search record JSON file
+func (s *Search) Path() string {
+	return filepath.Join(s.outputDir, searchesDirname, s.query.Name()+".json")
+}
+
+// Load reads the previously recorded results.  A search which hasn't been
+// recorded yet is returned empty.
+//
+// Returns:
+//   - *SearchRecord: The recorded results
+//   - error: Any error reading or parsing the record
+func (s *Search) Load() (*SearchRecord, error) {
+	record := &SearchRecord{Search: s.query}
+
+	_, err := readJSONFile(s.Path(), record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load search record: %w", err)
+	}
+	return record, nil
+}
+
+// Crawl pages through the search results, newest first.  Unless reCrawl is
+// set, it stops after the first page with nothing that isn't already in the
+// record, the same way Favorites.Crawl does.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - reCrawl: If true, crawl every result
+//
+// Returns:
+//   - []ListedSubmission: The submissions found, newest first
+//   - error: Any error fetching the pages, or a *SiteLayoutError
+func (s *Search) Crawl(ctx context.Context, reCrawl bool) ([]ListedSubmission, error) {
+	s.logger.Debug("searching", "query", s.query.Query, "reCrawl", reCrawl)
+
+	recorded, err := s.Load()
+	if err != nil {
+		return nil, err
+	}
+	known := recorded.known()
+
+	listing := &listingCrawl[ListedSubmission]{
+		name:     "search",
+		firstURL: s.URL(),
+		logArgs:  []any{"query", s.query.Query},
+		fetchPage: func(ctx context.Context, url string, pageNum int) ([]byte, error) {
+			return s.client.PostWithDelay(ctx, url, s.query.form(pageNum))
+		},
+		nextPage: func(url string, body []byte, _ int) ([]ListedSubmission, string, error) {
+			// Every page is the same address, with the page number in the
+			// form, so the next page is there whenever this one isn't the end.
+			entries, more, err := parseSearchPage(url, body)
+			if err != nil || !more || len(entries) == 0 {
+				return entries, "", err
+			}
+			return entries, url, nil
+		},
+		isKnown: func(entry ListedSubmission) bool { return known[entry.ID] },
+	}
+	return listing.crawl(ctx, s.logger, reCrawl)
+}
+
+// Record saves the search results, merging newly crawled entries with the
+// previously recorded ones.  This should be called once the crawled
+// submissions have been saved, so an interrupted run crawls them again.
+//
+// Parameters:
+//   - crawled: The entries returned by Crawl
+//   - complete: If true, crawled is every result, and replaces the record so
+//     submissions which no longer match are dropped
+//
+// Returns:
+//   - error: Any error reading or writing the record
+func (s *Search) Record(crawled []ListedSubmission, complete bool) error {
+	record, err := s.Load()
+	if err != nil {
+		return err
+	}
+	record.Search = s.query
+
+	err = recordListed(s.Path(), record, &record.SubmissionList, crawled, complete)
+	if err != nil {
+		return fmt.Errorf("failed to record search: %w", err)
+	}
+	return nil
+}
+
+// parseSearchPage extracts the results from a page of search results, and
+// whether there's another page.
+//
+// Parameters:
+//   - url: The URL of the page, for error reporting
+//   - body: The HTML content of the page
+//
+// Returns:
+//   - []ListedSubmission: The submissions on this page
+//   - bool: true if there are more results
+//   - error: A *SiteLayoutError if the page isn't in the expected format
+func parseSearchPage(url string, body []byte) ([]ListedSubmission, bool, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		// goquery only fails if reading fails, which can't happen with an
+		// in-memory byte slice.
+		return nil, false, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	entries, err := parseSubmissionFigures(url, body, doc)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// The "next" button is disabled on the last page.
+	more := doc.Find("[name='next_page']").Not("[disabled]").Length() > 0
+	return entries, more, nil
+}
@@ -0,0 +1,185 @@
+package main_test
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"errors"
+	main "furtrap"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+const (
+	searchPage1 = "https://www.furaffinity.net/search/?page=1"
+	searchPage2 = "https://www.furaffinity.net/search/?page=2"
+
+	// The section search results are listed in, and the "next" button, which
+	// is disabled on the last page
+	searchSection = "id='search-results'"
+	searchMore    = "<form method='post'><button type='submit' name='next_page'>Next</button></form>"
+	searchLast    = "<form method='post'><button type='submit' name='next_page' disabled>Next</button></form>"
+)
+
+// searchPages are two pages of search results: 104 (a scrap) and 102, then
+// 101.
+var searchPages = map[string][]byte{
+	searchPage1: listingPage(searchSection, searchMore, 104, 102),
+	searchPage2: listingPage(searchSection, searchLast, 101),
+}
+
+// newTestSearchQuery returns a search for "red fox", failing the test if it
+// isn't valid.
+func newTestSearchQuery(t *testing.T, ratings ...string) main.SearchQuery {
+	t.Helper()
+	query, err := main.NewSearchQuery("red fox", ratings, nil)
+	assert.NilError(t, err)
+	return query
+}
+
+func TestNewSearchQuery(t *testing.T) {
+	query, err := main.NewSearchQuery("  red fox ", []string{"Mature", "general", "mature"}, nil)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, query, main.SearchQuery{Query: "red fox", Ratings: []string{"general", "mature"}})
+
+	// Selecting everything is the same as no filter.
+	all, err := main.NewSearchQuery("red fox", []string{"adult", "mature", "general"}, nil)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, all, main.SearchQuery{Query: "red fox"})
+
+	_, err = main.NewSearchQuery(" ", nil, nil)
+	assert.ErrorIs(t, err, main.ErrInvalidSearch)
+	_, err = main.NewSearchQuery("fox", nil, []string{"sculpture"})
+	assert.ErrorIs(t, err, main.ErrInvalidSearch)
+}
+
+func TestSearchQuery_Name(t *testing.T) {
+	plain, err := main.NewSearchQuery("Red Fox!", nil, nil)
+	assert.NilError(t, err)
+	assert.Assert(t, filepath.IsLocal(plain.Name()))
+	assert.Equal(t, plain.Name()[:len("red-fox.")], "red-fox.")
+
+	filtered, err := main.NewSearchQuery("Red Fox!", []string{"general"}, nil)
+	assert.NilError(t, err)
+	assert.Assert(t, plain.Name() != filtered.Name())
+
+	traversal, err := main.NewSearchQuery("../../etc", nil, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, traversal.Name()[:len("etc.")], "etc.")
+}
+
+func TestSearch_Crawl(t *testing.T) {
+	allEntries := []main.ListedSubmission{
+		{ID: 104, Artist: listedArtist},
+		{ID: 102, Artist: listedArtist},
+		{ID: 101, Artist: listedArtist},
+	}
+
+	t.Run("posts each page of the search", func(t *testing.T) {
+		client := newPagesTestClient(searchPages)
+		search := main.NewSearch(NewTestLogger(t), client, newTestSearchQuery(t, "general"), t.TempDir())
+
+		have, err := search.Crawl(t.Context(), false)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, have, allEntries)
+
+		assert.Equal(t, len(client.Posts), 2)
+		for i, form := range client.Posts {
+			assert.Equal(t, form.Get("q"), "red fox")
+			assert.Equal(t, form.Get("page"), strconv.Itoa(i+1))
+			assert.Equal(t, form.Get("order-by"), "date")
+			assert.Equal(t, form.Get("rating-general"), "1")
+			assert.Equal(t, form.Get("rating-adult"), "")
+			assert.Equal(t, form.Get("type-art"), "1")
+		}
+		assert.Equal(t, client.Posts[1].Get("next_page"), "Next")
+	})
+
+	t.Run("stops at a page with nothing new", func(t *testing.T) {
+		tempdir := t.TempDir()
+		search := main.NewSearch(NewTestLogger(t), newPagesTestClient(searchPages), newTestSearchQuery(t), tempdir)
+		err := search.Record(allEntries[:2], false)
+		assert.NilError(t, err)
+
+		client := newPagesTestClient(searchPages)
+		search = main.NewSearch(NewTestLogger(t), client, newTestSearchQuery(t), tempdir)
+		have, err := search.Crawl(t.Context(), false)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, have, allEntries[:2])
+		assert.Equal(t, len(client.Posts), 1)
+
+		// Unless re-crawling
+		have, err = search.Crawl(t.Context(), true)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, have, allEntries)
+	})
+
+	t.Run("layout error on non-numeric submission ID", func(t *testing.T) {
+		client := NewTestClient()
+		client.SetResponse(searchPage1, []byte("<figure id='sid-x'></figure>"), nil)
+		search := main.NewSearch(NewTestLogger(t), client, newTestSearchQuery(t), t.TempDir())
+
+		_, err := search.Crawl(t.Context(), false)
+		assert.ErrorIs(t, err, main.ErrSiteLayoutChanged)
+	})
+}
+
+func TestScraper_Searches(t *testing.T) {
+	t.Run("saves results and records the search", func(t *testing.T) {
+		tempdir := t.TempDir()
+		query := newTestSearchQuery(t)
+		scraper := main.NewScraper(NewTestLogger(t), newPagesTestClient(searchPages), "", nil, false, false, tempdir)
+		scraper.SetSearches([]main.SearchQuery{query})
+		err := scraper.Run(t.Context())
+		assert.NilError(t, err)
+		assert.DeepEqual(t, scraper.Summary(), main.RunSummary{Submissions: 3})
+
+		matches, err := filepath.Glob(filepath.Join(tempdir, listedArtist, "scraps", "*.104.html"))
+		assert.NilError(t, err)
+		assert.Equal(t, len(matches), 1)
+
+		record := readJSON[main.SearchRecord](t, filepath.Join(tempdir, "searches", query.Name()+".json"))
+		assert.DeepEqual(t, record.Search, query)
+		assert.Equal(t, len(record.Submissions), 3)
+
+		// Nothing new the second time
+		client := newPagesTestClient(searchPages)
+		scraper = main.NewScraper(NewTestLogger(t), client, "", nil, false, false, tempdir)
+		scraper.SetSearches([]main.SearchQuery{query})
+		err = scraper.Run(t.Context())
+		assert.NilError(t, err)
+		assert.DeepEqual(t, scraper.Summary(), main.RunSummary{})
+		assert.Equal(t, len(client.Posts), 1)
+	})
+
+	t.Run("failed search is recorded and retried", func(t *testing.T) {
+		tempdir := t.TempDir()
+		query := newTestSearchQuery(t, "general")
+		client := NewTestClient()
+		client.SetResponse(searchPage1, nil, errors.New("network error")) //nolint:err113 // dynamic test error
+
+		scraper := main.NewScraper(NewTestLogger(t), client, "", nil, false, false, tempdir)
+		scraper.SetContinueOnError(true)
+		scraper.SetSearches([]main.SearchQuery{query})
+		err := scraper.Run(t.Context())
+		assert.NilError(t, err)
+		assert.Equal(t, scraper.Summary().Failures, 1)
+
+		entries := readJSON[[]main.FailureEntry](t, filepath.Join(tempdir, "failures.json"))
+		assert.Equal(t, len(entries), 1)
+		assert.Equal(t, entries[0].Kind, "search")
+		assert.DeepEqual(t, entries[0].Search, &query)
+
+		scraper = main.NewScraper(NewTestLogger(t), newPagesTestClient(searchPages), "", nil, false, false, tempdir)
+		err = scraper.RetryFailed(t.Context())
+		assert.NilError(t, err)
+		assert.DeepEqual(t, scraper.Summary(), main.RunSummary{Submissions: 3})
+		_, err = os.Stat(filepath.Join(tempdir, "failures.json"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		record := readJSON[main.SearchRecord](t, filepath.Join(tempdir, "searches", query.Name()+".json"))
+		assert.Equal(t, len(record.Submissions), 3)
+	})
+}
@@ -0,0 +1,111 @@
+package main
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// Directory under the output dir where unrecognized pages are saved.
+	diagnosticsDirname = "diagnostics"
+
+	// Longest snippet of a page to include in a SiteLayoutError message.
+	maxLayoutSnippetLength = 200
+)
+
+var (
+	ErrSiteLayoutChanged = errors.New("site layout changed")
+
+	// Characters which aren't safe in a diagnostics filename.
+	diagnosticsFilenameUnsafeRegexp = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+)
+
+// SiteLayoutError is returned when a page from FA doesn't look the way furtrap
+// expects, e.g. a /view/ link with a non-numeric ID or a gallery which never
+// ends.  This almost always means FA has changed its markup.  The page is kept
+// so it can be saved with SaveDiagnosticPage for debugging.
+type SiteLayoutError struct {
+	URL     string // The page which wasn't recognized
+	Reason  string // What was wrong with it
+	Snippet string // The part of the page which caused the problem, if any
+	Page    []byte // The full page
+}
+
+// newSiteLayoutError builds a SiteLayoutError, trimming the snippet to a
+// reasonable length for a log message.
+//
+// Parameters:
+//   - url: The page which wasn't recognized
+//   - page: The full page
+//   - reason: What was wrong with it
+//   - snippet: The part of the page which caused the problem, if any
+//
+// Returns:
+//   - *SiteLayoutError: The error
+func newSiteLayoutError(url string, page []byte, reason string, snippet string) *SiteLayoutError {
+	if len(snippet) > maxLayoutSnippetLength {
+		snippet = snippet[:maxLayoutSnippetLength] + "..."
+	}
+	return &SiteLayoutError{
+		URL:     url,
+		Reason:  reason,
+		Snippet: snippet,
+		Page:    page,
+	}
+}
+
+// Error implements the error interface.
+//
+// Returns:
+//   - string: The error message
+func (e *SiteLayoutError) Error() string {
+	msg := fmt.Sprintf("%s: %s at %s", ErrSiteLayoutChanged, e.Reason, e.URL)
+	if e.Snippet != "" {
+		msg += fmt.Sprintf(": %q", e.Snippet)
+	}
+	return msg
+}
+
+// Unwrap returns ErrSiteLayoutChanged, so callers can use errors.Is.
+//
+// Returns:
+//   - error: ErrSiteLayoutChanged
+func (e *SiteLayoutError) Unwrap() error {
+	return ErrSiteLayoutChanged
+}
+
+// SaveDiagnosticPage writes the page from a SiteLayoutError to the
+// diagnostics directory under outputDir, named after the time and URL.
+//
+// Parameters:
+//   - outputDir: The root of the output tree
+//   - layoutErr: The error holding the page
+//
+// Returns:
+//   - string: The path the page was written to
+//   - error: Any error encountered while writing the page
+func SaveDiagnosticPage(outputDir string, layoutErr *SiteLayoutError) (string, error) {
+	dir := filepath.Join(outputDir, diagnosticsDirname)
+	err := os.MkdirAll(dir, submissionDirPermissions)
+	if err != nil {
+		return "", fmt.Errorf("failed to create diagnostics directory: %w", err)
+	}
+
+	name := strings.TrimPrefix(layoutErr.URL, "https://www.furaffinity.net/")
+	name = strings.Trim(diagnosticsFilenameUnsafeRegexp.ReplaceAllString(name, "_"), "_")
+	filename := time.Now().UTC().Format("20060102T150405.000Z") + "-" + name + ".html"
+
+	path := filepath.Join(dir, filename)
+	err = writeFileAtomic(path, layoutErr.Page)
+	if err != nil {
+		return "", fmt.Errorf("failed to write diagnostic page: %w", err)
+	}
+	return path, nil
+}
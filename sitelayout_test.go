@@ -0,0 +1,92 @@
+package main_test
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	main "furtrap"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// weirdGalleryPage is a gallery page with a /view/ link furtrap can't parse.
+var weirdGalleryPage = []byte(`<a href="/view/not-a-number/"> <img> </a>`)
+
+func TestSaveDiagnosticPage(t *testing.T) {
+	tempdir := t.TempDir()
+	layoutErr := &main.SiteLayoutError{
+		URL:  "https://www.furaffinity.net/gallery/some-artist/1",
+		Page: weirdGalleryPage,
+	}
+
+	path, err := main.SaveDiagnosticPage(tempdir, layoutErr)
+	assert.NilError(t, err)
+	assert.Equal(t, filepath.Dir(path), filepath.Join(tempdir, "diagnostics"))
+	assert.Assert(t, strings.HasSuffix(path, "-gallery_some-artist_1.html"), path)
+
+	//#nosec G304: path is from test data
+	have, err := os.ReadFile(path)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, have, weirdGalleryPage)
+}
+
+func TestScraper_SiteLayoutErrors(t *testing.T) {
+	const goodArtist = "artist-with-two-submissions"
+
+	t.Run("artist with an unrecognized page is skipped", func(t *testing.T) {
+		tempdir := t.TempDir()
+		client := NewTestClient()
+		client.SetResponse("https://www.furaffinity.net/gallery/weird-artist/1", weirdGalleryPage, nil)
+
+		scraper := main.NewScraper(NewTestLogger(t), client, "",
+			[]string{"weird-artist", goodArtist}, false, false, tempdir)
+		err := scraper.Run(t.Context())
+		assert.NilError(t, err)
+		assert.DeepEqual(t, scraper.Summary(), main.RunSummary{
+			ArtistsTotal:     2,
+			ArtistsCompleted: 1,
+			ArtistsSkipped:   1,
+			Submissions:      4,
+		})
+
+		files, err := os.ReadDir(filepath.Join(tempdir, "diagnostics"))
+		assert.NilError(t, err)
+		assert.Equal(t, len(files), 1)
+	})
+
+	t.Run("skipped artist is recorded in continue-on-error mode", func(t *testing.T) {
+		tempdir := t.TempDir()
+		client := NewTestClient()
+		client.SetResponse("https://www.furaffinity.net/gallery/weird-artist/1", weirdGalleryPage, nil)
+
+		scraper := main.NewScraper(NewTestLogger(t), client, "", []string{"weird-artist"}, false, false, tempdir)
+		scraper.SetContinueOnError(true)
+		err := scraper.Run(t.Context())
+		assert.NilError(t, err)
+
+		entries := readJSON[[]main.FailureEntry](t, filepath.Join(tempdir, "failures.json"))
+		assert.Equal(t, len(entries), 1)
+		assert.Equal(t, entries[0].Artist, "weird-artist")
+	})
+
+	t.Run("several in a row stop the run", func(t *testing.T) {
+		tempdir := t.TempDir()
+		client := NewTestClient()
+		artists := []string{"weird-1", "weird-2", "weird-3", goodArtist}
+		for _, artist := range artists[:3] {
+			client.SetResponse("https://www.furaffinity.net/gallery/"+artist+"/1", weirdGalleryPage, nil)
+		}
+
+		scraper := main.NewScraper(NewTestLogger(t), client, "", artists, false, false, tempdir)
+		err := scraper.Run(t.Context())
+		assert.ErrorIs(t, err, main.ErrSiteLayoutChanged)
+		assert.DeepEqual(t, scraper.Summary(), main.RunSummary{ArtistsTotal: 4, ArtistsSkipped: 2})
+
+		files, err := os.ReadDir(filepath.Join(tempdir, "diagnostics"))
+		assert.NilError(t, err)
+		assert.Equal(t, len(files), 3)
+	})
+}
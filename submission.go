@@ -4,8 +4,11 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
 	"os"
 	"path/filepath"
@@ -34,6 +37,7 @@ type Submission struct {
 	client        Client
 	id            uint64
 	submissionDir string
+	index         *ArchiveIndex
 }
 
 // NewSubmission creates a new Submission instance for the specified logger,
@@ -57,6 +61,16 @@ func NewSubmission(logger *slog.Logger, client Client, id uint64, submissionDir
 	}
 }
 
+// SetIndex attaches an archive index.  When set, IsSaved consults the index
+// instead of globbing the submission directory, and saved submissions are
+// recorded in it.
+//
+// Parameters:
+//   - index: The archive index for the output directory
+func (s *Submission) SetIndex(index *ArchiveIndex) {
+	s.index = index
+}
+
 // ID returns the FurAffinity submission ID for this submission.
 //
 // Returns:
@@ -65,30 +79,75 @@ func (s *Submission) ID() uint64 {
 	return s.id
 }
 
-// Save downloads and saves the submission file and associated HTML /view/ page.
-// If the submission has already been saved (determined by the presence of the
-// HTML metadata file), this method returns early without re-downloading.
+// Dir returns the directory this submission is saved in.
+//
+// Returns:
+//   - string: The submission directory
+func (s *Submission) Dir() string {
+	return s.submissionDir
+}
+
+// URL returns the address of this submission's /view/ page.
+//
+// Returns:
+//   - string: The view page URL
+func (s *Submission) URL() string {
+	return viewPageURL(s.id)
+}
+
+// viewPageURL returns the address of a submission's /view/ page.
+//
+// Parameters:
+//   - id: The FurAffinity submission ID
+//
+// Returns:
+//   - string: The view page URL
+func viewPageURL(id uint64) string {
+	return fmt.Sprintf("https://www.furaffinity.net/view/%d", id)
+}
+
+// Save downloads and saves the submission file, its metadata sidecar, and the
+// associated HTML /view/ page.  If the submission has already been saved
+// (according to IsSaved, which checks the archive index if one is attached),
+// this method returns early without re-downloading.
+//
+// Parameters:
+//   - ctx: Context for cancellation
 //
 // Returns:
 //   - error: Any error encountered during the download or save process, nil on success
-func (s *Submission) Save() error {
+func (s *Submission) Save(ctx context.Context) error {
 	// We don't need to do anything if it's already saved
 	if s.IsSaved() {
 		s.logger.Debug("Submission already saved, skipping", "id", s.id)
 		return nil
 	}
 
-	// Ensure target directory exists
-	err := os.MkdirAll(s.submissionDir, submissionDirPermissions)
+	// Get the submission page
+	pageContent, err := s.client.GetWithDelay(ctx, s.URL())
 	if err != nil {
-		return fmt.Errorf("failed to create target directory: %w", err)
+		return fmt.Errorf("failed to get submission page: %w", err)
 	}
 
-	// Get the submission page
-	submissionURL := fmt.Sprintf("https://www.furaffinity.net/view/%d", s.id)
-	pageContent, err := s.client.GetWithDelay(submissionURL)
+	return s.SaveFromViewPage(ctx, pageContent)
+}
+
+// SaveFromViewPage does the work of Save once the /view/ page has been
+// fetched.  This is used directly when the page has already been fetched for
+// some other reason, e.g. to find out which artist a submission belongs to.
+// Unlike Save, it doesn't check IsSaved.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - pageContent: The submission's /view/ page
+//
+// Returns:
+//   - error: Any error encountered during the download or save process, nil on success
+func (s *Submission) SaveFromViewPage(ctx context.Context, pageContent []byte) error {
+	// Ensure target directory exists
+	err := os.MkdirAll(s.submissionDir, submissionDirPermissions)
 	if err != nil {
-		return fmt.Errorf("failed to get submission page: %w", err)
+		return fmt.Errorf("failed to create target directory: %w", err)
 	}
 
 	// Parse HTML with goquery
@@ -97,8 +156,11 @@ func (s *Submission) Save() error {
 		return err
 	}
 
-	// Download the actual file
-	fileContent, err := s.client.Get(downloadURL)
+	// Download the actual file.  It's only renamed to its final path once
+	// it's complete, and the HTML marker isn't written until afterwards.  A
+	// partial file left by an interruption is resumed on the next attempt.
+	filePath := filepath.Join(s.submissionDir, filename)
+	err = s.client.Download(ctx, downloadURL, filePath)
 	switch {
 	case err == nil:
 		// continue
@@ -108,12 +170,14 @@ func (s *Submission) Save() error {
 		// picked up on a re-crawl.
 		s.logger.Warn("File download 404s, skipping submission", "id", s.id, "url", downloadURL)
 		return nil
+	case errors.Is(err, ErrDownloadWrite):
+		return fmt.Errorf("failed to save file: %w", err)
 	default:
 		return fmt.Errorf("failed to download file: %w", err)
 	}
 
-	// Save both the file and the HTML page
-	return s.saveSubmissionFiles(filename, fileContent, pageContent)
+	// Save the metadata and HTML page
+	return s.saveSubmissionFiles(filename, pageContent)
 }
 
 // parseURLAndFilenameFromViewPage extracts the download URL and filename from a
@@ -233,6 +297,7 @@ func WriteAndFsyncFile(filePath string, data []byte) error {
 // IsSaved checks whether this submission has already been saved to disk by
 // looking for the presence of the associated HTML /view/ file. The HTML file
 // serves as a marker that indicates successful completion of the download.
+// If an archive index is attached, it is consulted instead.
 //
 // The method uses a glob pattern to match the expected HTML filename format:
 // "<original_filename>.<submission_id>.html"
@@ -240,6 +305,10 @@ func WriteAndFsyncFile(filePath string, data []byte) error {
 // Returns:
 //   - bool: true if the submission has been saved (HTML metadata file exists), false otherwise
 func (s *Submission) IsSaved() bool {
+	if s.index != nil {
+		return s.index.Contains(s.submissionDir, s.id)
+	}
+
 	filenameGlob := fmt.Sprintf("*.%d.html", s.id)
 	pathGlob := filepath.Join(s.submissionDir, filenameGlob)
 
@@ -254,46 +323,169 @@ func (s *Submission) IsSaved() bool {
 	return len(matches) > 0
 }
 
-// saveSubmissionFiles saves the downloaded submission file and the HTML /view/
-// page to disk. The HTML page is saved only after the file is successfully
-// written to ensure the submission can be retried if interrupted.
+// saveSubmissionFiles completes saving a submission whose file has already
+// been downloaded and fsynced by Client.Download.  It writes the metadata and
+// comments JSON sidecars and the HTML /view/ page to disk, then records the
+// submission in the archive index if there is one. The HTML page is saved only
+// after everything else is successfully written to ensure the submission can
+// be retried if interrupted.
 //
 // Parameters:
 //   - filename: The original filename of the downloaded submission file
-//   - fileContent: The byte content of the downloaded submission file
 //   - pageContent: The byte content of the HTML /view/ page
 //
 // Returns:
 //   - error: Any error encountered during the save process
-func (s *Submission) saveSubmissionFiles(filename string, fileContent []byte, pageContent []byte) error {
-	// Save the downloaded file
+func (s *Submission) saveSubmissionFiles(filename string, pageContent []byte) error {
 	filePath := filepath.Join(s.submissionDir, filename)
-	err := WriteAndFsyncFile(filePath, fileContent)
+
+	// Save the metadata sidecar.  A page we can't extract metadata from
+	// shouldn't cost us the download, so this only warns on parse failures.
+	// The sidecar can be regenerated later with backfill-metadata.
+	metadata, err := parseSubmissionMetadata(pageContent, s.id)
 	if err != nil {
-		return fmt.Errorf("failed to save file: %w", err)
+		s.logger.Warn("Failed to parse submission metadata, skipping sidecar", "id", s.id, "error", err)
+	} else {
+		err = s.saveMetadata(filename, metadata)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Likewise the comments sidecar, which refresh-comments can recreate.
+	_, err = saveComments(s.submissionDir, filename, s.id, pageContent)
+	if err != nil {
+		s.logger.Warn("Failed to save submission comments", "id", s.id, "error", err)
 	}
 
 	// Save the HTML page only after saving the file.  This ensures the
 	// submission will be retried if we get interrupted.
 	htmlFilename := fmt.Sprintf("%s.%d.html", filename, s.id)
 	htmlPath := filepath.Join(s.submissionDir, htmlFilename)
+	err = writeFileAtomic(htmlPath, pageContent)
+	if err != nil {
+		return fmt.Errorf("failed to save HTML page: %w", err)
+	}
+
+	if s.index != nil {
+		err = s.index.Record(s.submissionDir, filename, s.id)
+		if err != nil {
+			return fmt.Errorf("failed to update archive index: %w", err)
+		}
+	}
 
-	// The filename is fixed so that if we are interrupted, it will be
-	// overwritten on the next run.
-	htmlTempfile := htmlPath + ".tmp"
+	s.logger.Info("Saved submission", "id", s.id, "file", filePath)
+	return nil
+}
+
+// saveMetadata writes the metadata JSON sidecar for this submission, named
+// "<original_filename>.<submission_id>.json".
+//
+// Parameters:
+//   - filename: The original filename of the downloaded submission file
+//   - metadata: The metadata extracted from the /view/ page
+//
+// Returns:
+//   - error: Any error encountered while encoding or writing the sidecar
+func (s *Submission) saveMetadata(filename string, metadata *SubmissionMetadata) error {
+	jsonPath := filepath.Join(s.submissionDir, metadataFilename(filename, s.id))
+	err := writeJSONFileAtomic(jsonPath, metadata)
+	if err != nil {
+		return fmt.Errorf("failed to save metadata: %w", err)
+	}
+	return nil
+}
+
+// metadataFilename returns the name of the metadata JSON sidecar for a
+// submission: "<original_filename>.<submission_id>.json".
+//
+// Parameters:
+//   - filename: The original filename of the submission file
+//   - id: The FurAffinity submission ID
+//
+// Returns:
+//   - string: The sidecar filename
+func metadataFilename(filename string, id uint64) string {
+	return fmt.Sprintf("%s.%d.json", filename, id)
+}
+
+// readJSONFile decodes a JSON file into v.  A file which doesn't exist isn't
+// an error, since most of what we record starts out empty, so v is left as
+// it was.
+//
+// Parameters:
+//   - filePath: The file to read
+//   - v: Where to decode it
+//
+// Returns:
+//   - bool: true if the file exists
+//   - error: Any error reading or parsing the file
+func readJSONFile(filePath string, v any) (bool, error) {
+	//#nosec G304: paths are built from the output dir
+	data, err := os.ReadFile(filePath)
+	switch {
+	case err == nil:
+		// continue
+	case errors.Is(err, fs.ErrNotExist):
+		return false, nil
+	default:
+		return false, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse %s: %w", filePath, err)
+	}
+	return true, nil
+}
+
+// writeJSONFileAtomic encodes v as indented JSON and writes it atomically with
+// writeFileAtomic.
+//
+// Parameters:
+//   - filePath: The final path of the file
+//   - v: The value to encode
+//
+// Returns:
+//   - error: Any error encountered while encoding or writing the file
+func writeJSONFileAtomic(filePath string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	data = append(data, '\n')
+
+	return writeFileAtomic(filePath, data)
+}
+
+// writeFileAtomic writes data to a temp file next to filePath, fsyncs it, then
+// renames it into place.  Readers will see either the old file or the complete
+// new one, never a partial write.
+//
+// The temp file is removed if anything fails.  Its name is fixed so that if
+// we are killed outright, it will be overwritten on the next run.
+//
+// Parameters:
+//   - filePath: The final path of the file
+//   - data: The byte data to write to the file
+//
+// Returns:
+//   - error: Any error encountered while writing or renaming the file
+func writeFileAtomic(filePath string, data []byte) error {
+	tempfile := filePath + ".tmp"
 
 	// Write to a temp file first
-	err = WriteAndFsyncFile(htmlTempfile, pageContent)
+	err := WriteAndFsyncFile(tempfile, data)
 	if err != nil {
-		return fmt.Errorf("failed to save HTML page: %w", err)
+		_ = os.Remove(tempfile)
+		return err
 	}
 
 	// Rename to final filename
-	err = os.Rename(htmlTempfile, htmlPath)
+	err = os.Rename(tempfile, filePath)
 	if err != nil {
-		return fmt.Errorf("failed to finalize HTML page save: %w", err)
+		_ = os.Remove(tempfile)
+		return fmt.Errorf("failed to rename temp file: %w", err)
 	}
-
-	s.logger.Info("Saved submission", "id", s.id, "file", filePath)
 	return nil
 }
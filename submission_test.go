@@ -29,7 +29,7 @@ func TestSubmission_Save(t *testing.T) {
 	t.Run("Save a submission", func(t *testing.T) {
 		submissionDir := t.TempDir()
 		submission := main.NewSubmission(NewTestLogger(t), client, 101, submissionDir)
-		err := submission.Save()
+		err := submission.Save(t.Context())
 		assert.NilError(t, err)
 
 		// The page should be saved
@@ -38,7 +38,7 @@ func TestSubmission_Save(t *testing.T) {
 		//#nosec G304 - filename is from test data
 		savedPageContent, err := os.ReadFile(savedPageFN)
 		assert.NilError(t, err)
-		savedPageWant, err := client.Get("https://www.furaffinity.net/view/101")
+		savedPageWant, err := client.Get(t.Context(), "https://www.furaffinity.net/view/101")
 		assert.NilError(t, err)
 		assert.DeepEqual(t, savedPageWant, savedPageContent)
 
@@ -59,7 +59,7 @@ func TestSubmission_Save(t *testing.T) {
 		)
 
 		submission := main.NewSubmission(NewTestLogger(t), client, 12345, t.TempDir())
-		err := submission.Save()
+		err := submission.Save(t.Context())
 		assert.ErrorContains(t, err, "failed to get submission page")
 		assert.ErrorContains(t, err, "network error")
 	})
@@ -72,7 +72,7 @@ func TestSubmission_Save(t *testing.T) {
 		)
 
 		submission := main.NewSubmission(NewTestLogger(t), client, 12345, t.TempDir())
-		err := submission.Save()
+		err := submission.Save(t.Context())
 		assert.Equal(t, err, main.ErrSubmissionImageNotFound)
 	})
 
@@ -84,7 +84,7 @@ func TestSubmission_Save(t *testing.T) {
 		)
 
 		submission := main.NewSubmission(NewTestLogger(t), client, 12345, t.TempDir())
-		err := submission.Save()
+		err := submission.Save(t.Context())
 		assert.Equal(t, err, main.ErrSubmissionImageNotFound)
 	})
 
@@ -113,7 +113,7 @@ func TestSubmission_Save(t *testing.T) {
 					nil)
 
 				submission := main.NewSubmission(NewTestLogger(t), client, 12345, t.TempDir())
-				err := submission.Save()
+				err := submission.Save(t.Context())
 				if tt.want != nil {
 					assert.ErrorContains(t, err, tt.want.Error(), "expected error for URI: %s", tt.uri)
 				} else {
@@ -139,7 +139,7 @@ func TestSubmission_Save(t *testing.T) {
 
 		submissionDir := t.TempDir()
 		submission := main.NewSubmission(NewTestLogger(t), client, 99999, submissionDir)
-		err := submission.Save()
+		err := submission.Save(t.Context())
 		assert.NilError(t, err)
 
 		// The filename should have illegal characters replaced with underscores
@@ -165,7 +165,7 @@ func TestSubmission_Save(t *testing.T) {
 		)
 
 		submission := main.NewSubmission(NewTestLogger(t), client, 12345, t.TempDir())
-		err := submission.Save()
+		err := submission.Save(t.Context())
 		assert.ErrorContains(t, err, "failed to download file")
 		assert.ErrorContains(t, err, "download failed")
 	})
@@ -182,7 +182,7 @@ func TestSubmission_Save(t *testing.T) {
 		// This should fail because blockingFile is a file, not a directory
 		artistDir := filepath.Join(blockingFile, "testartist")
 		submission := main.NewSubmission(NewTestLogger(t), client, 12345, artistDir)
-		err = submission.Save()
+		err = submission.Save(t.Context())
 		assert.ErrorContains(t, err, "failed to create target directory")
 	})
 
@@ -197,7 +197,7 @@ func TestSubmission_Save(t *testing.T) {
 		assert.NilError(t, err)
 
 		submission := main.NewSubmission(NewTestLogger(t), client, 101, artistDir)
-		err = submission.Save()
+		err = submission.Save(t.Context())
 		assert.ErrorContains(t, err, "failed to save file")
 	})
 
@@ -212,7 +212,7 @@ func TestSubmission_Save(t *testing.T) {
 		assert.NilError(t, err)
 
 		submission := main.NewSubmission(NewTestLogger(t), client, 101, artistDir)
-		err = submission.Save()
+		err = submission.Save(t.Context())
 		assert.ErrorContains(t, err, "failed to save file")
 	})
 
@@ -235,7 +235,7 @@ func TestSubmission_Save(t *testing.T) {
 		assert.NilError(t, err)
 
 		// Run Save() - should be a no-op since files exist
-		err = submission.Save()
+		err = submission.Save(t.Context())
 		assert.NilError(t, err)
 
 		// Verify timestamps haven't changed
@@ -265,7 +265,7 @@ func TestSubmission_Save(t *testing.T) {
 		tempdir := t.TempDir()
 
 		submission := main.NewSubmission(NewTestLogger(t), client, 54321, tempdir)
-		err := submission.Save()
+		err := submission.Save(t.Context())
 		assert.NilError(t, err)
 
 		// Verify that no files were created
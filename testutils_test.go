@@ -3,15 +3,21 @@ package main_test
 // SPDX-License-Identifier: GPL-3.0-only
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	main "furtrap"
 	"log/slog"
+	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"testing"
+
+	"gotest.tools/v3/assert"
 )
 
 var (
@@ -29,7 +35,8 @@ type TestResponse struct {
 // responses for specific URIs, and falls back to reading from sample_data if no
 // response is set.
 type TestClient struct {
-	uris map[string]TestResponse
+	uris  map[string]TestResponse
+	Posts []url.Values // Forms posted with PostWithDelay
 }
 
 // NewTestClient creates a new TestClient instance with an empty set of
@@ -61,12 +68,18 @@ func (t *TestClient) SetResponse(uri string, response []byte, err error) {
 // ErrHTTPNotFound.
 //
 // Parameters:
+//   - ctx: Context for cancellation.  A canceled context returns its error.
 //   - uri: The URI to request
 //
 // Returns:
 //   - []byte: The response data
 //   - error: An error if the request fails
-func (t *TestClient) Get(uri string) ([]byte, error) {
+func (t *TestClient) Get(ctx context.Context, uri string) ([]byte, error) {
+	err := ctx.Err()
+	if err != nil {
+		return nil, fmt.Errorf("GET canceled: %w", err)
+	}
+
 	if response, ok := t.uris[uri]; ok {
 		return response.data, response.error
 	}
@@ -94,13 +107,56 @@ func (t *TestClient) Get(uri string) ([]byte, error) {
 // the Client interface.  Delays are not simulated in the test client.
 //
 // Parameters:
+//   - ctx: Context for cancellation
 //   - uri: The URI to request
 //
 // Returns:
 //   - []byte: The response data
 //   - error: An error if the request fails
-func (t *TestClient) GetWithDelay(uri string) ([]byte, error) {
-	return t.Get(uri)
+func (t *TestClient) GetWithDelay(ctx context.Context, uri string) ([]byte, error) {
+	return t.Get(ctx, uri)
+}
+
+// PostWithDelay simulates a form POST.  Every form is paginated, so the
+// response is looked up like a GET with the page number as the query string,
+// e.g. "https://www.furaffinity.net/search/?page=2".  The forms are recorded
+// in Posts.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - uri: The URI to post to
+//   - form: The form fields
+//
+// Returns:
+//   - []byte: The response data
+//   - error: An error if the request fails
+func (t *TestClient) PostWithDelay(ctx context.Context, uri string, form url.Values) ([]byte, error) {
+	t.Posts = append(t.Posts, form)
+	return t.Get(ctx, uri+"?page="+form.Get("page"))
+}
+
+// Download simulates Client.Download by writing the response from Get to
+// filePath.  Write failures are reported wrapping ErrDownloadWrite, like the
+// real client.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - uri: The URI to request
+//   - filePath: Where to write the response data
+//
+// Returns:
+//   - error: An error if the request or write fails
+func (t *TestClient) Download(ctx context.Context, uri string, filePath string) error {
+	data, err := t.Get(ctx, uri)
+	if err != nil {
+		return err
+	}
+
+	err = main.WriteAndFsyncFile(filePath, data)
+	if err != nil {
+		return fmt.Errorf("%w: %w", main.ErrDownloadWrite, err)
+	}
+	return nil
 }
 
 // TestLogForwarder is an io.Writer that forwards log output to testing.T.Logf.
@@ -154,25 +210,67 @@ func NewTestLogger(t *testing.T) *slog.Logger {
 	return slog.New(handler)
 }
 
-// CapturePanic executes the provided function and captures any panic that
-// occurs.  It returns the recovered panic value, or nil if no panic occurred.
+// listedArtist is the artist of every submission on a page built by
+// listingPage.  It's one of the sample artists, so the submissions can be
+// saved.
+const listedArtist = "artist-with-two-submissions"
+
+// listingPage builds a page listing other artists' work, like favorites,
+// search results or the submission inbox.  It has a section of thumbnail
+// figures, one for each submission, all by listedArtist, followed by the
+// page's paging controls.
 //
 // Parameters:
-//   - t: The testing.T instance
-//   - fn: The function to execute
+//   - section: Attributes of the section holding the figures, which is what
+//     tells the kinds of page apart, e.g. "id='search-results'"
+//   - paging: HTML for the paging links or buttons
+//   - ids: The submissions to list
 //
 // Returns:
-//   - any: The recovered panic value, or nil if no panic occurred
-func CapturePanic(t *testing.T, fn func()) any {
-	t.Helper()
-	var ret any
+//   - []byte: The page
+func listingPage(section string, paging string, ids ...uint64) []byte {
+	page := "<html><body><section " + section + ">"
+	for _, id := range ids {
+		page += "<figure id='sid-" + strconv.FormatUint(id, 10) + "'>" +
+			"<b><a href='/view/" + strconv.FormatUint(id, 10) + "/'>img</a></b>" +
+			"<figcaption><p><a href='/user/" + listedArtist + "/'>" + listedArtist + "</a></p></figcaption>" +
+			"</figure>"
+	}
+	return []byte(page + "</section>" + paging + "</body></html>")
+}
+
+// newPagesTestClient creates a TestClient with a predefined response for each
+// of the given pages.
+//
+// Parameters:
+//   - pages: The response for each URI
+//
+// Returns:
+//   - *TestClient: The client
+func newPagesTestClient(pages map[string][]byte) *TestClient {
+	client := NewTestClient()
+	for uri, page := range pages {
+		client.SetResponse(uri, page, nil)
+	}
+	return client
+}
 
-	func() {
-		defer func() {
-			ret = recover()
-		}()
-		fn()
-	}()
+// readJSON reads and decodes a JSON file, failing the test if it can't.
+//
+// Parameters:
+//   - t: The test
+//   - path: The file to read
+//
+// Returns:
+//   - T: The decoded file
+func readJSON[T any](t *testing.T, path string) T {
+	t.Helper()
+	//#nosec G304: path is from test data
+	data, err := os.ReadFile(path)
+	assert.NilError(t, err)
 
-	return ret
+	var v T
+	err = json.Unmarshal(data, &v)
+	assert.NilError(t, err)
+	return v
 }
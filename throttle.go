@@ -0,0 +1,134 @@
+package main
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// Default throttle policy.  FA asks bots to "limit bot activity to
+	// periods with less than 10k registered users online", so above that we
+	// back off for a good while.  Even during low traffic, we add a small
+	// delay to be kind to the server.
+	defaultThrottleThreshold = 10000
+	defaultThrottleMinDelay  = 1 * time.Second
+	defaultThrottleHighDelay = 5 * time.Minute
+)
+
+var (
+	ErrInvalidThrottle        = errors.New("invalid throttle policy")
+	ErrThrottleBudgetExceeded = errors.New("throttle budget exceeded, FA has been busy too long")
+)
+
+// ThrottlePolicy controls how long HTTPClient waits after each page fetched
+// with GetWithDelay or PostWithDelay, depending on how many registered users
+// the page says are online.
+type ThrottlePolicy struct {
+	// Registered users online above which we wait HighDelay.  0 disables load
+	// throttling, leaving only MinDelay.
+	Threshold int
+	// Delay after every page, however quiet FA is.
+	MinDelay time.Duration
+	// Delay when over the threshold.
+	HighDelay time.Duration
+	// Registered users online above which the delay starts scaling up, in a
+	// straight line from MinDelay to HighDelay at the threshold.  0 for no
+	// scaling, just MinDelay until the threshold.
+	ScaleFrom int
+	// Most time to spend waiting on load in one run, after which the run
+	// stops.  MinDelay doesn't count against it.  0 for no limit.
+	Budget time.Duration
+}
+
+// DefaultThrottlePolicy returns the throttle policy used in prod.
+//
+// Returns:
+//   - ThrottlePolicy: The default policy
+func DefaultThrottlePolicy() ThrottlePolicy {
+	return ThrottlePolicy{
+		Threshold: defaultThrottleThreshold,
+		MinDelay:  defaultThrottleMinDelay,
+		HighDelay: defaultThrottleHighDelay,
+	}
+}
+
+// Validate checks the policy makes sense.
+//
+// Returns:
+//   - error: ErrInvalidThrottle describing the first problem, nil if it's valid
+func (p ThrottlePolicy) Validate() error {
+	switch {
+	case p.Threshold < 0 || p.ScaleFrom < 0:
+		return fmt.Errorf("%w: user counts can't be negative", ErrInvalidThrottle)
+	case p.MinDelay < 0 || p.Budget < 0:
+		return fmt.Errorf("%w: durations can't be negative", ErrInvalidThrottle)
+	case p.HighDelay < p.MinDelay:
+		return fmt.Errorf("%w: high delay %s is less than the minimum delay %s", ErrInvalidThrottle,
+			p.HighDelay, p.MinDelay)
+	case p.ScaleFrom > 0 && p.ScaleFrom >= p.Threshold:
+		return fmt.Errorf("%w: scaling starts at %d users, not below the threshold of %d", ErrInvalidThrottle,
+			p.ScaleFrom, p.Threshold)
+	}
+	return nil
+}
+
+// Delay returns how long to wait after a page, given the load it reported.
+//
+// Parameters:
+//   - registeredUsers: How many registered users the page says are online
+//
+// Returns:
+//   - time.Duration: How long to wait
+func (p ThrottlePolicy) Delay(registeredUsers int) time.Duration {
+	switch {
+	case p.Threshold <= 0:
+		return p.MinDelay
+	case registeredUsers > p.Threshold:
+		return p.HighDelay
+	case p.ScaleFrom <= 0 || registeredUsers <= p.ScaleFrom:
+		return p.MinDelay
+	}
+
+	fraction := float64(registeredUsers-p.ScaleFrom) / float64(p.Threshold-p.ScaleFrom)
+	return p.MinDelay + time.Duration(fraction*float64(p.HighDelay-p.MinDelay))
+}
+
+// SetThrottlePolicy configures how long to wait after each page, depending on
+// the load on FA.
+//
+// Parameters:
+//   - policy: The throttle policy to use
+func (h *HTTPClient) SetThrottlePolicy(policy ThrottlePolicy) {
+	h.throttlePolicy = policy
+}
+
+// throttle is the default delay function.  It waits as long as the throttle
+// policy says, and keeps count of the time spent waiting on load against the
+// policy's budget.
+//
+// Parameters:
+//   - ctx: Context for cancellation of the delay
+//   - registeredUsers: How many registered users the last page said are online
+//
+// Returns:
+//   - error: ErrThrottleBudgetExceeded if waiting would go over budget, or the
+//     context's error if canceled
+func (h *HTTPClient) throttle(ctx context.Context, registeredUsers int) error {
+	policy := h.throttlePolicy
+	delay := policy.Delay(registeredUsers)
+
+	loadDelay := delay - policy.MinDelay
+	if loadDelay > 0 {
+		if policy.Budget > 0 && h.throttled+loadDelay > policy.Budget {
+			return fmt.Errorf("%w: already waited %s of %s, %d registered users online",
+				ErrThrottleBudgetExceeded, h.throttled, policy.Budget, registeredUsers)
+		}
+		h.logger.Info("High registered user count detected, delaying", "count", registeredUsers, "delay", delay)
+		h.throttled += loadDelay
+	}
+	return sleepContext(ctx, delay)
+}
@@ -0,0 +1,83 @@
+package main_test
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	main "furtrap"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestThrottlePolicy_Delay(t *testing.T) {
+	scaling := main.ThrottlePolicy{
+		Threshold: 10000,
+		MinDelay:  time.Second,
+		HighDelay: 101 * time.Second,
+		ScaleFrom: 8000,
+	}
+
+	tests := []struct {
+		name   string
+		policy main.ThrottlePolicy
+		users  int
+		want   time.Duration
+	}{
+		{"default, quiet", main.DefaultThrottlePolicy(), 5000, time.Second},
+		{"default, at the threshold", main.DefaultThrottlePolicy(), 10000, time.Second},
+		{"default, busy", main.DefaultThrottlePolicy(), 10001, 5 * time.Minute},
+		{"scaling, below", scaling, 8000, time.Second},
+		{"scaling, halfway", scaling, 9000, 51 * time.Second},
+		{"scaling, at the threshold", scaling, 10000, 101 * time.Second},
+		{"scaling, busy", scaling, 20000, 101 * time.Second},
+		{"disabled", main.ThrottlePolicy{MinDelay: time.Second, HighDelay: time.Hour}, 20000, time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.policy.Delay(tt.users), tt.want)
+		})
+	}
+}
+
+func TestThrottlePolicy_Validate(t *testing.T) {
+	assert.NilError(t, main.DefaultThrottlePolicy().Validate())
+
+	invalid := []main.ThrottlePolicy{
+		{Threshold: -1},
+		{MinDelay: time.Minute, HighDelay: time.Second},
+		{Threshold: 10000, ScaleFrom: 10000, HighDelay: time.Minute},
+		{Budget: -time.Hour},
+	}
+	for _, policy := range invalid {
+		assert.ErrorIs(t, policy.Validate(), main.ErrInvalidThrottle)
+	}
+}
+
+func TestHTTPClient_ThrottleBudget(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(SampleDataHandler))
+	defer server.Close()
+
+	// /view/103 reports more registered users than the threshold, so each
+	// page costs 20ms of the 50ms budget.  /view/104 reports fewer.
+	client := main.NewHTTPClient(NewTestLogger(t))
+	client.SetThrottlePolicy(main.ThrottlePolicy{
+		Threshold: 14000,
+		HighDelay: 20 * time.Millisecond,
+		Budget:    50 * time.Millisecond,
+	})
+
+	for range 2 {
+		_, err := client.GetWithDelay(t.Context(), server.URL+"/view/103")
+		assert.NilError(t, err)
+	}
+	_, err := client.GetWithDelay(t.Context(), server.URL+"/view/103")
+	assert.ErrorIs(t, err, main.ErrThrottleBudgetExceeded)
+
+	// Quiet pages don't count against it.
+	_, err = client.GetWithDelay(t.Context(), server.URL+"/view/104")
+	assert.NilError(t, err)
+}
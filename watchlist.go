@@ -0,0 +1,243 @@
+package main
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+const (
+	// Directory under the output dir where watchlists are recorded.
+	watchlistsDirname = "watchlists"
+
+	// Name of the marker written in the directory of an artist who has been
+	// removed from the watchlist.
+	unwatchedMarkerFilename = "unwatched.json"
+
+	// Largest fraction of the watchlist which can disappear in one run
+	// without SetAllowMassRemoval.  Losing more than this is far more
+	// likely to be a login or layout problem than a real change.
+	maxUnwatchedFraction = 0.5
+)
+
+var ErrMassUnwatch = errors.New("watchlist lost too many artists")
+
+// WatchlistRecord is the record of a user's watchlist saved in the
+// watchlists directory.  It's what lets each run tell who has been watched or
+// unwatched since the last one.
+type WatchlistRecord struct {
+	Watcher   string               `json:"watcher"`
+	UpdatedAt time.Time            `json:"updated_at"`
+	Artists   []string             `json:"artists"`             // As of the last run, in watchlist order
+	Unwatched map[string]time.Time `json:"unwatched,omitempty"` // Removed artists, and when they were first missing
+	Changes   []WatchlistChange    `json:"changes,omitempty"`   // Every change seen, oldest first
+}
+
+// WatchlistChange is the difference between two runs' watchlists.
+type WatchlistChange struct {
+	At      time.Time `json:"at"`
+	Added   []string  `json:"added,omitempty"`
+	Removed []string  `json:"removed,omitempty"`
+}
+
+// UnwatchedMarker is written to an artist's directory as unwatched.json once
+// they're no longer on the watchlist, and removed if they come back.
+type UnwatchedMarker struct {
+	Watcher string    `json:"watcher"`
+	Since   time.Time `json:"since"` // When they were first missing
+}
+
+// Watchlist keeps the record of a user's watchlist between runs.  Fetching
+// the watchlist itself is GetWatchlist's job.
+type Watchlist struct {
+	watcher          string
+	outputDir        string
+	allowMassRemoval bool
+}
+
+// NewWatchlist creates a new Watchlist instance for the specified user.
+//
+// Parameters:
+//   - watcher: The FurAffinity username whose watchlist is recorded
+//   - outputDir: The root of the output tree
+//
+// Returns:
+//   - *Watchlist: A new Watchlist instance ready for use
+func NewWatchlist(watcher string, outputDir string) *Watchlist {
+	return &Watchlist{
+		watcher:   watcher,
+		outputDir: outputDir,
+	}
+}
+
+// SetAllowMassRemoval allows Update to record a watchlist which has lost
+// everyone, or more than maxUnwatchedFraction of the artists, since the last
+// run.  By default such a watchlist is refused, since it's more likely FA
+// served an empty or broken page than that the user unwatched everybody.
+//
+// Parameters:
+//   - allow: Whether to record it anyway
+func (w *Watchlist) SetAllowMassRemoval(allow bool) {
+	w.allowMassRemoval = allow
+}
+
+// Path returns where the watchlist is recorded.
+//
+// Returns:
+//   - string: The path of the watchlist record JSON file
+func (w *Watchlist) Path() string {
+	return filepath.Join(w.outputDir, watchlistsDirname, w.watcher+".json")
+}
+
+// Load reads the previously recorded watchlist.  A watchlist which hasn't
+// been recorded yet is returned empty.
+//
+// Returns:
+//   - *WatchlistRecord: The recorded watchlist
+//   - error: Any error reading or parsing the record
+func (w *Watchlist) Load() (*WatchlistRecord, error) {
+	record := &WatchlistRecord{Watcher: w.watcher}
+
+	_, err := readJSONFile(w.Path(), record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load watchlist record: %w", err)
+	}
+
+	if record.Unwatched == nil {
+		record.Unwatched = make(map[string]time.Time)
+	}
+	return record, nil
+}
+
+// Update records the watchlist just fetched, and works out what has changed
+// since the last time.  The first time a watchlist is recorded there's
+// nothing to compare it with, so the change is empty.  Unwatched artists
+// whose grace period ended before this run are forgotten, so the record
+// doesn't grow forever.
+//
+// Parameters:
+//   - artists: The watchlist, as returned by GetWatchlist
+//   - grace: How long removed artists are still crawled
+//   - now: The current time
+//
+// Returns:
+//   - *WatchlistRecord: The updated record
+//   - WatchlistChange: Who has been added and removed since the last run
+//   - error: ErrMassUnwatch if too many artists have gone, unless allowed by
+//     SetAllowMassRemoval, or any error reading or writing the record
+func (w *Watchlist) Update(artists []string, grace time.Duration, now time.Time,
+) (*WatchlistRecord, WatchlistChange, error) {
+	record, err := w.Load()
+	if err != nil {
+		return nil, WatchlistChange{}, err
+	}
+
+	for artist, since := range record.Unwatched {
+		if now.Sub(since) >= grace {
+			delete(record.Unwatched, artist)
+		}
+	}
+
+	change := WatchlistChange{At: now.UTC()}
+	if !record.UpdatedAt.IsZero() {
+		for _, artist := range artists {
+			if !slices.Contains(record.Artists, artist) {
+				change.Added = append(change.Added, artist)
+			}
+		}
+		for _, artist := range record.Artists {
+			if !slices.Contains(artists, artist) {
+				change.Removed = append(change.Removed, artist)
+				record.Unwatched[artist] = now.UTC()
+			}
+		}
+	}
+	if !w.allowMassRemoval && len(change.Removed) > 0 &&
+		(len(artists) == 0 || float64(len(change.Removed)) > maxUnwatchedFraction*float64(len(record.Artists))) {
+		return nil, WatchlistChange{}, fmt.Errorf("%w: %d of %d artists are missing from %s's watchlist",
+			ErrMassUnwatch, len(change.Removed), len(record.Artists), w.watcher)
+	}
+
+	// Anyone who is back is no longer unwatched, however they got here.
+	for _, artist := range artists {
+		delete(record.Unwatched, artist)
+	}
+	if len(change.Added) > 0 || len(change.Removed) > 0 {
+		record.Changes = append(record.Changes, change)
+	}
+	record.Artists = artists
+	record.UpdatedAt = now.UTC()
+
+	err = os.MkdirAll(filepath.Dir(w.Path()), submissionDirPermissions)
+	if err != nil {
+		return nil, WatchlistChange{}, fmt.Errorf("failed to create watchlists directory: %w", err)
+	}
+	err = writeJSONFileAtomic(w.Path(), record)
+	if err != nil {
+		return nil, WatchlistChange{}, fmt.Errorf("failed to write watchlist record: %w", err)
+	}
+	return record, change, nil
+}
+
+// InGracePeriod returns the unwatched artists who were removed less than
+// grace ago, sorted by name.
+//
+// Parameters:
+//   - grace: How long removed artists are still crawled
+//   - now: The current time
+//
+// Returns:
+//   - []string: The artists still to be crawled
+func (r *WatchlistRecord) InGracePeriod(grace time.Duration, now time.Time) []string {
+	var artists []string
+	for artist, since := range r.Unwatched {
+		if now.Sub(since) < grace {
+			artists = append(artists, artist)
+		}
+	}
+	slices.Sort(artists)
+	return artists
+}
+
+// markUnwatched writes the unwatched marker in an artist's directory.  Artists
+// who have never been downloaded have no directory, and aren't marked.
+//
+// Parameters:
+//   - artistDir: The artist's directory
+//   - marker: The marker contents
+//
+// Returns:
+//   - error: Any error writing the marker
+func markUnwatched(artistDir string, marker UnwatchedMarker) error {
+	_, err := os.Stat(artistDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	err = writeJSONFileAtomic(filepath.Join(artistDir, unwatchedMarkerFilename), marker)
+	if err != nil {
+		return fmt.Errorf("failed to write unwatched marker: %w", err)
+	}
+	return nil
+}
+
+// clearUnwatched removes the unwatched marker from an artist's directory, if
+// there is one.
+//
+// Parameters:
+//   - artistDir: The artist's directory
+//
+// Returns:
+//   - error: Any error removing the marker
+func clearUnwatched(artistDir string) error {
+	err := os.Remove(filepath.Join(artistDir, unwatchedMarkerFilename))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove unwatched marker: %w", err)
+	}
+	return nil
+}
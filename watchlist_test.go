@@ -0,0 +1,144 @@
+package main_test
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	main "furtrap"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+const (
+	watchlistWatcher = "watcher-with-one-artist"
+	watchlistPage1   = "https://www.furaffinity.net/watchlist/by/watcher-with-one-artist/1"
+	watchlistArtist  = "artist-with-two-submissions"
+)
+
+func TestWatchlist_Update(t *testing.T) {
+	watchlist := main.NewWatchlist("watcher", t.TempDir())
+	start := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+	// Nothing to compare the first one with
+	record, change, err := watchlist.Update([]string{"a", "b"}, time.Hour, start)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, change, main.WatchlistChange{At: start})
+	assert.DeepEqual(t, record.Artists, []string{"a", "b"})
+
+	second := start.Add(24 * time.Hour)
+	record, change, err = watchlist.Update([]string{"b", "c"}, time.Hour, second)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, change, main.WatchlistChange{At: second, Added: []string{"c"}, Removed: []string{"a"}})
+	assert.DeepEqual(t, record.Unwatched, map[string]time.Time{"a": second})
+	assert.DeepEqual(t, record.InGracePeriod(time.Hour, second.Add(30*time.Minute)), []string{"a"})
+	assert.Equal(t, len(record.InGracePeriod(time.Hour, second.Add(time.Hour))), 0)
+
+	// Still unwatched a run later, and the change history is kept
+	third := second.Add(30 * time.Minute)
+	record, change, err = watchlist.Update([]string{"b", "c"}, time.Hour, third)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, change, main.WatchlistChange{At: third})
+	assert.DeepEqual(t, record.Unwatched, map[string]time.Time{"a": second})
+	assert.Equal(t, len(record.Changes), 1)
+
+	// Back again
+	fourth := third.Add(time.Minute)
+	record, change, err = watchlist.Update([]string{"a", "b", "c"}, time.Hour, fourth)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, change.Added, []string{"a"})
+	assert.Equal(t, len(record.Unwatched), 0)
+	assert.Equal(t, len(record.Changes), 2)
+
+	// Forgotten once the grace period is over
+	fifth := fourth.Add(24 * time.Hour)
+	record, _, err = watchlist.Update([]string{"b", "c"}, time.Hour, fifth)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, record.Unwatched, map[string]time.Time{"a": fifth})
+	record, _, err = watchlist.Update([]string{"b", "c"}, time.Hour, fifth.Add(time.Hour))
+	assert.NilError(t, err)
+	assert.Equal(t, len(record.Unwatched), 0)
+}
+
+func TestWatchlist_MassRemoval(t *testing.T) {
+	watchlist := main.NewWatchlist("watcher", t.TempDir())
+	start := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	later := start.Add(24 * time.Hour)
+	_, _, err := watchlist.Update([]string{"a", "b", "c", "d"}, 0, start)
+	assert.NilError(t, err)
+
+	// Losing everyone, or more than half, is refused
+	for _, artists := range [][]string{nil, {"a"}} {
+		_, _, err = watchlist.Update(artists, 0, later)
+		assert.ErrorIs(t, err, main.ErrMassUnwatch)
+	}
+	record, err := watchlist.Load()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, record.Artists, []string{"a", "b", "c", "d"})
+	assert.Assert(t, record.UpdatedAt.Equal(start))
+
+	watchlist.SetAllowMassRemoval(true)
+	record, change, err := watchlist.Update(nil, 0, later)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, change.Removed, []string{"a", "b", "c", "d"})
+	assert.Equal(t, len(record.Artists), 0)
+
+	// Half is allowed without it
+	watchlist = main.NewWatchlist("other", t.TempDir())
+	_, _, err = watchlist.Update([]string{"a", "b", "c", "d"}, 0, start)
+	assert.NilError(t, err)
+	_, change, err = watchlist.Update([]string{"a", "b"}, 0, later)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, change.Removed, []string{"c", "d"})
+}
+
+func TestScraper_Watchlist(t *testing.T) {
+	tempdir := t.TempDir()
+	artistDir := filepath.Join(tempdir, watchlistArtist)
+	emptyWatchlist := NewTestClient()
+	emptyWatchlist.SetResponse(watchlistPage1, []byte("<html><body>Nobody</body></html>"), nil)
+
+	run := func(t *testing.T, client *TestClient, grace time.Duration) main.RunSummary {
+		t.Helper()
+		scraper := main.NewScraper(NewTestLogger(t), client, watchlistWatcher, nil, false, false, tempdir)
+		scraper.SetUnwatched(grace, true)
+		scraper.SetAllowMassUnwatch(true)
+		err := scraper.Run(t.Context())
+		assert.NilError(t, err)
+		return scraper.Summary()
+	}
+
+	t.Run("records the watchlist", func(t *testing.T) {
+		assert.Equal(t, run(t, NewTestClient(), 0).ArtistsTotal, 1)
+		_, err := os.Stat(filepath.Join(tempdir, "watchlists", watchlistWatcher+".json"))
+		assert.NilError(t, err)
+	})
+
+	t.Run("losing everyone stops the run", func(t *testing.T) {
+		scraper := main.NewScraper(NewTestLogger(t), emptyWatchlist, watchlistWatcher, nil, false, false, tempdir)
+		scraper.SetUnwatched(time.Hour, true)
+		err := scraper.Run(t.Context())
+		assert.ErrorIs(t, err, main.ErrMassUnwatch)
+		_, err = os.Stat(filepath.Join(artistDir, "unwatched.json"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("unwatched artists are crawled during the grace period", func(t *testing.T) {
+		assert.Equal(t, run(t, emptyWatchlist, time.Hour).ArtistsTotal, 1)
+		marker := readJSON[main.UnwatchedMarker](t, filepath.Join(artistDir, "unwatched.json"))
+		assert.Equal(t, marker.Watcher, watchlistWatcher)
+		assert.Assert(t, !marker.Since.IsZero())
+	})
+
+	t.Run("and not after it", func(t *testing.T) {
+		assert.Equal(t, run(t, emptyWatchlist, 0).ArtistsTotal, 0)
+	})
+
+	t.Run("watching again removes the marker", func(t *testing.T) {
+		assert.Equal(t, run(t, NewTestClient(), 0).ArtistsTotal, 1)
+		_, err := os.Stat(filepath.Join(artistDir, "unwatched.json"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
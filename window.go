@@ -0,0 +1,210 @@
+package main
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	// Zone names like America/Chicago have to work on systems without a
+	// zoneinfo database, e.g. Windows.
+	_ "time/tzdata"
+)
+
+const (
+	// How long to sleep at a time while waiting for the operating window to
+	// open.  The wait is worked out again after each, in case the clock
+	// changed or the machine was suspended.
+	windowRecheckInterval = 10 * time.Minute
+
+	// Format of the times in an operating window
+	windowTimeLayout = "15:04"
+
+	// Fields in an operating window which gives its time zone
+	windowFieldsWithZone = 2
+)
+
+var ErrInvalidWindow = errors.New("invalid operating window")
+
+// OperatingWindow is the time of day furtrap is allowed to make requests,
+// e.g. the small hours in the USA, when FA is quiet.  The zero value is
+// always open.
+type OperatingWindow struct {
+	Start    time.Duration  // Opening time, as an offset from midnight
+	End      time.Duration  // Closing time, as an offset from midnight.  Before Start if it spans midnight.
+	Location *time.Location // Time zone the times are in, nil for no window
+}
+
+// ParseOperatingWindow parses an operating window like "01:00-07:00
+// America/Chicago".  The time zone is optional, defaulting to local time, and
+// the window may span midnight, e.g. "22:00-06:00".
+//
+// Parameters:
+//   - spec: The window, or empty for no window
+//
+// Returns:
+//   - OperatingWindow: The window, the zero value if spec is empty
+//   - error: ErrInvalidWindow if spec can't be parsed
+func ParseOperatingWindow(spec string) (OperatingWindow, error) {
+	fields := strings.Fields(spec)
+	if len(fields) == 0 {
+		return OperatingWindow{}, nil
+	}
+	startText, endText, ok := strings.Cut(fields[0], "-")
+	if !ok || len(fields) > windowFieldsWithZone {
+		return OperatingWindow{}, fmt.Errorf("%w: %q, expected e.g. \"01:00-07:00 America/Chicago\"",
+			ErrInvalidWindow, spec)
+	}
+	start, err := parseWindowTime(startText)
+	if err != nil {
+		return OperatingWindow{}, err
+	}
+	end, err := parseWindowTime(endText)
+	if err != nil {
+		return OperatingWindow{}, err
+	}
+	if start == end {
+		return OperatingWindow{}, fmt.Errorf("%w: %q opens and closes at the same time", ErrInvalidWindow, spec)
+	}
+
+	location := time.Local
+	if len(fields) == windowFieldsWithZone {
+		location, err = time.LoadLocation(fields[1])
+		if err != nil {
+			return OperatingWindow{}, fmt.Errorf("%w: unknown time zone %q", ErrInvalidWindow, fields[1])
+		}
+	}
+
+	return OperatingWindow{Start: start, End: end, Location: location}, nil
+}
+
+// parseWindowTime parses one end of an operating window.
+//
+// Parameters:
+//   - text: The time, as HH:MM
+//
+// Returns:
+//   - time.Duration: The time as an offset from midnight
+//   - error: ErrInvalidWindow if it can't be parsed
+func parseWindowTime(text string) (time.Duration, error) {
+	parsed, err := time.Parse(windowTimeLayout, text)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q is not a time of day like 01:00", ErrInvalidWindow, text)
+	}
+	return time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute, nil
+}
+
+// String formats the window the way ParseOperatingWindow reads it.
+//
+// Returns:
+//   - string: The window, or empty for no window
+func (w OperatingWindow) String() string {
+	if w.Location == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s-%s %s", formatWindowTime(w.Start), formatWindowTime(w.End), w.Location)
+}
+
+// formatWindowTime formats one end of an operating window.
+//
+// Parameters:
+//   - offset: The time as an offset from midnight
+//
+// Returns:
+//   - string: The time, as HH:MM
+func formatWindowTime(offset time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(offset/time.Hour), int(offset%time.Hour/time.Minute))
+}
+
+// NextOpen returns when the window is next open.  Times are wall clock times
+// in the window's zone, so the window stays put across daylight saving
+// changes.
+//
+// Parameters:
+//   - now: The current time
+//
+// Returns:
+//   - time.Time: now if the window is open, otherwise when it next opens
+func (w OperatingWindow) NextOpen(now time.Time) time.Time {
+	if w.Location == nil {
+		return now
+	}
+
+	// A window which spans midnight may have opened yesterday.
+	local := now.In(w.Location)
+	for days := -1; days <= 0; days++ {
+		opens, closes := w.on(local.Year(), local.Month(), local.Day()+days)
+		if now.Before(opens) {
+			return opens
+		}
+		if now.Before(closes) {
+			return now
+		}
+	}
+	opens, _ := w.on(local.Year(), local.Month(), local.Day()+1)
+	return opens
+}
+
+// on returns when the window opening on a given day opens and closes.
+//
+// Parameters:
+//   - year, month, day: The day it opens, normalized as time.Date does
+//
+// Returns:
+//   - time.Time: When it opens
+//   - time.Time: When it closes, which is the next day if it spans midnight
+func (w OperatingWindow) on(year int, month time.Month, day int) (time.Time, time.Time) {
+	at := func(day int, offset time.Duration) time.Time {
+		return time.Date(year, month, day, int(offset/time.Hour), int(offset%time.Hour/time.Minute), 0, 0,
+			w.Location)
+	}
+	closeDay := day
+	if w.End < w.Start {
+		closeDay++
+	}
+	return at(day, w.Start), at(closeDay, w.End)
+}
+
+// SetOperatingWindow restricts the client to making requests while the window
+// is open.  Outside it, each request waits for it to open, without contacting
+// FA, so whatever was in progress carries on where it left off.  A download
+// already under way when it closes is finished.
+//
+// Parameters:
+//   - window: The window, the zero value for no restriction
+func (h *HTTPClient) SetOperatingWindow(window OperatingWindow) {
+	h.window = window
+}
+
+// waitForWindow waits until the operating window is open.
+//
+// Parameters:
+//   - ctx: Context for cancellation of the wait
+//
+// Returns:
+//   - error: The context's error if canceled while waiting
+func (h *HTTPClient) waitForWindow(ctx context.Context) error {
+	logged := false
+	for {
+		now := time.Now()
+		opens := h.window.NextOpen(now)
+		if !opens.After(now) {
+			if logged {
+				h.logger.Info("Operating window open, resuming")
+			}
+			return nil
+		}
+		if !logged {
+			h.logger.Info("Outside the operating window, pausing until it opens",
+				"window", h.window.String(), "opens", opens)
+			logged = true
+		}
+		err := sleepContext(ctx, min(opens.Sub(now), windowRecheckInterval))
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main_test
+
+// SPDX-License-Identifier: GPL-3.0-only
+
+import (
+	"context"
+	"fmt"
+	main "furtrap"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParseOperatingWindow(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		tests := []struct {
+			spec  string
+			start time.Duration
+			end   time.Duration
+			zone  string
+		}{
+			{"01:00-07:00 America/Chicago", time.Hour, 7 * time.Hour, "America/Chicago"},
+			{"22:30-06:00 UTC", 22*time.Hour + 30*time.Minute, 6 * time.Hour, "UTC"},
+			{"1:00-7:00", time.Hour, 7 * time.Hour, "Local"},
+		}
+		for _, tt := range tests {
+			window, err := main.ParseOperatingWindow(tt.spec)
+			assert.NilError(t, err, tt.spec)
+			assert.Equal(t, window.Start, tt.start, tt.spec)
+			assert.Equal(t, window.End, tt.end, tt.spec)
+			assert.Equal(t, window.Location.String(), tt.zone, tt.spec)
+		}
+
+		// No window at all
+		window, err := main.ParseOperatingWindow("")
+		assert.NilError(t, err)
+		assert.Assert(t, window.Location == nil)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, spec := range []string{
+			"01:00",
+			"01:00-07:00 Nowhere/Special",
+			"01:00-25:00",
+			"1am-7am",
+			"01:00-01:00",
+			"01:00-07:00 America/Chicago extra",
+		} {
+			_, err := main.ParseOperatingWindow(spec)
+			assert.ErrorIs(t, err, main.ErrInvalidWindow, spec)
+		}
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		window, err := main.ParseOperatingWindow("1:00-7:05 America/Chicago")
+		assert.NilError(t, err)
+		assert.Equal(t, window.String(), "01:00-07:05 America/Chicago")
+	})
+}
+
+func TestOperatingWindow_NextOpen(t *testing.T) {
+	chicago, err := time.LoadLocation("America/Chicago")
+	assert.NilError(t, err)
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, chicago)
+	}
+
+	night, err := main.ParseOperatingWindow("01:00-07:00 America/Chicago")
+	assert.NilError(t, err)
+	spanning, err := main.ParseOperatingWindow("22:00-06:00 America/Chicago")
+	assert.NilError(t, err)
+
+	tests := []struct {
+		name   string
+		window main.OperatingWindow
+		now    time.Time
+		want   time.Time
+	}{
+		{"no window", main.OperatingWindow{}, at(time.June, 1, 12, 0), at(time.June, 1, 12, 0)},
+		{"before it opens", night, at(time.June, 1, 0, 30), at(time.June, 1, 1, 0)},
+		{"as it opens", night, at(time.June, 1, 1, 0), at(time.June, 1, 1, 0)},
+		{"open", night, at(time.June, 1, 6, 59), at(time.June, 1, 6, 59)},
+		{"as it closes", night, at(time.June, 1, 7, 0), at(time.June, 2, 1, 0)},
+		{"after it closes", night, at(time.June, 1, 23, 0), at(time.June, 2, 1, 0)},
+		{"spanning midnight, open late", spanning, at(time.June, 1, 23, 0), at(time.June, 1, 23, 0)},
+		{"spanning midnight, open early", spanning, at(time.June, 2, 5, 0), at(time.June, 2, 5, 0)},
+		{"spanning midnight, closed", spanning, at(time.June, 2, 12, 0), at(time.June, 2, 22, 0)},
+		{"given in another zone", night, at(time.June, 1, 12, 0).UTC(), at(time.June, 2, 1, 0)},
+		// Clocks go forward at 02:00 on March 8th, and back at 02:00 on
+		// November 1st.  The window still opens at 01:00 local time.
+		{"spring forward", night, at(time.March, 7, 12, 0), at(time.March, 8, 1, 0)},
+		{"fall back", night, at(time.October, 31, 12, 0), at(time.November, 1, 1, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Assert(t, tt.window.NextOpen(tt.now).Equal(tt.want),
+				"got %s, want %s", tt.window.NextOpen(tt.now), tt.want)
+		})
+	}
+}
+
+func TestHTTPClient_OperatingWindow(t *testing.T) {
+	var requests atomic.Int32
+	handler := func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write([]byte("ok"))
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	// An hour-long window, opening this long from now
+	window := func(t *testing.T, from time.Duration) main.OperatingWindow {
+		t.Helper()
+		start := time.Now().UTC().Add(from)
+		end := start.Add(time.Hour)
+		spec := fmt.Sprintf("%s-%s UTC", start.Format("15:04"), end.Format("15:04"))
+		parsed, err := main.ParseOperatingWindow(spec)
+		assert.NilError(t, err)
+		return parsed
+	}
+
+	t.Run("closed", func(t *testing.T) {
+		requests.Store(0)
+		client := main.NewHTTPClient(NewTestLogger(t))
+		client.SetOperatingWindow(window(t, time.Hour))
+
+		ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+		defer cancel()
+		_, err := client.Get(ctx, server.URL)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		err = client.Download(ctx, server.URL, t.TempDir()+"/file")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, requests.Load(), int32(0))
+	})
+
+	t.Run("open", func(t *testing.T) {
+		requests.Store(0)
+		client := main.NewHTTPClient(NewTestLogger(t))
+		client.SetOperatingWindow(window(t, -time.Minute))
+
+		body, err := client.Get(t.Context(), server.URL)
+		assert.NilError(t, err)
+		assert.Equal(t, string(body), "ok")
+		assert.Equal(t, requests.Load(), int32(1))
+	})
+}